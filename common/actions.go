@@ -0,0 +1,581 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Shared logic for changing branches, tags, releases, discussions, and merge requests.  These are used by both the
+// webUI and the DB4S end point, which handle the request parsing and authentication themselves.
+
+// An error from one of the shared actions, along with the HTTP status code to return to the caller
+type ActionError struct {
+	Msg    string
+	Status int
+}
+
+func (e ActionError) Error() string {
+	return e.Msg
+}
+
+// Adds a comment to a discussion or merge request, optionally closing or reopening it
+func AddComment(loggedInUser string, dbOwner string, dbFolder string, dbName string, discID int, comText string,
+	discClose bool) error {
+	err := StoreComment(dbOwner, dbFolder, dbName, loggedInUser, discID, comText, discClose,
+		CLOSED_WITHOUT_MERGE) // CLOSED_WITHOUT_MERGE is ignored for discussions.  It's only used for MRs
+	if err != nil {
+		return err
+	}
+
+	// Invalidate the memcache data for the database, so if the discussion counter for the database was changed it
+	// gets picked up
+	if discClose {
+		invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	}
+	return nil
+}
+
+// Creates a new branch, starting from the given commit
+func CreateBranch(loggedInUser string, dbOwner string, dbFolder string, dbName string, branchName string,
+	commitID string, branchDesc string) error {
+	// Make sure the database owner matches the logged in user
+	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
+		return newActionError(http.StatusUnauthorized, "You can't change databases you don't own")
+	}
+
+	// Read the branch heads list from the database
+	branches, err := GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the branch name doesn't already exist
+	if _, ok := branches[branchName]; ok {
+		return newActionError(http.StatusConflict, "A branch of that name already exists!")
+	}
+
+	// Count the number of commits in the new branch
+	hist, err := commitAncestors(dbOwner, dbFolder, dbName, []string{commitID})
+	if err != nil {
+		return err
+	}
+	if !hist[commitID] {
+		return newActionError(http.StatusBadRequest, "The given commit ID doesn't exist")
+	}
+	commitCount := len(hist)
+
+	// Create the branch
+	b := BranchEntry{
+		Commit:      commitID,
+		CommitCount: commitCount,
+		Description: branchDesc,
+	}
+	err = StoreBranch(dbOwner, dbFolder, dbName, branchName, b)
+	if err != nil {
+		return err
+	}
+
+	// Invalidate the memcache data for the database, so the new branch count gets picked up
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return nil
+}
+
+// Creates a new discussion, returning its ID
+func CreateDiscussion(loggedInUser string, dbOwner string, dbFolder string, dbName string, title string,
+	text string) (int, error) {
+	// Add the discussion detail to PostgreSQL
+	id, err := StoreDiscussion(dbOwner, dbFolder, dbName, loggedInUser, title, text, DISCUSSION,
+		MergeRequestEntry{})
+	if err != nil {
+		return 0, err
+	}
+
+	// Generate an event about the new discussion
+	details := EventDetails{
+		DBName:   dbName,
+		DiscID:   id,
+		Folder:   dbFolder,
+		Owner:    dbOwner,
+		Title:    title,
+		Type:     EVENT_NEW_DISCUSSION,
+		URL:      fmt.Sprintf("/discuss/%s%s%s?id=%d", dbOwner, dbFolder, dbName, id),
+		UserName: loggedInUser,
+	}
+	err = NewEvent(details)
+	if err != nil {
+		log.Printf("Error when creating a new event: %s\n", err.Error())
+	}
+
+	// Invalidate the memcache data for the database, so the new discussion count gets picked up
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return id, nil
+}
+
+// Creates a new merge request, returning its ID
+func CreateMergeRequest(loggedInUser string, srcOwner string, srcFolder string, srcDBName string, srcBranch string,
+	destOwner string, destFolder string, destDBName string, destBranch string, title string,
+	descrip string) (int, error) {
+	// Get the details of the commits for the MR
+	mrDetails := MergeRequestEntry{
+		DestBranch:   destBranch,
+		SourceBranch: srcBranch,
+		SourceDBName: srcDBName,
+		SourceFolder: srcFolder,
+		SourceOwner:  srcOwner,
+	}
+	var ancestorID string
+	var err error
+	ancestorID, mrDetails.Commits, err, _ = GetCommonAncestorCommits(srcOwner, srcFolder, srcDBName, srcBranch,
+		destOwner, destFolder, destDBName, destBranch)
+	if err != nil {
+		return 0, err
+	}
+
+	// Make sure the source branch will cleanly apply to the destination.  eg the destination branch hasn't received
+	// additional commits since the source was forked
+	if ancestorID == "" {
+		return 0, newActionError(http.StatusConflict,
+			"Source branch is not a direct descendent of the destination branch.  Cannot merge.")
+	}
+
+	// Create the merge request in PostgreSQL
+	id, err := StoreDiscussion(destOwner, destFolder, destDBName, loggedInUser, title, descrip, MERGE_REQUEST,
+		mrDetails)
+	if err != nil {
+		return 0, err
+	}
+
+	// Generate an event about the new merge request
+	details := EventDetails{
+		DBName:   destDBName,
+		DiscID:   id,
+		Folder:   destFolder,
+		Owner:    destOwner,
+		Title:    title,
+		Type:     EVENT_NEW_MERGE_REQUEST,
+		URL:      fmt.Sprintf("/merge/%s%s%s?id=%d", destOwner, destFolder, destDBName, id),
+		UserName: loggedInUser,
+	}
+	err = NewEvent(details)
+	if err != nil {
+		log.Printf("Error when creating a new event: %s\n", err.Error())
+	}
+
+	// Invalidate the memcache data for the destination database, so the new MR count gets picked up
+	invalidateDBCache(loggedInUser, destOwner, destFolder, destDBName)
+	return id, nil
+}
+
+// Creates a new (signed, if enabled) release for the given commit
+func CreateRelease(loggedInUser string, dbOwner string, dbFolder string, dbName string, relName string,
+	commitID string, relDesc string) error {
+	// Make sure the database owner matches the logged in user
+	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
+		return newActionError(http.StatusUnauthorized, "You can't change databases you don't own")
+	}
+
+	// Read the releases list from the database
+	rels, err := GetReleases(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Ensure the release doesn't already exist
+	if _, ok := rels[relName]; ok {
+		return newActionError(http.StatusConflict, "A release of that name already exists!")
+	}
+
+	// Retrieve the size of the database for this release
+	c, ok, err := GetCommit(dbOwner, dbFolder, dbName, commitID)
+	if err != nil {
+		return err
+	}
+	if !ok || len(c.Tree.Entries) == 0 {
+		return newActionError(http.StatusBadRequest, "The given commit ID doesn't exist")
+	}
+
+	// Retrieve the user details
+	usr, err := User(loggedInUser)
+	if err != nil {
+		return err
+	}
+
+	// Create and sign the release
+	newRel := ReleaseEntry{
+		Commit:        commitID,
+		Date:          time.Now(),
+		Description:   relDesc,
+		ReleaserEmail: usr.Email,
+		ReleaserName:  usr.DisplayName,
+		Size:          c.Tree.Entries[0].Size,
+	}
+	err = SignRelease(dbOwner, dbFolder, dbName, relName, &newRel)
+	if err != nil {
+		return err
+	}
+
+	// Store it in PostgreSQL
+	err = StoreRelease(dbOwner, dbFolder, dbName, relName, newRel)
+	if err != nil {
+		return err
+	}
+
+	// Invalidate the memcache data for the database
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return nil
+}
+
+// Creates a new tag for the given commit
+func CreateTag(loggedInUser string, dbOwner string, dbFolder string, dbName string, tagName string,
+	commitID string, tagDesc string) error {
+	// Make sure the database owner matches the logged in user
+	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
+		return newActionError(http.StatusUnauthorized, "You can't change databases you don't own")
+	}
+
+	// Read the tags list from the database
+	tags, err := GetTags(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the tag doesn't already exist
+	if _, ok := tags[tagName]; ok {
+		return newActionError(http.StatusConflict, "A tag of that name already exists!")
+	}
+
+	// Make sure the commit exists
+	_, ok, err := GetCommit(dbOwner, dbFolder, dbName, commitID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return newActionError(http.StatusBadRequest, "The given commit ID doesn't exist")
+	}
+
+	// Retrieve the user details
+	usr, err := User(loggedInUser)
+	if err != nil {
+		return err
+	}
+
+	// Create the tag
+	t := TagEntry{
+		Commit:      commitID,
+		Date:        time.Now(),
+		Description: tagDesc,
+		TaggerEmail: usr.Email,
+		TaggerName:  usr.DisplayName,
+	}
+
+	// Store it in PostgreSQL
+	err = StoreTag(dbOwner, dbFolder, dbName, tagName, t)
+	if err != nil {
+		return err
+	}
+
+	// Invalidate the memcache data for the database, so the new tag count gets picked up
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return nil
+}
+
+// Deletes a branch, along with any commits which were only on that branch.  Branches with tags or releases which
+// would no longer be reachable can't be deleted.
+func DeleteBranch(loggedInUser string, dbOwner string, dbFolder string, dbName string, branchName string) error {
+	// Make sure the database is owned by the logged in user. eg prevent changes to other people's databases
+	if strings.ToLower(dbOwner) != strings.ToLower(loggedInUser) {
+		return newActionError(http.StatusBadRequest, "You can't change databases you don't own")
+	}
+
+	// Load the existing branchHeads for the database
+	branchList, err := GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the given branch exists
+	branch, ok := branchList[branchName]
+	if !ok {
+		return newActionError(http.StatusBadRequest, "Unknown branch name")
+	}
+
+	// Make sure the branch being deleted isn't the default one
+	defBranch, err := GetDefaultBranchName(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+	if defBranch == branchName {
+		return newActionError(http.StatusConflict, "The default branch can't be deleted")
+	}
+
+	// Work out which commits are only on this branch, as they're removed along with it
+	lst, err := commitAncestors(dbOwner, dbFolder, dbName, []string{branch.Commit})
+	if err != nil {
+		return err
+	}
+	if !lst[branch.Commit] {
+		return fmt.Errorf("Broken commit history for branch '%s' of database '%s%s%s'", branchName, dbOwner,
+			dbFolder, dbName)
+	}
+	var otherHeads []string
+	for bName, bEntry := range branchList {
+		if bName != branchName {
+			otherHeads = append(otherHeads, bEntry.Commit)
+		}
+	}
+	otherHist, err := commitAncestors(dbOwner, dbFolder, dbName, otherHeads)
+	if err != nil {
+		return err
+	}
+	for cid := range otherHist {
+		delete(lst, cid) // The commit is also on another branch, so we *must not* delete the commit afterwards
+	}
+
+	// Make sure that deleting this branch wouldn't result in any isolated tags or releases.  For example, when there
+	// is a tag or release on a commit which is only in this branch, deleting the branch would leave the tag or
+	// release in place with no way to reach it
+
+	// Get the tag list for the database
+	tags, err := GetTags(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Get the release list for the database
+	rels, err := GetReleases(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Check for tags which are only reachable from this branch
+	tagCommits := make(map[string]string)
+	for tName, tEntry := range tags {
+		tagCommits[tName] = tEntry.Commit
+	}
+	isolatedTags := isolatedBranchNames(lst, tagCommits)
+	if len(isolatedTags) > 1 {
+		return newActionError(http.StatusConflict, fmt.Sprintf(
+			"You need to delete the tags '%s' before you can delete this branch", strings.Join(isolatedTags, ", ")))
+	}
+	if len(isolatedTags) == 1 {
+		return newActionError(http.StatusConflict, fmt.Sprintf(
+			"You need to delete the tag '%s' before you can delete this branch", isolatedTags[0]))
+	}
+
+	// Check for releases which are only reachable from this branch
+	relCommits := make(map[string]string)
+	for rName, rEntry := range rels {
+		relCommits[rName] = rEntry.Commit
+	}
+	isolatedRels := isolatedBranchNames(lst, relCommits)
+	if len(isolatedRels) > 1 {
+		return newActionError(http.StatusConflict, fmt.Sprintf(
+			"You need to delete the releases '%s' before you can delete this branch",
+			strings.Join(isolatedRels, ", ")))
+	}
+	if len(isolatedRels) == 1 {
+		return newActionError(http.StatusConflict, fmt.Sprintf(
+			"You need to delete the release '%s' before you can delete this branch", isolatedRels[0]))
+	}
+
+	// Delete the branch along with its left over commits, as long as it hasn't moved since the checks above
+	// TODO: We may want to consider clearing any memcache entries for the deleted commits too
+	delList := make([]string, 0, len(lst))
+	for cid := range lst {
+		delList = append(delList, cid)
+	}
+	err = RemoveBranch(dbOwner, dbFolder, dbName, branchName, branch.Commit, delList)
+	if err != nil {
+		return err
+	}
+
+	// Invalidate the memcache data for the database, so the new branch count gets picked up
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return nil
+}
+
+// Deletes a tag
+func DeleteTag(loggedInUser string, dbOwner string, dbFolder string, dbName string, tagName string) error {
+	// Make sure the database is owned by the logged in user. eg prevent changes to other people's databases
+	if strings.ToLower(dbOwner) != strings.ToLower(loggedInUser) {
+		return newActionError(http.StatusBadRequest, "You can't change databases you don't own")
+	}
+
+	// Load the existing tags for the database
+	tags, err := GetTags(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the given tag exists
+	if _, ok := tags[tagName]; !ok {
+		return newActionError(http.StatusBadRequest, "Unknown tag name")
+	}
+
+	// Delete the tag
+	err = RemoveTag(dbOwner, dbFolder, dbName, tagName)
+	if err != nil {
+		return err
+	}
+
+	// Invalidate the memcache data for the database, so the new tag count gets picked up
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return nil
+}
+
+// Returns the HTTP status code for an error returned by the shared actions
+func ErrorStatus(err error) int {
+	if e, ok := err.(ActionError); ok {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// Merges a merge request into its destination branch.  Only the owner of the destination database can do this.
+func MergeRequest(loggedInUser string, dbOwner string, dbFolder string, dbName string, mrID int) error {
+	// Ensure the request is coming from the database owner
+	if strings.ToLower(dbOwner) != strings.ToLower(loggedInUser) {
+		return newActionError(http.StatusUnauthorized, "Only the database owner can merge in merge requests")
+	}
+
+	// Retrieve the names of the source & destination databases and branches
+	disc, err := Discussions(dbOwner, dbFolder, dbName, MERGE_REQUEST, mrID)
+	if err != nil {
+		return err
+	}
+	if len(disc) == 0 {
+		return newActionError(http.StatusNotFound, "Unknown merge request")
+	}
+	branchName := disc[0].MRDetails.DestBranch
+	commitDiffList := disc[0].MRDetails.Commits
+	srcOwner := disc[0].MRDetails.SourceOwner
+	srcFolder := disc[0].MRDetails.SourceFolder
+	srcDBName := disc[0].MRDetails.SourceDBName
+	srcBranchName := disc[0].MRDetails.SourceBranch
+
+	// Ensure the merge request isn't closed
+	if !disc[0].Open {
+		return newActionError(http.StatusBadRequest, "Cannot merge a closed merge request")
+	}
+
+	// Get the details of the head commit for the destination database branch
+	branchList, err := GetBranches(dbOwner, dbFolder, dbName) // Destination branch list
+	if err != nil {
+		return err
+	}
+	branchDetails, ok := branchList[branchName]
+	if !ok {
+		return fmt.Errorf("Could not retrieve details for the destination branch")
+	}
+	destCommitID := branchDetails.Commit
+
+	// Check if the MR commits will still apply cleanly to the destination branch
+	finalCommit := commitDiffList[len(commitDiffList)-1]
+	if finalCommit.Parent != destCommitID {
+		return fmt.Errorf("Destination branch has changed. Merge cannot proceed.")
+	}
+
+	// Run the data validation rules for the destination database against the database file being merged in
+	rules, err := GetValidationRules(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+	var failures []ValidationFailure
+	if len(rules) > 0 {
+		srcSha := commitDiffList[0].Tree.Entries[0].Sha256
+		sdb, err := OpenMinioObject(srcSha[:MinioFolderChars], srcSha[MinioFolderChars:])
+		if err != nil {
+			return err
+		}
+		failures, err = CheckValidationRules(sdb, rules)
+		sdb.Close()
+		if err != nil {
+			return err
+		}
+		err = ValidationError(failures)
+		if err != nil {
+			return newActionError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	// * The required details have been collected, and sanity checks completed, so merge the MR *
+
+	// Add the source commits directly to the destination commit list
+	newCommits := make(map[string]CommitEntry)
+	for _, j := range commitDiffList {
+		newCommits[j.ID] = j
+	}
+
+	// Retrieve details for the logged in user
+	usr, err := User(loggedInUser)
+	if err != nil {
+		return err
+	}
+
+	// Create a merge commit, using the details of the source commit (this gets us a correctly filled in DB tree
+	// structure easily)
+	mrg := commitDiffList[0]
+	mrg.AuthorEmail = usr.Email
+	mrg.AuthorName = usr.DisplayName
+	mrg.Message = fmt.Sprintf("Merge branch '%s' of '%s%s%s' into '%s'", srcBranchName, srcOwner, srcFolder,
+		srcDBName, branchName)
+	mrg.Parent = commitDiffList[0].ID
+	mrg.OtherParents = append(mrg.OtherParents, destCommitID)
+	mrg.Timestamp = time.Now().UTC()
+	mrg.ValidationFailures = failures
+	mrg.ID = CreateCommitID(mrg)
+
+	// Add the new commit to the destination db commit list, and move the branch head to it.  If the destination
+	// branch has changed since it was checked above, nothing is stored
+	newCommits[mrg.ID] = mrg
+	b := BranchEntry{
+		Commit:      mrg.ID,
+		CommitCount: branchDetails.CommitCount + len(commitDiffList) + 1,
+		Description: branchDetails.Description,
+	}
+	err = UpdateBranchHead(dbOwner, dbFolder, dbName, branchName, destCommitID, b, newCommits)
+	if err != nil {
+		return err
+	}
+
+	// Change the status of the MR to closed, and indicate it was successfully merged
+	err = StoreComment(dbOwner, dbFolder, dbName, loggedInUser, mrID, "", true, CLOSED_WITH_MERGE)
+	if err != nil {
+		return err
+	}
+
+	// Invalidate the memcached entries for the destination database case
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return nil
+}
+
+// Invalidates the memcached entries for all versions of a database.  Failures are only logged, as the change itself
+// has already been made.
+func invalidateDBCache(loggedInUser string, dbOwner string, dbFolder string, dbName string) {
+	err := InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
+	if err != nil {
+		// Something went wrong when invalidating memcached entries for the database
+		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+	}
+}
+
+// Returns the names (of tags or releases) whose commits are only on the branch being deleted, given the set of commits
+// which aren't on any other branch
+func isolatedBranchNames(branchOnly map[string]bool, names map[string]string) (isolated []string) {
+	for n, cid := range names {
+		if branchOnly[cid] {
+			isolated = append(isolated, n)
+		}
+	}
+	sort.Strings(isolated)
+	return
+}
+
+// Creates a new error with an HTTP status code
+func newActionError(status int, msg string) error {
+	return ActionError{Msg: msg, Status: status}
+}
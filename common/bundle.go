@@ -0,0 +1,453 @@
+package common
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Bundles are zip archives used by DB4S to push or pull several commits in one operation.  They hold a
+// "commits.json" file with the commit entries (oldest first), plus one file for each distinct database the commits
+// use, named by the SHA256 of the database.  Database files already in the history of the database being pushed to
+// can be left out when pushing.
+
+// The name of the commit list inside a bundle
+const bundleCommitsFile = "commits.json"
+
+// The maximum number of commits accepted in one bundle
+const MaxBundleCommits = 1000
+
+// The maximum bundle size accepted for upload (in MB)
+const MaxBundleSize = 2048
+
+// Writes a bundle holding the commits on a branch which come after the given commit, along with the database files
+// they use.  If no commit is given, the whole history for the branch is included.  Returns the number of commits in
+// the bundle.
+func PullBundle(dbOwner string, dbFolder string, dbName string, branchName string, sinceCommit string,
+	w io.Writer) (numCommits int, err error) {
+	// Retrieve the branch head and commit list
+	branches, err := GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return 0, err
+	}
+	b, ok := branches[branchName]
+	if !ok {
+		return 0, newActionError(http.StatusNotFound, fmt.Sprintf("Unknown branch '%s'", branchName))
+	}
+	commitList, err := GetCommitList(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return 0, err
+	}
+
+	// Walk back from the branch head, collecting the commits the client doesn't have yet
+	var commits []CommitEntry
+	cid := b.Commit
+	for cid != sinceCommit {
+		if cid == "" {
+			return 0, newActionError(http.StatusConflict, fmt.Sprintf("Commit '%s' isn't in the history of "+
+				"branch '%s'.  The local branch has diverged from the server.", sinceCommit, branchName))
+		}
+		c, ok := commitList[cid]
+		if !ok {
+			return 0, fmt.Errorf("Broken commit history for branch '%s' of database '%s%s%s'", branchName,
+				dbOwner, dbFolder, dbName)
+		}
+		commits = append(commits, c)
+		cid = c.Parent
+	}
+
+	// Reverse the list, so the oldest commit is first
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+
+	// Write the commit list
+	z := zip.NewWriter(w)
+	f, err := z.Create(bundleCommitsFile)
+	if err != nil {
+		return 0, err
+	}
+	err = json.NewEncoder(f).Encode(commits)
+	if err != nil {
+		return 0, err
+	}
+
+	// Add the distinct database files
+	added := make(map[string]bool)
+	for _, c := range commits {
+		for _, e := range c.Tree.Entries {
+			if e.EntryType != DATABASE || added[e.Sha256] {
+				continue
+			}
+			added[e.Sha256] = true
+			err = addBundleFile(z, e.Sha256)
+			if err != nil {
+				log.Printf("Error when adding database '%s' to a bundle for '%s%s%s': %v\n", e.Sha256, dbOwner,
+					dbFolder, dbName, err)
+				return 0, err
+			}
+		}
+	}
+	err = z.Close()
+	if err != nil {
+		return 0, err
+	}
+	return len(commits), nil
+}
+
+// Adds the commits in a bundle to a branch of an existing database.  The commits need to form a chain starting at
+// the current head of the branch, so only fast-forward pushes are accepted.  Commits the server already has at the
+// start of the chain are skipped, so an interrupted push can be safely retried.  Returns the new head commit of the
+// branch, and the number of commits added.
+func PushBundle(r *http.Request, loggedInUser string, dbOwner string, dbFolder string, dbName string,
+	branchName string, bundle io.ReaderAt, size int64) (head string, numCommits int, err error) {
+	// Make sure the database owner matches the logged in user
+	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
+		return "", 0, newActionError(http.StatusUnauthorized, "You can't change databases you don't own")
+	}
+
+	// Open the bundle, and read the commit list from it
+	z, err := zip.NewReader(bundle, size)
+	if err != nil {
+		return "", 0, newActionError(http.StatusBadRequest, "The bundle isn't a valid zip archive")
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+	cf, ok := files[bundleCommitsFile]
+	if !ok {
+		return "", 0, newActionError(http.StatusBadRequest,
+			fmt.Sprintf("The bundle doesn't contain a '%s' file", bundleCommitsFile))
+	}
+	var commits []CommitEntry
+	rc, err := cf.Open()
+	if err != nil {
+		return "", 0, newActionError(http.StatusBadRequest, err.Error())
+	}
+	err = json.NewDecoder(io.LimitReader(rc, 16<<20)).Decode(&commits)
+	rc.Close()
+	if err != nil {
+		return "", 0, newActionError(http.StatusBadRequest,
+			fmt.Sprintf("Couldn't read the commit list from the bundle: %v", err))
+	}
+	if len(commits) > MaxBundleCommits {
+		return "", 0, newActionError(http.StatusBadRequest,
+			fmt.Sprintf("Too many commits in the bundle.  The maximum is %d", MaxBundleCommits))
+	}
+
+	// Retrieve the existing branch head and commit history
+	branches, err := GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return "", 0, err
+	}
+	b, ok := branches[branchName]
+	if !ok {
+		return "", 0, newActionError(http.StatusNotFound, fmt.Sprintf("Unknown branch '%s'", branchName))
+	}
+	commitList, err := GetCommitList(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Skip over any commits which are already in the branch history, and make sure the rest form a chain from the
+	// current branch head
+	commits, err = bundleCommitChain(commits, branchName, b.Commit, commitList)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(commits) == 0 {
+		// Nothing new
+		return b.Commit, 0, nil
+	}
+	for _, c := range commits {
+		if lic := c.Tree.Entries[0].LicenceSHA; lic != "" {
+			_, _, err = GetLicenceInfoFromSha256(loggedInUser, lic)
+			if err != nil {
+				return "", 0, newActionError(http.StatusBadRequest,
+					fmt.Sprintf("Unknown licence for commit '%s'", c.ID))
+			}
+		}
+	}
+
+	// Retrieve the data validation rules for the database, which the new database files are checked against
+	rules, err := GetValidationRules(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Database files which are already in the history of this database can be left out of the bundle.  Files from
+	// anywhere else on the server can't, as they could be from other people's private databases
+	histFiles := make(map[string]DBTreeEntry)
+	for _, c := range commitList {
+		for _, e := range c.Tree.Entries {
+			if e.EntryType == DATABASE {
+				histFiles[e.Sha256] = e
+			}
+		}
+	}
+
+	// Store the database files included in the bundle, and check the ones which aren't against the validation rules
+	type fileInfo struct {
+		failures []ValidationFailure
+		stats    *DBStats
+	}
+	stored := make(map[string]fileInfo)
+	for i, c := range commits {
+		e := &commits[i].Tree.Entries[0]
+		if info, ok := stored[e.Sha256]; ok {
+			e.Stats = info.stats
+			commits[i].ValidationFailures = info.failures
+			continue
+		}
+		var info fileInfo
+		f, ok := files[e.Sha256]
+		if ok {
+			info.stats, info.failures, err = storeBundleFile(f, e.Sha256, e.Size, rules)
+			if err != nil {
+				return "", 0, err
+			}
+			var ipAddr, userAgent string
+			if r != nil {
+				ipAddr = r.RemoteAddr
+				userAgent = r.UserAgent()
+			}
+			err = LogUpload(dbOwner, dbFolder, dbName, loggedInUser, ipAddr, "db4s-bundle", userAgent,
+				time.Now().UTC(), e.Sha256)
+			if err != nil {
+				return "", 0, err
+			}
+		} else {
+			prev, ok := histFiles[e.Sha256]
+			if !ok || prev.Size != e.Size {
+				return "", 0, newActionError(http.StatusBadRequest,
+					fmt.Sprintf("Database file '%s' for commit '%s' is missing from the bundle", e.Sha256, c.ID))
+			}
+			info.stats = prev.Stats
+			info.failures, err = checkStoredFileRules(e.Sha256, rules)
+			if err != nil {
+				return "", 0, err
+			}
+		}
+		stored[e.Sha256] = info
+		e.Stats = info.stats
+		commits[i].ValidationFailures = info.failures
+	}
+
+	// Add the commits to the commit history, and move the branch head.  If another push moved the branch while this
+	// one was being checked, or a failed upload of the same file removed one of the database files in the meantime,
+	// nothing is stored and this one is rejected
+	newCommits := make(map[string]CommitEntry)
+	for _, c := range commits {
+		newCommits[c.ID] = c
+	}
+	head = commits[len(commits)-1].ID
+	oldHead := b.Commit
+	b.Commit = head
+	b.CommitCount += len(commits)
+	err = UpdateBranchHead(dbOwner, dbFolder, dbName, branchName, oldHead, b, newCommits)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// If the default branch was updated, check the default table is still present in the new head.  The push has
+	// already been stored by this point, so failures here are only logged rather than returned to the client
+	defBranch, err := GetDefaultBranchName(dbOwner, dbFolder, dbName)
+	if err == nil && branchName == defBranch {
+		err = checkDefaultTable(dbOwner, dbFolder, dbName, commits[len(commits)-1].Tree.Entries[0].Sha256)
+	}
+	if err != nil {
+		log.Printf("Error when checking the default table after a bundle push to '%s%s%s': %v\n", dbOwner,
+			dbFolder, dbName, err)
+	}
+
+	// Invalidate the memcache data for the database
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return head, len(commits), nil
+}
+
+// Copies a database file from the storage back end into a bundle
+func addBundleFile(z *zip.Writer, sha string) error {
+	obj, err := MinioHandle(sha[:MinioFolderChars], sha[MinioFolderChars:])
+	if err != nil {
+		return err
+	}
+	defer MinioHandleClose(obj)
+	f, err := z.Create(sha)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, obj)
+	return err
+}
+
+// Drops any commits at the start of a bundle which are already in the history of the branch being pushed to, then
+// checks the remaining commits are valid and form a chain following on from the branch head.  Returns the commits
+// which need adding.
+func bundleCommitChain(commits []CommitEntry, branchName string, branchHead string,
+	commitList map[string]CommitEntry) ([]CommitEntry, error) {
+	history := make(map[string]bool)
+	for cid := branchHead; cid != ""; cid = commitList[cid].Parent {
+		if _, ok := commitList[cid]; !ok {
+			return nil, fmt.Errorf("Broken commit history for branch '%s'", branchName)
+		}
+		history[cid] = true
+	}
+	for len(commits) > 0 && history[commits[0].ID] {
+		commits = commits[1:]
+	}
+
+	known := make(map[string]bool)
+	for i, c := range commits {
+		if i == 0 && c.Parent != branchHead {
+			return nil, newActionError(http.StatusConflict, fmt.Sprintf("The pushed commits don't follow on "+
+				"from the head of branch '%s'.  Pull the latest changes first.", branchName))
+		}
+		if i > 0 && c.Parent != commits[i-1].ID {
+			return nil, newActionError(http.StatusBadRequest,
+				fmt.Sprintf("Commit '%s' doesn't follow on from the commit before it in the bundle", c.ID))
+		}
+		for _, p := range c.OtherParents {
+			if _, ok := commitList[p]; !ok && !known[p] {
+				return nil, newActionError(http.StatusBadRequest,
+					fmt.Sprintf("Unknown parent commit '%s' for commit '%s'", p, c.ID))
+			}
+		}
+		if len(c.Tree.Entries) != 1 || c.Tree.Entries[0].EntryType != DATABASE {
+			return nil, newActionError(http.StatusBadRequest,
+				fmt.Sprintf("Commit '%s' needs to contain exactly one database", c.ID))
+		}
+		if CreateDBTreeID(c.Tree.Entries) != c.Tree.ID {
+			return nil, newActionError(http.StatusBadRequest,
+				fmt.Sprintf("Tree ID for commit '%s' doesn't match its contents", c.ID))
+		}
+		if CreateCommitID(c) != c.ID {
+			return nil, newActionError(http.StatusBadRequest,
+				fmt.Sprintf("Commit ID '%s' doesn't match the commit contents", c.ID))
+		}
+		if _, ok := commitList[c.ID]; ok {
+			return nil, newActionError(http.StatusConflict,
+				fmt.Sprintf("Commit '%s' already exists on a different branch", c.ID))
+		}
+		known[c.ID] = true
+	}
+	return commits, nil
+}
+
+// Clears the default table for a database if it isn't present in the given database file
+func checkDefaultTable(dbOwner string, dbFolder string, dbName string, sha string) error {
+	defTbl, err := GetDefaultTableName(dbOwner, dbFolder, dbName)
+	if err != nil || defTbl == "" {
+		return err
+	}
+	sdb, err := OpenMinioObject(sha[:MinioFolderChars], sha[MinioFolderChars:])
+	if err != nil {
+		return err
+	}
+	defer sdb.Close()
+	tbls, err := Tables(sdb, dbName)
+	if err != nil {
+		return err
+	}
+	for _, j := range tbls {
+		if j == defTbl {
+			return nil
+		}
+	}
+	return StoreDefaultTableName(dbOwner, dbFolder, dbName, "")
+}
+
+// Checks a database file already in the storage back end against the data validation rules for a database.  Returns
+// any (non rejecting) validation rule failures.
+func checkStoredFileRules(sha string, rules []ValidationRule) ([]ValidationFailure, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	sdb, err := OpenMinioObject(sha[:MinioFolderChars], sha[MinioFolderChars:])
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+	failures, err := CheckValidationRules(sdb, rules)
+	if err != nil {
+		return nil, err
+	}
+	err = ValidationError(failures)
+	if err != nil {
+		return nil, newActionError(http.StatusBadRequest, err.Error())
+	}
+	return failures, nil
+}
+
+// Checks a database file from a bundle against the details in its commit, then stores it in the storage back end.
+// Returns the statistics for the database, and any (non rejecting) validation rule failures.
+func storeBundleFile(f *zip.File, sha string, size int64, rules []ValidationRule) (stats *DBStats,
+	failures []ValidationFailure, err error) {
+	maxSize := int64(MaxDatabaseSize * 1024 * 1024)
+	if size > maxSize || int64(f.UncompressedSize64) > maxSize {
+		return nil, nil, newActionError(http.StatusBadRequest,
+			fmt.Sprintf("Database file '%s' is larger than the maximum allowed size of %d MB", sha, MaxDatabaseSize))
+	}
+
+	// Extract the database to a temporary file, calculating its SHA256 along the way
+	tempDB, err := ioutil.TempFile(Conf.DiskCache.Directory, "dbhub-bundle-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(tempDB.Name())
+	defer tempDB.Close()
+	rc, err := f.Open()
+	if err != nil {
+		return nil, nil, newActionError(http.StatusBadRequest, err.Error())
+	}
+	s := sha256.New()
+	numBytes, err := io.Copy(io.MultiWriter(tempDB, s), io.LimitReader(rc, maxSize+1))
+	rc.Close()
+	if err != nil {
+		return nil, nil, newActionError(http.StatusBadRequest,
+			fmt.Sprintf("Couldn't extract database file '%s' from the bundle: %v", sha, err))
+	}
+	if hex.EncodeToString(s.Sum(nil)) != sha || numBytes != size {
+		return nil, nil, newActionError(http.StatusBadRequest,
+			fmt.Sprintf("Database file '%s' doesn't match the details in its commit", sha))
+	}
+
+	// Make sure it's a valid SQLite database, and passes the data validation rules
+	_, err = SanityCheck(tempDB.Name())
+	if err != nil {
+		return nil, nil, newActionError(http.StatusBadRequest, err.Error())
+	}
+	failures, err = checkValidationRulesFile(tempDB.Name(), rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = ValidationError(failures)
+	if err != nil {
+		return nil, nil, newActionError(http.StatusBadRequest, err.Error())
+	}
+	st, err := ReadSQLiteStats(tempDB.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Store it
+	_, err = tempDB.Seek(0, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = StoreDatabaseFile(tempDB, sha, numBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	CacheRowCounts(sha, &st)
+	return &st, failures, nil
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the HTTP status of an ActionError, 0 for no error, or -1 for any other error
+func actionErrorStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(ActionError); ok {
+		return e.Status
+	}
+	return -1
+}
+
+// Returns a commit of a single database file, with its tree and commit IDs filled in
+func testCommit(parent string, otherParents []string, msg string) CommitEntry {
+	c := CommitEntry{
+		AuthorEmail:  "test@example.org",
+		AuthorName:   "Test",
+		Message:      msg,
+		OtherParents: otherParents,
+		Parent:       parent,
+		Timestamp:    time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+	sum := sha256.Sum256([]byte(msg))
+	c.Tree.Entries = []DBTreeEntry{{EntryType: DATABASE, Name: "test.sqlite", Sha256: hex.EncodeToString(sum[:]),
+		Size: 1024}}
+	c.Tree.ID = CreateDBTreeID(c.Tree.Entries)
+	c.ID = CreateCommitID(c)
+	return c
+}
+
+// Checks pushed bundles have to be a valid chain of commits following on from the branch head
+func TestBundleCommitChain(t *testing.T) {
+	// The existing history is c1 <- c2 on the branch being pushed to, with d1 on another branch off c2
+	c1 := testCommit("", nil, "c1")
+	c2 := testCommit(c1.ID, nil, "c2")
+	d1 := testCommit(c2.ID, nil, "d1")
+	commitList := map[string]CommitEntry{c1.ID: c1, c2.ID: c2, d1.ID: d1}
+
+	n1 := testCommit(c2.ID, nil, "n1")
+	n2 := testCommit(n1.ID, nil, "n2")
+	fromC1 := testCommit(c1.ID, nil, "from c1")
+	afterN1 := testCommit(n1.ID, nil, "after n1")
+	mergeD1 := testCommit(n1.ID, []string{d1.ID}, "merge d1")
+	mergeN1 := testCommit(n1.ID, []string{n1.ID}, "merge n1")
+	mergeUnknown := testCommit(n1.ID, []string{strings.Repeat("0", 64)}, "merge unknown")
+	badTree := testCommit(c2.ID, nil, "bad tree")
+	badTree.Tree.Entries[0].Size = 2048
+	badID := testCommit(c2.ID, nil, "bad id")
+	badID.Message = "changed"
+	twoFiles := testCommit(c2.ID, nil, "two files")
+	twoFiles.Tree.Entries = append(twoFiles.Tree.Entries, twoFiles.Tree.Entries[0])
+	twoFiles.Tree.ID = CreateDBTreeID(twoFiles.Tree.Entries)
+	twoFiles.ID = CreateCommitID(twoFiles)
+
+	tests := []struct {
+		head    string
+		commits []CommitEntry
+		want    []CommitEntry
+		status  int
+	}{
+		{head: c2.ID, commits: []CommitEntry{n1, n2}, want: []CommitEntry{n1, n2}},
+		{head: c2.ID, commits: []CommitEntry{c1, c2, n1, n2}, want: []CommitEntry{n1, n2}},
+		{head: c2.ID, commits: []CommitEntry{c2}, want: []CommitEntry{}},
+		{head: c2.ID, commits: []CommitEntry{}, want: []CommitEntry{}},
+		{head: c2.ID, commits: []CommitEntry{n1, mergeD1}, want: []CommitEntry{n1, mergeD1}},
+		{head: c2.ID, commits: []CommitEntry{n1, mergeN1}, want: []CommitEntry{n1, mergeN1}},
+		{head: c2.ID, commits: []CommitEntry{n2}, status: http.StatusConflict},
+		{head: c1.ID, commits: []CommitEntry{n1}, status: http.StatusConflict},
+		{head: c2.ID, commits: []CommitEntry{n1, fromC1}, status: http.StatusBadRequest},
+		{head: c2.ID, commits: []CommitEntry{n2, n1}, status: http.StatusConflict},
+		{head: c2.ID, commits: []CommitEntry{n1, n2, afterN1}, status: http.StatusBadRequest},
+		{head: c2.ID, commits: []CommitEntry{n1, mergeUnknown}, status: http.StatusBadRequest},
+		{head: c2.ID, commits: []CommitEntry{badTree}, status: http.StatusBadRequest},
+		{head: c2.ID, commits: []CommitEntry{badID}, status: http.StatusBadRequest},
+		{head: c2.ID, commits: []CommitEntry{twoFiles}, status: http.StatusBadRequest},
+		{head: c2.ID, commits: []CommitEntry{d1}, status: http.StatusConflict},
+		{head: strings.Repeat("1", 64), commits: []CommitEntry{n1}, status: -1},
+	}
+	for i, j := range tests {
+		got, err := bundleCommitChain(j.commits, "main", j.head, commitList)
+		if actionErrorStatus(err) != j.status {
+			t.Errorf("bundleCommitChain() case %d returned error %v, wanted status %d", i, err, j.status)
+			continue
+		}
+		if err == nil && len(got)+len(j.want) > 0 && !reflect.DeepEqual(got, j.want) {
+			t.Errorf("bundleCommitChain() case %d returned %d commits, wanted %d", i, len(got), len(j.want))
+		}
+	}
+}
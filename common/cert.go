@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -14,6 +15,37 @@ import (
 	"time"
 )
 
+// Generates a certificate revocation list for the revoked client certificates, signed by the intermediate certificate
+func GenerateCRL() ([]byte, error) {
+	revoked, err := RevokedClientCerts()
+	if err != nil {
+		return nil, err
+	}
+	var entries []pkix.RevokedCertificate
+	for _, j := range revoked {
+		serial, ok := new(big.Int).SetString(j.Serial, 16)
+		if !ok {
+			log.Printf("Invalid serial number '%s' for revoked client certificate\n", j.Serial)
+			continue
+		}
+		entries = append(entries, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: j.Revoked})
+	}
+
+	// Sign the revocation list
+	intCert, intKey, err := loadIntermediateCert()
+	if err != nil {
+		log.Printf("Error when generating CRL: %v\n", err)
+		return nil, err
+	}
+	nowTime := time.Now()
+	crl, err := intCert.CreateCRL(rand.Reader, intKey, entries, nowTime, nowTime.Add(24*time.Hour))
+	if err != nil {
+		log.Printf("Error when generating CRL: %v\n", err)
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}), nil
+}
+
 func GenerateClientCert(userName string) (_ []byte, err error) {
 	pageName := "Add user:generateClientCert()"
 
@@ -41,37 +73,10 @@ func GenerateClientCert(userName string) (_ []byte, err error) {
 		return nil, err
 	}
 
-	// Load the certificate used for signing (the intermediate certificate)
-	certFile, err := ioutil.ReadFile(Conf.Sign.IntermediateCert)
-	if err != nil {
-		log.Printf("%s: Error opening intermediate certificate file: %v\n", pageName, err)
-		return
-	}
-	certPEM, _ := pem.Decode(certFile)
-	if certPEM == nil {
-		log.Printf("%s: Error when PEM decoding the intermediate certificate file\n", pageName)
-		return
-	}
-	intCert, err := x509.ParseCertificate(certPEM.Bytes)
-	if err != nil {
-		log.Printf("%s: Error when parsing decoded intermediate certificate data: %v\n", pageName, err)
-		return
-	}
-
-	// Load the private key for the intermediate certificate
-	intKeyFile, err := ioutil.ReadFile(Conf.Sign.IntermediateKey)
+	// Load the certificate (and its key) used for signing
+	intCert, intKey, err := loadIntermediateCert()
 	if err != nil {
-		log.Printf("%s: Error opening intermediate certificate key: %v\n", pageName, err)
-		return
-	}
-	intKeyPEM, _ := pem.Decode(intKeyFile)
-	if certPEM == nil {
-		log.Printf("%s: Error when PEM decoding the intermediate key file\n", pageName)
-		return
-	}
-	intKey, err := x509.ParsePKCS1PrivateKey(intKeyPEM.Bytes)
-	if err != nil {
-		log.Printf("%s: Error when parsing intermediate certificate key: %v\n", pageName, err)
+		log.Printf("%s: %v\n", pageName, err)
 		return
 	}
 
@@ -116,3 +121,66 @@ func GenerateClientCert(userName string) (_ []byte, err error) {
 
 	return buf.Bytes(), nil
 }
+
+// Generates a new client certificate for a user, and records it under the given name so it can be revoked later
+func NewClientCert(userName string, certName string) ([]byte, error) {
+	newCert, err := GenerateClientCert(userName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record the serial number and expiry date of the new certificate
+	serial, expires, err := clientCertDetails(newCert)
+	if err != nil {
+		return nil, err
+	}
+	err = StoreClientCertDetails(userName, certName, serial, expires)
+	if err != nil {
+		return nil, err
+	}
+	return newCert, nil
+}
+
+// Returns the serial number (as hex) and expiry date of a PEM encoded client certificate
+func clientCertDetails(cert []byte) (serial string, expires time.Time, err error) {
+	certPEM, _ := pem.Decode(cert)
+	if certPEM == nil {
+		return "", time.Time{}, errors.New("Error when PEM decoding the client certificate")
+	}
+	c, err := x509.ParseCertificate(certPEM.Bytes)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return c.SerialNumber.Text(16), c.NotAfter, nil
+}
+
+// Loads the intermediate certificate and its private key, used for signing client certificates and the CRL
+func loadIntermediateCert() (intCert *x509.Certificate, intKey *rsa.PrivateKey, err error) {
+	certFile, err := ioutil.ReadFile(Conf.Sign.IntermediateCert)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error opening intermediate certificate file: %v", err)
+	}
+	certPEM, _ := pem.Decode(certFile)
+	if certPEM == nil {
+		return nil, nil, errors.New("Error when PEM decoding the intermediate certificate file")
+	}
+	intCert, err = x509.ParseCertificate(certPEM.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error when parsing decoded intermediate certificate data: %v", err)
+	}
+
+	// Load the private key for the intermediate certificate
+	intKeyFile, err := ioutil.ReadFile(Conf.Sign.IntermediateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error opening intermediate certificate key: %v", err)
+	}
+	intKeyPEM, _ := pem.Decode(intKeyFile)
+	if intKeyPEM == nil {
+		return nil, nil, errors.New("Error when PEM decoding the intermediate key file")
+	}
+	intKey, err = x509.ParsePKCS1PrivateKey(intKeyPEM.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error when parsing intermediate certificate key: %v", err)
+	}
+	return intCert, intKey, nil
+}
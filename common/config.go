@@ -86,18 +86,38 @@ func ReadConfig() error {
 		Conf.Pg.Database = tempString
 	}
 
+	tempString = os.Getenv("STORAGE_BACKEND")
+	if tempString != "" {
+		Conf.Storage.Backend = tempString
+	}
+
+	// Warn if the storage back end isn't set in the config file
+	if Conf.Storage.Backend == "" {
+		log.Printf("WARN: Storage back end isn't set in the config file. Defaulting to Minio.")
+		Conf.Storage.Backend = "minio"
+	}
+
 	// Verify we have the needed configuration information
 	// Note - We don't check for a valid Conf.Pg.Password here, as the PostgreSQL password can also be kept
 	// in a .pgpass file as per https://www.postgresql.org/docs/current/static/libpq-pgpass.html
 	var missingConfig []string
-	if Conf.Minio.Server == "" {
-		missingConfig = append(missingConfig, "Minio server:port string")
-	}
-	if Conf.Minio.AccessKey == "" && Conf.Environment.Environment != "docker" {
-		missingConfig = append(missingConfig, "Minio access key string")
-	}
-	if Conf.Minio.Secret == "" && Conf.Environment.Environment != "docker" {
-		missingConfig = append(missingConfig, "Minio secret string")
+	switch Conf.Storage.Backend {
+	case "minio":
+		if Conf.Minio.Server == "" {
+			missingConfig = append(missingConfig, "Minio server:port string")
+		}
+		if Conf.Minio.AccessKey == "" && Conf.Environment.Environment != "docker" {
+			missingConfig = append(missingConfig, "Minio access key string")
+		}
+		if Conf.Minio.Secret == "" && Conf.Environment.Environment != "docker" {
+			missingConfig = append(missingConfig, "Minio secret string")
+		}
+	case "local":
+		if Conf.Storage.Directory == "" {
+			missingConfig = append(missingConfig, "Local storage directory")
+		}
+	default:
+		missingConfig = append(missingConfig, "Storage back end (\"minio\" or \"local\")")
 	}
 	if Conf.Pg.Server == "" {
 		missingConfig = append(missingConfig, "PostgreSQL server string")
@@ -156,6 +176,25 @@ func ReadConfig() error {
 		Conf.Event.EmailQueueDir = "/tmp"
 	}
 
+	// Warn if the source URL mirroring interval isn't set in the config file
+	if Conf.Mirror.Interval == 0 {
+		log.Printf("WARN: Source URL mirroring interval isn't set in the config file. Defaulting to 1 hour.")
+		Conf.Mirror.Interval = 3600
+	}
+
+	// Warn if the fork sync interval isn't set in the config file
+	if Conf.ForkSync.Interval == 0 {
+		log.Printf("WARN: Fork sync interval isn't set in the config file. Defaulting to 1 hour.")
+		Conf.ForkSync.Interval = 3600
+	}
+
+	// Warn if the schema migrations directory isn't set in the config file
+	if Conf.Pg.MigrationsDir == "" {
+		Conf.Pg.MigrationsDir = filepath.Join(Conf.Web.BaseDir, "database", "migrations")
+		log.Printf("WARN: PostgreSQL migrations directory isn't set in the config file. Defaulting to '%s'.",
+			Conf.Pg.MigrationsDir)
+	}
+
 	// Set the PostgreSQL configuration values
 	pgConfig.Host = Conf.Pg.Server
 	pgConfig.Port = uint16(Conf.Pg.Port)
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Wraps a http.ResponseWriter, keeping track of the status code and number of bytes sent
+type CountingWriter struct {
+	http.ResponseWriter
+	bytes  int64
+	status int
+}
+
+// Returns a CountingWriter wrapping a http.ResponseWriter
+func NewCountingWriter(w http.ResponseWriter) *CountingWriter {
+	return &CountingWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Returns the status code sent, which is http.StatusOK if none was set explicitly
+func (c *CountingWriter) Status() int {
+	return c.status
+}
+
+func (c *CountingWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	c.bytes += int64(n)
+	return n, err
+}
+
+func (c *CountingWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+// Sends a database file to the client.  Database files are named by their SHA256, so they get a strong ETag, and
+// conditional (If-None-Match, If-Modified-Since) and range requests are handled by http.ServeContent.  The file is
+// read from the disk cache when it's there, otherwise from the storage back end.  The caller should set the
+// Content-Disposition and Content-Type headers first.
+//
+// Returns the number of bytes sent, and whether the request was for the start of the file.  Cache revalidations and
+// ranges part way through the file (eg from SQLite range readers) shouldn't be counted as new downloads.
+func ServeDatabase(w http.ResponseWriter, r *http.Request, bucket string, id string,
+	lastMod time.Time) (bytesWritten int64, newDownload bool, err error) {
+	// Use the copy in the disk cache if there is one
+	var userDB StorageObject
+	f, err := os.Open(filepath.Join(Conf.DiskCache.Directory, bucket, id))
+	if err == nil {
+		userDB = localObject{f}
+	} else {
+		userDB, err = MinioHandle(bucket, id)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	defer MinioHandleClose(userDB)
+
+	// Send the file
+	cw := NewCountingWriter(w)
+	cw.Header().Set("Accept-Ranges", "bytes")
+	cw.Header().Set("ETag", fmt.Sprintf(`"%s%s"`, bucket, id))
+	http.ServeContent(cw, r, "", lastMod, userDB)
+
+	// Work out if this counts as a new download
+	rng := r.Header.Get("Range")
+	newDownload = r.Method != http.MethodHead && (cw.status == http.StatusOK ||
+		(cw.status == http.StatusPartialContent && strings.HasPrefix(rng, "bytes=0-")))
+	return cw.bytes, newDownload, nil
+}
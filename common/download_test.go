@@ -0,0 +1,89 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Checks database downloads answer conditional and range requests, and only count requests for the start of the file as
+// new downloads
+func TestServeDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbhub-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldCache := Conf.DiskCache.Directory
+	Conf.DiskCache.Directory = dir
+	defer func() { Conf.DiskCache.Directory = oldCache }()
+
+	// Put a fake database file in the disk cache, so the storage back end isn't needed
+	bucket, id := "bucket", "abcdef"
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	err = os.MkdirAll(filepath.Join(dir, bucket), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, bucket, id), data, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastMod := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	etag := `"bucketabcdef"`
+
+	tests := []struct {
+		method  string
+		headers map[string]string
+		status  int
+		body    string
+		newDown bool
+	}{
+		{method: "GET", status: http.StatusOK, body: string(data), newDown: true},
+		{method: "HEAD", status: http.StatusOK, newDown: false},
+		{method: "GET", headers: map[string]string{"Range": "bytes=0-9"}, status: http.StatusPartialContent,
+			body: "0123456789", newDown: true},
+		{method: "GET", headers: map[string]string{"Range": "bytes=95-"}, status: http.StatusPartialContent,
+			body: "56789", newDown: false},
+		{method: "GET", headers: map[string]string{"Range": "bytes=200-"},
+			status: http.StatusRequestedRangeNotSatisfiable, newDown: false},
+		{method: "GET", headers: map[string]string{"If-None-Match": etag}, status: http.StatusNotModified,
+			newDown: false},
+		{method: "GET", headers: map[string]string{"If-None-Match": `"bucketother"`}, status: http.StatusOK,
+			body: string(data), newDown: true},
+		{method: "GET", headers: map[string]string{"If-Modified-Since": lastMod.Format(http.TimeFormat)},
+			status: http.StatusNotModified, newDown: false},
+		{method: "GET", headers: map[string]string{"Range": "bytes=0-9", "If-Range": `"bucketother"`},
+			status: http.StatusOK, body: string(data), newDown: true},
+	}
+	for _, j := range tests {
+		r := httptest.NewRequest(j.method, "/x", nil)
+		for k, v := range j.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		n, newDown, err := ServeDatabase(w, r, bucket, id, lastMod)
+		if err != nil {
+			t.Fatalf("ServeDatabase(%s %v) returned error: %v", j.method, j.headers, err)
+		}
+		if w.Code != j.status || newDown != j.newDown {
+			t.Errorf("ServeDatabase(%s %v) gave status %d and new download %v, wanted %d and %v", j.method,
+				j.headers, w.Code, newDown, j.status, j.newDown)
+		}
+		if j.status == http.StatusOK || j.status == http.StatusPartialContent {
+			if w.Body.String() != j.body || n != int64(len(j.body)) {
+				t.Errorf("ServeDatabase(%s %v) sent %q (%d bytes counted), wanted %q", j.method, j.headers,
+					w.Body.String(), n, j.body)
+			}
+		}
+		if j.status != http.StatusRequestedRangeNotSatisfiable && w.Header().Get("ETag") != etag {
+			t.Errorf("ServeDatabase(%s %v) sent ETag %q, wanted %q", j.method, j.headers, w.Header().Get("ETag"),
+				etag)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Keeps forks in step with the database they were forked from (their upstream).  Fork branches which haven't diverged
+// are fast-forwarded to the head of the same branch upstream, while diverged branches get a discussion opened in the
+// fork proposing the upstream changes.
+
+// Background worker which periodically syncs the forks that have automatic syncing turned on
+func ForkSyncWorker() {
+	log.Printf("Fork sync loop started.  %d second refresh.\n", Conf.ForkSync.Interval)
+	for {
+		dbList, err := SyncedForks()
+		if err == nil {
+			for _, db := range dbList {
+				branches, err := GetBranches(db.Owner, db.Folder, db.DBName)
+				if err != nil {
+					continue
+				}
+				for bName := range branches {
+					// Expected problems (eg branches which don't exist upstream) are skipped rather than logged
+					_, err = SyncFork(db.Owner, db.Owner, db.Folder, db.DBName, bName)
+					if _, ok := err.(ActionError); err != nil && !ok {
+						log.Printf("Error when syncing branch '%s' of fork '%s%s%s': %v\n", bName, db.Owner,
+							db.Folder, db.DBName, err)
+					}
+				}
+			}
+		}
+
+		// Wait before running the loop again
+		time.Sleep(Conf.ForkSync.Interval * time.Second)
+	}
+}
+
+// Returns how many commits a branch of a fork is ahead of, and behind, the same branch of its upstream database
+func ForkStatus(loggedInUser string, dbOwner string, dbFolder string, dbName string,
+	branchName string) (status ForkSyncStatus, err error) {
+	status, _, err = forkStatus(loggedInUser, dbOwner, dbFolder, dbName, branchName)
+	return
+}
+
+// Does the work for ForkStatus, also returning the IDs of the upstream commits which aren't in the fork branch
+func forkStatus(loggedInUser string, dbOwner string, dbFolder string, dbName string,
+	branchName string) (status ForkSyncStatus, behind []string, err error) {
+	status.Branch = branchName
+	status.UpstreamOwner, status.UpstreamFolder, status.UpstreamDBName, err = ForkParent(loggedInUser, dbOwner,
+		dbFolder, dbName)
+	if err != nil {
+		return
+	}
+	if status.UpstreamOwner == "" {
+		err = newActionError(http.StatusBadRequest, "This database isn't a fork of another (available) database")
+		return
+	}
+
+	// Make sure the upstream database is accessible to the user
+	exists, err := CheckDBExists(loggedInUser, status.UpstreamOwner, status.UpstreamFolder, status.UpstreamDBName)
+	if err != nil {
+		return
+	}
+	if !exists {
+		err = newActionError(http.StatusNotFound, "The upstream database isn't available")
+		return
+	}
+
+	// Retrieve the head commits of the branch in both databases
+	forkBranches, err := GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return
+	}
+	forkHead, ok := forkBranches[branchName]
+	if !ok {
+		err = newActionError(http.StatusNotFound, "Unknown branch name")
+		return
+	}
+	upstreamBranches, err := GetBranches(status.UpstreamOwner, status.UpstreamFolder, status.UpstreamDBName)
+	if err != nil {
+		return
+	}
+	upstreamHead, ok := upstreamBranches[branchName]
+	if !ok {
+		err = newActionError(http.StatusNotFound,
+			fmt.Sprintf("The upstream database doesn't have a branch named '%s'", branchName))
+		return
+	}
+
+	// Count the commits only present on one side
+	ahead, behind, err := commitHistoryDiff(dbOwner, dbFolder, dbName, forkHead.Commit, status.UpstreamOwner,
+		status.UpstreamFolder, status.UpstreamDBName, upstreamHead.Commit)
+	if err != nil {
+		return
+	}
+	status.Ahead = len(ahead)
+	status.Behind = len(behind)
+
+	// Retrieve the tags which exist upstream but not in the fork
+	status.MissingTags, err = MissingTags(dbOwner, dbFolder, dbName, status.UpstreamOwner, status.UpstreamFolder,
+		status.UpstreamDBName)
+	return
+}
+
+// Returns the names of the tags in one database (usually the upstream of a fork) which don't exist in another
+func MissingTags(dbOwner string, dbFolder string, dbName string, otherOwner string, otherFolder string,
+	otherDBName string) (missing []string, err error) {
+	tags, err := GetTags(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return
+	}
+	otherTags, err := GetTags(otherOwner, otherFolder, otherDBName)
+	if err != nil {
+		return
+	}
+	missing = []string{}
+	for name := range otherTags {
+		if _, ok := tags[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return
+}
+
+// Brings a branch of a fork up to date with the same branch of its upstream database.  If the fork branch has no
+// commits of its own it's fast-forwarded to the upstream head, otherwise a discussion is opened in the fork proposing
+// the upstream changes
+func SyncFork(loggedInUser string, dbOwner string, dbFolder string, dbName string,
+	branchName string) (status ForkSyncStatus, err error) {
+	// Make sure the database owner matches the logged in user
+	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
+		err = newActionError(http.StatusUnauthorized, "You can't change databases you don't own")
+		return
+	}
+
+	status, behind, err := forkStatus(loggedInUser, dbOwner, dbFolder, dbName, branchName)
+	if err != nil {
+		return
+	}
+	if status.Behind == 0 {
+		status.Result = FORK_UP_TO_DATE
+		return
+	}
+
+	// If the fork branch head is in the history of the upstream branch, we can fast-forward
+	if status.Ahead == 0 {
+		var ancestorID string
+		var newCommits []CommitEntry
+		ancestorID, newCommits, err, _ = GetCommonAncestorCommits(status.UpstreamOwner, status.UpstreamFolder,
+			status.UpstreamDBName, branchName, dbOwner, dbFolder, dbName, branchName)
+		if err != nil {
+			return
+		}
+		if ancestorID != "" {
+			err = fastForwardFork(loggedInUser, dbOwner, dbFolder, dbName, branchName, ancestorID, status,
+				newCommits, behind)
+			if err != nil {
+				return
+			}
+			status.Behind = 0
+			status.Result = FORK_FAST_FORWARDED
+			return
+		}
+	}
+
+	// The fork has diverged, so propose the upstream changes instead
+	status.DiscID, err = proposeUpstreamChanges(loggedInUser, dbOwner, dbFolder, dbName, status)
+	if err != nil {
+		return
+	}
+	status.Result = FORK_DIVERGED
+	return
+}
+
+// Copies the upstream commits into a fork, then moves the fork branch head to the upstream branch head.  The behind
+// list holds the IDs of all the upstream commits missing from the fork branch, including any brought in by merges.
+func fastForwardFork(loggedInUser string, dbOwner string, dbFolder string, dbName string, branchName string,
+	oldHead string, status ForkSyncStatus, newCommits []CommitEntry, behind []string) error {
+	addList := make(map[string]CommitEntry)
+	for _, c := range newCommits {
+		addList[c.ID] = c
+	}
+
+	// Merge commits can bring in history from other upstream branches, which needs copying too
+	var merged []string
+	for _, id := range behind {
+		if _, ok := addList[id]; !ok {
+			merged = append(merged, id)
+		}
+	}
+	if len(merged) > 0 {
+		mergedCommits, err := commitsByID(status.UpstreamOwner, status.UpstreamFolder, status.UpstreamDBName,
+			merged)
+		if err != nil {
+			return err
+		}
+		for id, c := range mergedCommits {
+			addList[id] = c
+		}
+	}
+
+	// Store the new commits and move the fork branch head, as long as the branch hasn't moved while we were working
+	branches, err := GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+	b, ok := branches[branchName]
+	if !ok || b.Commit != oldHead {
+		return newActionError(http.StatusConflict, "The branch changed while it was being synced.  Please try again.")
+	}
+	b.Commit = newCommits[0].ID
+	b.CommitCount += len(newCommits)
+	err = UpdateBranchHead(dbOwner, dbFolder, dbName, branchName, oldHead, b, addList)
+	if err != nil {
+		return err
+	}
+
+	// Invalidate the memcache data for the database, so the new branch head gets picked up
+	invalidateDBCache(loggedInUser, dbOwner, dbFolder, dbName)
+	return nil
+}
+
+// Opens a discussion in a diverged fork, describing the upstream changes which need bringing in by hand.  If an open
+// proposal for the branch already exists, its ID is returned instead of creating another one
+func proposeUpstreamChanges(loggedInUser string, dbOwner string, dbFolder string, dbName string,
+	status ForkSyncStatus) (int, error) {
+	title := fmt.Sprintf("Upstream changes to branch '%s' of %s%s%s", status.Branch, status.UpstreamOwner,
+		status.UpstreamFolder, status.UpstreamDBName)
+	discList, err := Discussions(dbOwner, dbFolder, dbName, DISCUSSION, 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range discList {
+		if d.Open && d.Title == title {
+			return d.ID, nil
+		}
+	}
+
+	text := fmt.Sprintf("The upstream database [%s%s%s](/%s%s%s) has %d commit(s) on branch '%s' which "+
+		"aren't in this fork, while this fork has %d commit(s) of its own.  As the branches have diverged, they "+
+		"can't be synced automatically.\n\nThe upstream changes can be brought in by cherry picking them from "+
+		"the [upstream commit list](/commits/%s%s%s?branch=%s), while the changes in this fork can be offered "+
+		"upstream with a merge request.", status.UpstreamOwner, status.UpstreamFolder, status.UpstreamDBName,
+		status.UpstreamOwner, status.UpstreamFolder, status.UpstreamDBName, status.Behind, status.Branch,
+		status.Ahead, status.UpstreamOwner, status.UpstreamFolder, status.UpstreamDBName, url.QueryEscape(status.Branch))
+	return CreateDiscussion(loggedInUser, dbOwner, dbFolder, dbName, title, text)
+}
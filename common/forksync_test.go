@@ -0,0 +1,85 @@
+package common
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/jackc/pgx"
+)
+
+// Checks the ahead and behind lists for forks follow merges in both databases.  Like TestMigrationsUpgradeBaseline,
+// this needs a PostgreSQL server given in the DBHUB_TEST_PG environment variable, so it's skipped otherwise.
+func TestCommitHistoryDiff(t *testing.T) {
+	uri := os.Getenv("DBHUB_TEST_PG")
+	if uri == "" {
+		t.Skip("DBHUB_TEST_PG isn't set")
+	}
+	cfg, err := pgx.ParseURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := pgx.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	db := loadTestSchema(t, admin, cfg, "dbhub_test_forks", "../database/dbhub.sql")
+	defer db.Close()
+	pdb, err = pgx.NewConnPool(pgx.ConnPoolConfig{ConnConfig: db.config, MaxConnections: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pdb.Close()
+
+	// Upstream has a <- b <- c on its main branch, plus x off b which is merged in by m.  The fork was made at c,
+	// then added f1 and f2, plus y off b which is merged in by fm.
+	_, err = pdb.Exec(`
+		INSERT INTO users (user_id, user_name, auth0_id, client_cert, password_hash)
+		VALUES (1, 'alice', 'alice', '', ''), (2, 'bob', 'bob', '', '');
+		INSERT INTO sqlite_databases (user_id, db_id, folder, db_name, forked_from)
+		VALUES (1, 1, '/', 'test.sqlite', NULL), (2, 2, '/', 'test.sqlite', 1);
+		INSERT INTO database_commits (db_id, commit_id, parent, other_parents, author_name, author_email,
+			commit_timestamp, tree)
+		SELECT db_id, commit_id, parent, other_parents, 'test', 'test@example.org', now(), '{}'
+		FROM (VALUES
+			(1, 'a', '', '{}'::text[]), (1, 'b', 'a', '{}'), (1, 'c', 'b', '{}'), (1, 'x', 'b', '{}'),
+			(1, 'm', 'c', '{x}'),
+			(2, 'a', '', '{}'), (2, 'b', 'a', '{}'), (2, 'c', 'b', '{}'), (2, 'f1', 'c', '{}'), (2, 'f2', 'f1', '{}'),
+			(2, 'y', 'b', '{}'), (2, 'fm', 'f2', '{y}')
+		) AS v (db_id, commit_id, parent, other_parents)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		forkHead     string
+		upstreamHead string
+		ahead        []string
+		behind       []string
+	}{
+		{forkHead: "c", upstreamHead: "c", ahead: nil, behind: nil},
+		{forkHead: "b", upstreamHead: "c", ahead: nil, behind: []string{"c"}},
+		{forkHead: "c", upstreamHead: "m", ahead: nil, behind: []string{"m", "x"}},
+		{forkHead: "b", upstreamHead: "m", ahead: nil, behind: []string{"c", "m", "x"}},
+		{forkHead: "f2", upstreamHead: "c", ahead: []string{"f1", "f2"}, behind: nil},
+		{forkHead: "f2", upstreamHead: "m", ahead: []string{"f1", "f2"}, behind: []string{"m", "x"}},
+		{forkHead: "fm", upstreamHead: "m", ahead: []string{"f1", "f2", "fm", "y"}, behind: []string{"m", "x"}},
+		{forkHead: "y", upstreamHead: "x", ahead: []string{"y"}, behind: []string{"x"}},
+		{forkHead: "unknown", upstreamHead: "c", ahead: nil, behind: []string{"a", "b", "c"}},
+	}
+	for _, j := range tests {
+		ahead, behind, err := commitHistoryDiff("bob", "/", "test.sqlite", j.forkHead, "alice", "/", "test.sqlite",
+			j.upstreamHead)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(ahead)
+		sort.Strings(behind)
+		if !reflect.DeepEqual(ahead, j.ahead) || !reflect.DeepEqual(behind, j.behind) {
+			t.Errorf("commitHistoryDiff(%q, %q) = (%v, %v), wanted (%v, %v)", j.forkHead, j.upstreamHead, ahead,
+				behind, j.ahead, j.behind)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package common
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Lays out the complete commit history of a database as a graph, for drawing the history page.  Commits are given one
+// row each (newest first, but always above their parents), and a lane (column).  Lanes are assigned the same way
+// "git log --graph" does, with each lane waiting for the next commit expected in it.
+
+// Returns the commit graph layout for a database, covering every commit in its commit list
+func GetCommitGraph(dbOwner string, dbFolder string, dbName string) (graph CommitGraph, err error) {
+	commitList, err := GetCommitList(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return
+	}
+	branches, err := GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return
+	}
+	tags, err := GetTags(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return
+	}
+	releases, err := GetReleases(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return
+	}
+
+	// Lay out the commits, then add the branch, tag, and release labels
+	graph, rows := graphLayout(commitList)
+	for name, b := range branches {
+		if row, ok := rows[b.Commit]; ok {
+			graph.Commits[row].Branches = append(graph.Commits[row].Branches, name)
+		}
+	}
+	for name, t := range tags {
+		if row, ok := rows[t.Commit]; ok {
+			graph.Commits[row].Tags = append(graph.Commits[row].Tags, name)
+		}
+	}
+	for name, rel := range releases {
+		if row, ok := rows[rel.Commit]; ok {
+			graph.Commits[row].Releases = append(graph.Commits[row].Releases, name)
+		}
+	}
+	for i := range graph.Commits {
+		sort.Strings(graph.Commits[i].Branches)
+		sort.Strings(graph.Commits[i].Tags)
+		sort.Strings(graph.Commits[i].Releases)
+	}
+	return
+}
+
+// Returns the index of an unused lane, adding a new lane if they're all in use
+func freeLane(lanes *[]string) int {
+	for i, l := range *lanes {
+		if l == "" {
+			return i
+		}
+	}
+	*lanes = append(*lanes, "")
+	return len(*lanes) - 1
+}
+
+// Assigns each commit in a commit list a row and lane, and works out the lanes its edges run down.  Also returns the
+// row of each commit
+func graphLayout(commitList map[string]CommitEntry) (graph CommitGraph, rows map[string]int) {
+	// Sort the commits so children are always before their parents
+	order := graphOrder(commitList)
+
+	graph.Commits = []CommitGraphNode{}
+	rows = make(map[string]int)
+	var lanes []string
+	for row, id := range order {
+		c := commitList[id]
+		rows[id] = row
+
+		// The commit goes in the first lane waiting for it.  Any other lanes waiting for it merge in here, so are
+		// freed up
+		lane := -1
+		for i, l := range lanes {
+			if l == id {
+				if lane == -1 {
+					lane = i
+				} else {
+					lanes[i] = ""
+				}
+			}
+		}
+		if lane == -1 {
+			lane = freeLane(&lanes)
+		}
+
+		// The first parent continues down the lane of the commit, with other parents joining whichever lane is
+		// already waiting for them (or a new one)
+		node := CommitGraphNode{
+			AuthorName: c.AuthorName,
+			Branches:   []string{},
+			Edges:      []CommitGraphEdge{},
+			ID:         id,
+			Lane:       lane,
+			Message:    c.Message,
+			Releases:   []string{},
+			Row:        row,
+			Tags:       []string{},
+			Timestamp:  c.Timestamp,
+		}
+		lanes[lane] = ""
+		if _, ok := commitList[c.Parent]; ok {
+			lanes[lane] = c.Parent
+			node.Edges = append(node.Edges, CommitGraphEdge{Lane: lane, Parent: c.Parent})
+		}
+		for _, p := range c.OtherParents {
+			if _, ok := commitList[p]; !ok {
+				continue
+			}
+			edgeLane := -1
+			for i, l := range lanes {
+				if l == p {
+					edgeLane = i
+					break
+				}
+			}
+			if edgeLane == -1 {
+				edgeLane = freeLane(&lanes)
+				lanes[edgeLane] = p
+			}
+			node.Edges = append(node.Edges, CommitGraphEdge{Lane: edgeLane, Merge: true, Parent: p})
+		}
+		if len(lanes) > graph.Lanes {
+			graph.Lanes = len(lanes)
+		}
+
+		// Drop any unused lanes from the right hand side
+		for len(lanes) > 0 && lanes[len(lanes)-1] == "" {
+			lanes = lanes[:len(lanes)-1]
+		}
+		graph.Commits = append(graph.Commits, node)
+	}
+
+	// Now every commit has a position, fill in where each edge ends
+	for i, node := range graph.Commits {
+		for j, e := range node.Edges {
+			parentRow := rows[e.Parent]
+			graph.Commits[i].Edges[j].ParentLane = graph.Commits[parentRow].Lane
+			graph.Commits[i].Edges[j].ParentRow = parentRow
+		}
+	}
+
+	return
+}
+
+// Returns the IDs of all commits in a commit list, ordered newest first but with every commit before its parents
+func graphOrder(commitList map[string]CommitEntry) (order []string) {
+	// Count the children of each commit
+	children := make(map[string]int)
+	for _, c := range commitList {
+		if _, ok := commitList[c.Parent]; ok {
+			children[c.Parent]++
+		}
+		for _, p := range c.OtherParents {
+			if _, ok := commitList[p]; ok {
+				children[p]++
+			}
+		}
+	}
+
+	// Start with the commits nothing else is built on (eg branch heads), then add each parent once all of its
+	// children have been placed
+	ready := &graphQueue{list: commitList}
+	for id := range commitList {
+		if children[id] == 0 {
+			heap.Push(ready, id)
+		}
+	}
+	for ready.Len() > 0 {
+		id := heap.Pop(ready).(string)
+		order = append(order, id)
+		c := commitList[id]
+		parents := append([]string{c.Parent}, c.OtherParents...)
+		for _, p := range parents {
+			if _, ok := commitList[p]; !ok {
+				continue
+			}
+			children[p]--
+			if children[p] == 0 {
+				heap.Push(ready, p)
+			}
+		}
+	}
+	return
+}
+
+// A priority queue of commit IDs, which returns the newest commit first
+type graphQueue struct {
+	ids  []string
+	list map[string]CommitEntry
+}
+
+func (q graphQueue) Len() int { return len(q.ids) }
+
+func (q graphQueue) Less(i, j int) bool {
+	a, b := q.list[q.ids[i]], q.list[q.ids[j]]
+	if a.Timestamp.Equal(b.Timestamp) {
+		return q.ids[i] > q.ids[j]
+	}
+	return a.Timestamp.After(b.Timestamp)
+}
+
+func (q graphQueue) Swap(i, j int) { q.ids[i], q.ids[j] = q.ids[j], q.ids[i] }
+
+func (q *graphQueue) Push(x interface{}) { q.ids = append(q.ids, x.(string)) }
+
+func (q *graphQueue) Pop() interface{} {
+	id := q.ids[len(q.ids)-1]
+	q.ids = q.ids[:len(q.ids)-1]
+	return id
+}
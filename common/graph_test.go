@@ -0,0 +1,85 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Checks commit graphs put children above their parents, and lay out branches and merges in the expected lanes
+func TestGraphLayout(t *testing.T) {
+	// Each commit is given as "id parent other-parents...", oldest first unless a time (in minutes) is given after
+	// a "@".  The layout rows are "id lane edges...", where each edge is "lane>parent", with a "*" for merges.
+	tests := []struct {
+		name    string
+		commits []string
+		rows    []string
+		lanes   int
+	}{
+		{name: "linear", commits: []string{"a", "b a", "c b"},
+			rows: []string{"c 0 0>b", "b 0 0>a", "a 0"}, lanes: 1},
+		{name: "branch", commits: []string{"a", "b a", "x a"},
+			rows: []string{"x 0 0>a", "b 1 1>a", "a 0"}, lanes: 2},
+		{name: "merge", commits: []string{"a", "b a", "x a", "m b x"},
+			rows: []string{"m 0 0>b 1>x*", "x 1 1>a", "b 0 0>a", "a 0"}, lanes: 2},
+		{name: "merged branch continues", commits: []string{"a", "x a", "b a", "m b x", "y x"},
+			rows: []string{"y 0 0>x", "m 1 1>b 0>x*", "b 1 1>a", "x 0 0>a", "a 0"}, lanes: 2},
+		{name: "child older than parent", commits: []string{"a@5", "b a@1"},
+			rows: []string{"b 0 0>a", "a 0"}, lanes: 1},
+		{name: "same time", commits: []string{"a", "b a@1", "c a@1"},
+			rows: []string{"c 0 0>a", "b 1 1>a", "a 0"}, lanes: 2},
+		{name: "missing parent", commits: []string{"b gone"},
+			rows: []string{"b 0"}, lanes: 1},
+		{name: "unrelated histories", commits: []string{"a", "b"},
+			rows: []string{"b 0", "a 0"}, lanes: 1},
+	}
+	for _, j := range tests {
+		commitList := make(map[string]CommitEntry)
+		for i, line := range j.commits {
+			c := CommitEntry{Timestamp: time.Date(2024, time.January, 1, 0, i, 0, 0, time.UTC)}
+			if at := strings.Index(line, "@"); at != -1 {
+				mins, err := strconv.Atoi(line[at+1:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.Timestamp = time.Date(2024, time.January, 1, 0, mins, 0, 0, time.UTC)
+				line = line[:at]
+			}
+			f := strings.Fields(line)
+			c.ID = f[0]
+			if len(f) > 1 {
+				c.Parent = f[1]
+				c.OtherParents = f[2:]
+			}
+			commitList[c.ID] = c
+		}
+
+		graph, rows := graphLayout(commitList)
+		var got []string
+		for i, node := range graph.Commits {
+			if node.Row != i || rows[node.ID] != i {
+				t.Errorf("%s: commit '%s' is in row %d, but recorded as row %d", j.name, node.ID, i, rows[node.ID])
+			}
+			s := fmt.Sprintf("%s %d", node.ID, node.Lane)
+			for _, e := range node.Edges {
+				s += fmt.Sprintf(" %d>%s", e.Lane, e.Parent)
+				if e.Merge {
+					s += "*"
+				}
+				p := graph.Commits[e.ParentRow]
+				if p.ID != e.Parent || e.ParentLane != p.Lane || e.ParentRow <= i {
+					t.Errorf("%s: edge from '%s' to '%s' ends at row %d lane %d, where commit '%s' is", j.name,
+						node.ID, e.Parent, e.ParentRow, e.ParentLane, p.ID)
+				}
+			}
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, j.rows) || graph.Lanes != j.lanes {
+			t.Errorf("%s: graph layout is %q with %d lanes, wanted %q with %d lanes", j.name, got, graph.Lanes,
+				j.rows, j.lanes)
+		}
+	}
+}
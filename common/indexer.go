@@ -0,0 +1,207 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/gwenn/gosqlite"
+)
+
+// Index creation request for the background index worker
+type indexJob struct {
+	DBPath string
+	Column string
+	Table  string
+}
+
+var (
+	// Queue of pending index creation requests
+	indexQueue = make(chan indexJob, 100)
+
+	// Index creation requests which are queued or being worked on, used to avoid duplicate requests
+	indexPending   = make(map[indexJob]struct{})
+	indexPendingMu sync.Mutex
+
+	// Indexes known to be present in the side-car files
+	indexReady   = make(map[indexJob]struct{})
+	indexReadyMu sync.RWMutex
+)
+
+// Background worker which creates the indexes requested via QueueIndex().  Indexes aren't added to the cached
+// database files themselves (as then they'd no longer match their SHA256), but to a side-car copy of the database
+// which is only used for sorted queries.
+func IndexWorker() {
+	for job := range indexQueue {
+		err := createSideCarIndex(job)
+		if err != nil {
+			log.Printf("Error creating index on column '%s' of table '%s' in '%s': %v\n", job.Column, job.Table,
+				job.DBPath, err)
+		} else {
+			indexReadyMu.Lock()
+			indexReady[job] = struct{}{}
+			indexReadyMu.Unlock()
+		}
+
+		// Remove the job from the pending list, so it can be requested again if it failed
+		indexPendingMu.Lock()
+		delete(indexPending, job)
+		indexPendingMu.Unlock()
+	}
+}
+
+// Returns an open handle to the side-car file for a cached database, if it has an index on the given column.  If the
+// index isn't ready yet, its creation is queued and nil is returned.
+func IndexedConn(sdb *sqlite.Conn, dbTable string, sortCol string) *sqlite.Conn {
+	dbPath := sdb.Filename("main")
+	if dbPath == "" {
+		return nil
+	}
+	job := indexJob{DBPath: dbPath, Column: sortCol, Table: dbTable}
+
+	// If the index isn't known to be ready, check the side-car file in case it was created by an earlier process
+	indexReadyMu.RLock()
+	_, ok := indexReady[job]
+	indexReadyMu.RUnlock()
+	if !ok {
+		if _, err := os.Stat(sideCarPath(dbPath)); err == nil {
+			ok = sideCarHasIndex(job)
+			if ok {
+				indexReadyMu.Lock()
+				indexReady[job] = struct{}{}
+				indexReadyMu.Unlock()
+			}
+		}
+	}
+	if !ok {
+		QueueIndex(sdb, dbTable, sortCol)
+		return nil
+	}
+
+	// Open the side-car file
+	idb, err := sqlite.Open(sideCarPath(dbPath), sqlite.OpenReadWrite|sqlite.OpenFullMutex)
+	if err != nil {
+		log.Printf("Couldn't open index side-car database: %s", err)
+		return nil
+	}
+	err = idb.EnableExtendedResultCodes(true)
+	if err != nil {
+		log.Printf("Couldn't enable extended result codes! Error: %v\n", err.Error())
+	}
+	return idb
+}
+
+// Adds an index creation request to the background worker queue, unless it's already queued
+func QueueIndex(sdb *sqlite.Conn, dbTable string, sortCol string) {
+	job := indexJob{DBPath: sdb.Filename("main"), Column: sortCol, Table: dbTable}
+	if job.DBPath == "" {
+		return
+	}
+
+	indexPendingMu.Lock()
+	defer indexPendingMu.Unlock()
+	if _, ok := indexPending[job]; ok {
+		// This index is already queued
+		return
+	}
+	select {
+	case indexQueue <- job:
+		indexPending[job] = struct{}{}
+	default:
+		// The queue is full, so drop the request.  It'll be requested again the next time the column is sorted on
+		log.Printf("Index queue full, dropping request for column '%s' of table '%s' in '%s'\n", sortCol,
+			dbTable, job.DBPath)
+	}
+}
+
+// Creates the requested index in the side-car file for a cached database, creating the side-car file first if needed
+func createSideCarIndex(job indexJob) error {
+	scPath := sideCarPath(job.DBPath)
+	if _, err := os.Stat(scPath); os.IsNotExist(err) {
+		// Copy the cached database to a temporary file, then rename it into place once it's complete
+		src, err := os.Open(job.DBPath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := os.OpenFile(scPath+".new", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0750)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		dst.Close()
+		if err != nil {
+			os.Remove(scPath + ".new")
+			return err
+		}
+		err = os.Rename(scPath+".new", scPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	idb, err := sqlite.Open(scPath, sqlite.OpenReadWrite|sqlite.OpenFullMutex)
+	if err != nil {
+		return err
+	}
+	defer idb.Close()
+
+	// Use WAL mode for the side-car file, so sorted queries using it aren't blocked while further indexes are added
+	var mode string
+	err = idb.OneValue("PRAGMA journal_mode = WAL", &mode)
+	if err != nil {
+		return err
+	}
+
+	// Make sure we only index tables
+	tb, err := idb.Tables("")
+	if err != nil {
+		return err
+	}
+	isTable := false
+	for _, j := range tb {
+		if j == job.Table {
+			isTable = true
+		}
+	}
+	if !isTable {
+		return errors.New(fmt.Sprintf("'%s' isn't a table", job.Table))
+	}
+
+	// Create the index
+	dbQuery := sqlite.Mprintf("CREATE INDEX IF NOT EXISTS `%w_", job.Table)
+	dbQuery += sqlite.Mprintf("%w_idx`", job.Column)
+	dbQuery += sqlite.Mprintf(" ON `%w`", job.Table)
+	dbQuery += sqlite.Mprintf(" (`%w`)", job.Column)
+	return idb.Exec(dbQuery)
+}
+
+// Checks if the side-car file for a cached database has an index starting with the given column
+func sideCarHasIndex(job indexJob) bool {
+	idb, err := sqlite.Open(sideCarPath(job.DBPath), sqlite.OpenReadOnly)
+	if err != nil {
+		return false
+	}
+	defer idb.Close()
+	idxList, err := idb.Indexes("")
+	if err != nil {
+		return false
+	}
+	for idx, tbl := range idxList {
+		if tbl == job.Table {
+			idxCol, err := idb.IndexColumns("", idx)
+			if err == nil && len(idxCol) > 0 && idxCol[0].Name == job.Column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the path of the side-car file holding the indexes for a cached database
+func sideCarPath(dbPath string) string {
+	return dbPath + ".idx"
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -40,6 +41,26 @@ func CacheData(cacheKey string, cacheData interface{}, cacheSeconds int) error {
 	return nil
 }
 
+// Caches the table row counts gathered when a database file was uploaded, so GetSQLiteRowCount() doesn't need to
+// count them again
+func CacheRowCounts(dbSha string, stats *DBStats) {
+	if stats == nil || len(dbSha) <= MinioFolderChars {
+		return
+	}
+	dbPath := filepath.Join(dbSha[:MinioFolderChars], dbSha[MinioFolderChars:])
+	for tbl, ts := range stats.Tables {
+		cacheKey := RowCountCacheKey(dbPath, tbl, nil)
+		if cacheKey == "" {
+			return
+		}
+		err := CacheData(cacheKey, int(ts.Rows), Conf.Memcache.DefaultCacheTime)
+		if err != nil {
+			log.Printf("Error when caching row count: %v\n", err)
+			return
+		}
+	}
+}
+
 func ConnectCache() error {
 	// Connect to memcached server
 	memCache = memcache.New(Conf.Memcache.Server)
@@ -150,14 +171,11 @@ func InvalidateCacheEntry(loggedInUser string, dbOwner string, dbFolder string,
 	if commitID == "" {
 		// Get the list of all commits for the given database
 		var err error
-		l, err := GetCommitList(dbOwner, dbFolder, dbName) // Get the full commit list
+		l, err := GetCommitIDs(dbOwner, dbFolder, dbName)
 		if err != nil {
 			return err
 		}
-		for i := range l {
-			commitList = append(commitList, i)
-		}
-		commitList = append(commitList, "") // Add "" on the end, to indicate all entries
+		commitList = append(l, "") // Add "" on the end, to indicate all entries
 	} else {
 		// Only one cached commit needs invalidation
 		commitList = append(commitList, commitID)
@@ -226,6 +244,22 @@ func MetadataCacheKey(prefix string, loggedInUser string, dbOwner string, dbFold
 	return hex.EncodeToString(tempArr[:])
 }
 
+// Generate a predictable cache key for the number of rows in a SQLite table.  The cached database files are named after
+// their SHA256, so the key is shared by all commits (and databases) using the same file.  Returns an empty string if
+// caching isn't possible.
+func RowCountCacheKey(dbPath string, dbTable string, filters []WhereClause) string {
+	if memCache == nil || dbPath == "" {
+		return ""
+	}
+	cacheString := fmt.Sprintf("rowcount/%s%s/%s", filepath.Base(filepath.Dir(dbPath)), filepath.Base(dbPath),
+		dbTable)
+	for _, j := range filters {
+		cacheString += fmt.Sprintf("/%q:%q:%q", j.Column, j.Type, j.Value)
+	}
+	tempArr := md5.Sum([]byte(cacheString))
+	return hex.EncodeToString(tempArr[:])
+}
+
 // Increments the view counter in memcached for a database
 func SetUserStatusUpdates(userName string, numUpdates int) error {
 	// Generate the cache key
@@ -247,7 +281,7 @@ func SetUserStatusUpdates(userName string, numUpdates int) error {
 }
 
 // Generate a predictable cache key for SQLite row data
-func TableRowsCacheKey(prefix string, loggedInUser string, dbOwner string, dbFolder string, dbName string, commitID string, dbTable string, rows int) string {
+func TableRowsCacheKey(prefix string, loggedInUser string, dbOwner string, dbFolder string, dbName string, commitID string, dbTable string, rows int, filters []WhereClause) string {
 	var cacheString string
 	if strings.ToLower(loggedInUser) == strings.ToLower(dbOwner) {
 		cacheString = fmt.Sprintf("%s/%s/%s/%s/%s/%s/%d", prefix, strings.ToLower(dbOwner), dbFolder, dbName, commitID,
@@ -257,6 +291,11 @@ func TableRowsCacheKey(prefix string, loggedInUser string, dbOwner string, dbFol
 		cacheString = fmt.Sprintf("%s/pub/%s/%s/%s/%s/%s/%d", prefix, strings.ToLower(dbOwner), dbFolder, dbName,
 			commitID, dbTable, rows)
 	}
+
+	// Filtered requests are cached separately for each set of filter conditions
+	for _, j := range filters {
+		cacheString += fmt.Sprintf("/%q:%q:%q", j.Column, j.Type, j.Value)
+	}
 	tempArr := md5.Sum([]byte(cacheString))
 	return hex.EncodeToString(tempArr[:])
 }
@@ -0,0 +1,199 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Versioned changes to the PostgreSQL schema.  Each migration is a SQL file in the migrations directory, named with
+// its version number then a short description (eg "002_add_something.sql").  Applied migrations are recorded in the
+// schema_migrations table along with a checksum of their file, so changed files and schemas newer than this server
+// knows about can be detected.
+
+// Key for the PostgreSQL advisory lock held while migrations are checked and applied, so the webUI and DB4S servers
+// starting together don't both try to apply them
+const migrationLockID = 4856235
+
+// Filename pattern for migration files
+var migrationFileRE = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.sql$`)
+
+// A single schema migration, read from its file
+type migration struct {
+	Checksum string
+	Name     string
+	SQL      string
+	Version  int
+}
+
+// Checks the PostgreSQL schema against the migration files.  Migrations which haven't been applied yet are applied if
+// apply is true, otherwise they're an error.  An error is also returned if the schema has migrations this server
+// doesn't know about (ie it's newer), or if an applied migration's file has changed since.  Returns the names of the
+// migrations applied.
+func MigrateDatabase(apply bool) (applied []string, err error) {
+	migrations, err := readMigrations(Conf.Pg.MigrationsDir)
+	if err != nil {
+		return
+	}
+
+	// Begin a transaction.  Every pending migration is applied in this transaction, so a failure leaves the schema
+	// as it was
+	tx, err := pdb.Begin()
+	if err != nil {
+		return
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Wait for any other server checking the migrations to finish
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID)
+	if err != nil {
+		log.Printf("Locking the schema migrations table failed: %v\n", err)
+		return
+	}
+	dbQuery := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer NOT NULL PRIMARY KEY,
+			name text NOT NULL,
+			checksum text NOT NULL,
+			applied_on timestamp with time zone DEFAULT now() NOT NULL
+		)`
+	_, err = tx.Exec(dbQuery)
+	if err != nil {
+		log.Printf("Creating the schema migrations table failed: %v\n", err)
+		return
+	}
+
+	// Check the applied migrations against the migration files
+	known := make(map[int]migration)
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	done := make(map[int]bool)
+	rows, err := tx.Query(`SELECT version, name, checksum FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		log.Printf("Retrieving the applied schema migrations failed: %v\n", err)
+		return
+	}
+	for rows.Next() {
+		var version int
+		var name, checksum string
+		err = rows.Scan(&version, &name, &checksum)
+		if err != nil {
+			rows.Close()
+			log.Printf("Retrieving the applied schema migrations failed: %v\n", err)
+			return
+		}
+		m, ok := known[version]
+		if !ok {
+			rows.Close()
+			err = fmt.Errorf("The PostgreSQL schema has migration %d (%s) applied, which this server doesn't "+
+				"know about.  Is this server older than the database schema?", version, name)
+			return
+		}
+		if m.Checksum != checksum {
+			rows.Close()
+			err = fmt.Errorf("The file for schema migration %d (%s) has changed since it was applied", version,
+				name)
+			return
+		}
+		done[version] = true
+	}
+	rows.Close()
+
+	// Work out which migrations still need applying
+	var pending []migration
+	for _, m := range migrations {
+		if !done[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if !apply {
+		err = fmt.Errorf("The PostgreSQL schema has %d migration(s) waiting to be applied, starting with %d "+
+			"(%s).  Run the migrate command, or turn on auto_migrate in the [pg] config section", len(pending),
+			pending[0].Version, pending[0].Name)
+		return
+	}
+
+	// Apply the pending migrations in order
+	for _, m := range pending {
+		_, err = tx.Exec(m.SQL)
+		if err != nil {
+			log.Printf("Applying schema migration %d (%s) failed: %v\n", m.Version, m.Name, err)
+			return nil, err
+		}
+		dbQuery = `
+			INSERT INTO schema_migrations (version, name, checksum)
+			VALUES ($1, $2, $3)`
+		_, err = tx.Exec(dbQuery, m.Version, m.Name, m.Checksum)
+		if err != nil {
+			log.Printf("Recording schema migration %d (%s) failed: %v\n", m.Version, m.Name, err)
+			return nil, err
+		}
+		applied = append(applied, fmt.Sprintf("%03d_%s", m.Version, m.Name))
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range applied {
+		log.Printf("Applied schema migration: %s\n", name)
+	}
+	return
+}
+
+// Reads the migration files from a directory, returning them ordered by version number
+func readMigrations(dir string) (migrations []migration, err error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Printf("Reading the schema migrations directory '%s' failed: %v\n", dir, err)
+		return
+	}
+	seen := make(map[int]string)
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".sql" {
+			continue
+		}
+		match := migrationFileRE.FindStringSubmatch(f.Name())
+		if match == nil {
+			return nil, fmt.Errorf("Schema migration file '%s' isn't named like '001_description.sql'", f.Name())
+		}
+		var m migration
+		m.Version, err = strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[m.Version]; ok {
+			return nil, fmt.Errorf("Schema migration files '%s' and '%s' have the same version number", other,
+				f.Name())
+		}
+		seen[m.Version] = f.Name()
+		m.Name = match[2]
+
+		var data []byte
+		data, err = ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			log.Printf("Reading schema migration file '%s' failed: %v\n", f.Name(), err)
+			return
+		}
+		sum := sha256.Sum256(data)
+		m.Checksum = hex.EncodeToString(sum[:])
+		m.SQL = string(data)
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return
+}
@@ -0,0 +1,178 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx"
+)
+
+// Checks the migration files are numbered from 1 without gaps, and that dbhub.sql records each of them as applied
+func TestMigrationsMatchSchema(t *testing.T) {
+	migrations, err := readMigrations("../database/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("Schema migration %d (%s) should be numbered %d", m.Version, m.Name, i+1)
+		}
+		want = append(want, fmt.Sprintf("%d %s %s", m.Version, m.Name, m.Checksum))
+	}
+
+	schema, err := ioutil.ReadFile("../database/dbhub.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	rowRE := regexp.MustCompile(`\((\d+), '([a-z0-9_]+)', '([0-9a-f]{64})'\)`)
+	for _, row := range rowRE.FindAllStringSubmatch(string(schema), -1) {
+		got = append(got, strings.Join(row[1:], " "))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("The schema_migrations rows in dbhub.sql are %v, wanted %v", got, want)
+	}
+}
+
+// Upgrades a database with the schema from before the migrations were added, then checks it ends up the same as a
+// fresh install from dbhub.sql.  This needs a PostgreSQL server the test can create databases on, given as a URI in
+// the DBHUB_TEST_PG environment variable (eg "postgres://dbhub@localhost/postgres"), so it's skipped otherwise.
+func TestMigrationsUpgradeBaseline(t *testing.T) {
+	uri := os.Getenv("DBHUB_TEST_PG")
+	if uri == "" {
+		t.Skip("DBHUB_TEST_PG isn't set")
+	}
+	cfg, err := pgx.ParseURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := pgx.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	// Create the databases to compare
+	upgraded := loadTestSchema(t, admin, cfg, "dbhub_test_upgraded", "testdata/dbhub_baseline.sql")
+	fresh := loadTestSchema(t, admin, cfg, "dbhub_test_fresh", "../database/dbhub.sql")
+	defer upgraded.Close()
+	defer fresh.Close()
+
+	// Upgrade the old one, then make sure nothing is left waiting
+	pdb, err = pgx.NewConnPool(pgx.ConnPoolConfig{ConnConfig: upgraded.config, MaxConnections: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pdb.Close()
+	Conf.Pg.MigrationsDir = "../database/migrations"
+	_, err = MigrateDatabase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = MigrateDatabase(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare the tables, sequences, indexes, constraints, and applied migrations of both
+	queries := []string{`
+		SELECT table_name || '.' || column_name || ' ' || data_type || ' ' || is_nullable || ' ' ||
+			COALESCE(column_default, '')
+		FROM information_schema.columns
+		WHERE table_schema = 'public'`, `
+		SELECT sequence_name
+		FROM information_schema.sequences
+		WHERE sequence_schema = 'public'`, `
+		SELECT indexdef
+		FROM pg_indexes
+		WHERE schemaname = 'public'`, `
+		SELECT conrelid::regclass || ' ' || conname || ' ' || pg_get_constraintdef(oid)
+		FROM pg_constraint
+		WHERE connamespace = 'public'::regnamespace`, `
+		SELECT version || ' ' || name || ' ' || checksum
+		FROM schema_migrations`,
+	}
+	for _, q := range queries {
+		want := testSchemaRows(t, fresh.Conn, q)
+		got := testSchemaRows(t, upgraded.Conn, q)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("The upgraded schema doesn't match dbhub.sql.\nQuery: %s\nUpgraded: %v\nFresh: %v", q, got,
+				want)
+		}
+	}
+}
+
+// A scratch database created for a test, which is dropped again when closed
+type testDatabase struct {
+	*pgx.Conn
+	admin  *pgx.Conn
+	config pgx.ConnConfig
+}
+
+func (d testDatabase) Close() {
+	d.Conn.Close()
+	d.admin.Exec(`DROP DATABASE IF EXISTS ` + d.config.Database)
+}
+
+// Creates a scratch database, and loads a schema file into it
+func loadTestSchema(t *testing.T, admin *pgx.Conn, cfg pgx.ConnConfig, name string, file string) testDatabase {
+	_, err := admin.Exec(`DROP DATABASE IF EXISTS ` + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = admin.Exec(`CREATE DATABASE ` + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database = name
+	conn, err := pgx.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The plpgsql extension is always there already, and commenting on it needs a superuser, so those are skipped
+	var lines []string
+	for _, l := range strings.Split(string(schema), "\n") {
+		if !strings.HasPrefix(l, "CREATE EXTENSION") && !strings.HasPrefix(l, "COMMENT ON EXTENSION") {
+			lines = append(lines, l)
+		}
+	}
+	_, err = conn.Exec(strings.Join(lines, "\n"))
+	if err != nil {
+		t.Fatalf("Loading '%s' failed: %v", file, err)
+	}
+	return testDatabase{Conn: conn, admin: admin, config: cfg}
+}
+
+// Returns the sorted results of a query returning a single text column
+func testSchemaRows(t *testing.T, conn *pgx.Conn, query string) (list []string) {
+	rows, err := conn.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		err = rows.Scan(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, s)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(list)
+	return
+}
@@ -32,19 +32,102 @@ func ConnectMinio() (err error) {
 	return nil
 }
 
-// Get a handle from Minio for a SQLite database object.
-func MinioHandle(bucket string, id string) (*minio.Object, error) {
-	userDB, err := minioClient.GetObject(bucket, id, minio.GetObjectOptions{})
+// Storage back end which keeps files in a Minio (or other S3 compatible) server
+type minioStorage struct{}
+
+// Handle for an object retrieved from Minio
+type minioObject struct {
+	*minio.Object
+}
+
+// Removes an object from Minio
+func (m minioStorage) Delete(bucket string, id string) error {
+	err := minioClient.RemoveObject(bucket, id)
+	if err != nil {
+		log.Printf("Error removing object '%s/%s' from Minio: %v\n", bucket, id, err)
+	}
+	return err
+}
+
+// Checks if an object is present in Minio
+func (m minioStorage) Exists(bucket string, id string) (bool, error) {
+	_, err := minioClient.StatObject(bucket, id, minio.StatObjectOptions{})
+	if err != nil {
+		code := minio.ToErrorResponse(err).Code
+		if code == "NoSuchKey" || code == "NoSuchBucket" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Get a handle from Minio for an object
+func (m minioStorage) Get(bucket string, id string) (StorageObject, error) {
+	obj, err := minioClient.GetObject(bucket, id, minio.GetObjectOptions{})
 	if err != nil {
 		log.Printf("Error retrieving DB from Minio: %v\n", err)
 		return nil, errors.New("Error retrieving database from internal storage")
 	}
+	return minioObject{obj}, nil
+}
+
+// Returns the ids of the objects in a Minio bucket
+func (m minioStorage) List(bucket string) (ids []string, err error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	for obj := range minioClient.ListObjects(bucket, "", true, doneCh) {
+		if obj.Err != nil {
+			if minio.ToErrorResponse(obj.Err).Code == "NoSuchBucket" {
+				return nil, nil
+			}
+			return nil, obj.Err
+		}
+		ids = append(ids, obj.Key)
+	}
+	return
+}
+
+// Stores an object in Minio, creating the bucket for it first if needed
+func (m minioStorage) Put(bucket string, id string, data io.Reader, size int64, contentType string) (int64, error) {
+	// If a Minio bucket with the desired name doesn't already exist, create it
+	found, err := minioClient.BucketExists(bucket)
+	if err != nil {
+		log.Printf("Error when checking if Minio bucket '%s' already exists: %v\n", bucket, err)
+		return 0, err
+	}
+	if !found {
+		err := minioClient.MakeBucket(bucket, "us-east-1")
+		if err != nil {
+			log.Printf("Error creating Minio bucket '%v': %v\n", bucket, err)
+			return 0, err
+		}
+	}
+
+	numBytes, err := minioClient.PutObject(bucket, id, data, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		log.Printf("Storing file in Minio failed: %v\n", err)
+		return 0, err
+	}
+	return numBytes, nil
+}
+
+// Returns the size of an object retrieved from Minio
+func (o minioObject) Size() (int64, error) {
+	stat, err := o.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size, nil
+}
 
-	return userDB, nil
+// Get a handle from the storage back end for a SQLite database object.
+func MinioHandle(bucket string, id string) (StorageObject, error) {
+	return storageBackend.Get(bucket, id)
 }
 
-// Close a Minio object handle.  Probably most useful for calling with defer().
-func MinioHandleClose(userDB *minio.Object) (err error) {
+// Close a storage object handle.  Probably most useful for calling with defer().
+func MinioHandleClose(userDB StorageObject) (err error) {
 	err = userDB.Close()
 	if err != nil {
 		log.Printf("Error closing object handle: %v\n", err)
@@ -52,21 +135,21 @@ func MinioHandleClose(userDB *minio.Object) (err error) {
 	return
 }
 
-// Retrieves a SQLite database from Minio, opens it, returns the connection handle.
+// Retrieves a SQLite database from the storage back end, opens it, returns the connection handle.
 // Also returns the name of the temp file created, which the caller needs to delete (os.Remove()) when finished with it
 func OpenMinioObject(bucket string, id string) (*sqlite.Conn, error) {
 
 	// Check if the database file already exists
 	newDB := filepath.Join(Conf.DiskCache.Directory, bucket, id)
 	if _, err := os.Stat(newDB); os.IsNotExist(err) {
-		// * The database doesn't yet exist locally, so fetch it from Minio
+		// * The database doesn't yet exist locally, so fetch it from storage
 
-		// Check if a the database file is already being fetched from Minio by a different caller
+		// Check if a the database file is already being fetched from storage by a different caller
 		//  eg check if there is a "<filename>.new" file already in the disk cache
 		if _, err := os.Stat(newDB + ".new"); os.IsNotExist(err) {
 			// * The database isn't already being fetched, so we're ok to proceed
 
-			// Get a handle from Minio for the database object
+			// Get a handle from the storage back end for the database object
 			userDB, err := MinioHandle(bucket, id)
 			if err != nil {
 				return nil, err
@@ -131,29 +214,41 @@ func OpenMinioObject(bucket string, id string) (*sqlite.Conn, error) {
 	return sdb, nil
 }
 
-// Store a database file in Minio.
-func StoreDatabaseFile(db *os.File, sha string, dbSize int64) error {
-	bkt := sha[:MinioFolderChars]
-	id := sha[MinioFolderChars:]
-
-	// If a Minio bucket with the desired name doesn't already exist, create it
-	found, err := minioClient.BucketExists(bkt)
+// Removes a database file from the storage back end after a failed upload, unless a commit has started using it in
+// the meantime.  The file is locked while this happens, so commits being stored by other uploads of the same file
+// either go first, or find it missing and fail.  Errors are only logged, as the upload has already failed.
+func removeOrphanedDatabaseFile(sha string) {
+	tx, err := pdb.Begin()
 	if err != nil {
-		log.Printf("Error when checking if Minio bucket '%s' already exists: %v\n", bkt, err)
-		return err
+		log.Printf("Removing orphaned database file '%s' failed: %v\n", sha, err)
+		return
 	}
-	if !found {
-		err := minioClient.MakeBucket(bkt, "us-east-1")
-		if err != nil {
-			log.Printf("Error creating Minio bucket '%v': %v\n", bkt, err)
-			return err
-		}
+	defer tx.Rollback()
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, databaseFileLockID, sha)
+	if err != nil {
+		log.Printf("Locking database file '%s' failed: %v\n", sha, err)
+		return
+	}
+	inUse, err := databaseFileInUse(tx, sha)
+	if err != nil || inUse {
+		return
+	}
+	err = storageBackend.Delete(sha[:MinioFolderChars], sha[MinioFolderChars:])
+	if err != nil {
+		log.Printf("Removing orphaned database file '%s' failed: %v\n", sha, err)
+		return
 	}
+	log.Printf("Removed orphaned database file '%s' after a failed upload\n", sha)
+}
 
-	// Store the SQLite database file in Minio
-	numBytes, err := minioClient.PutObject(bkt, id, db, dbSize, minio.PutObjectOptions{ContentType: "application/x-sqlite3"})
+// Store a database file in the storage back end.
+func StoreDatabaseFile(db *os.File, sha string, dbSize int64) error {
+	bkt := sha[:MinioFolderChars]
+	id := sha[MinioFolderChars:]
+
+	// Store the SQLite database file
+	numBytes, err := storageBackend.Put(bkt, id, db, dbSize, "application/x-sqlite3")
 	if err != nil {
-		log.Printf("Storing file in Minio failed: %v\n", err)
 		return err
 	}
 
@@ -161,7 +256,7 @@ func StoreDatabaseFile(db *os.File, sha string, dbSize int64) error {
 	if dbSize != numBytes {
 		log.Printf("Something went wrong storing the database file.  dbSize = %v, numBytes = %v\n", dbSize,
 			numBytes)
-		return err
+		return errors.New("Storing database file failed")
 	}
 	return nil
 }
@@ -0,0 +1,250 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Background worker which periodically re-imports mirrored databases from their source URL.  When the source has
+// changed, a new commit is added to the configured branch.
+func MirrorWorker() {
+	log.Printf("Source URL mirroring loop started.  %d second refresh.\n", Conf.Mirror.Interval)
+	for {
+		dbList, err := MirroredDatabases()
+		if err == nil {
+			for _, db := range dbList {
+				err = mirrorDatabase(db)
+				if err != nil {
+					log.Printf("Error when mirroring '%s%s%s' from '%s': %v\n", db.Owner, db.Folder, db.Name,
+						db.SourceURL, err)
+				}
+
+				// Record the check even when it failed, so the settings page shows the mirror is being processed
+				StoreMirrorCheck(db.Owner, db.Folder, db.Name)
+			}
+		}
+
+		// Wait before running the loop again
+		time.Sleep(Conf.Mirror.Interval * time.Second)
+	}
+}
+
+// Returns true if an IP address is one mirroring mustn't connect to, as it's on the server's own network rather than
+// the public internet
+func blockedMirrorIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Private and otherwise non-public address ranges, which blockedMirrorIP refuses
+var privateNets = func() (nets []*net.IPNet) {
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // "This" network
+		"10.0.0.0/8",     // Private
+		"100.64.0.0/10",  // Carrier grade NAT
+		"172.16.0.0/12",  // Private
+		"192.0.0.0/24",   // IETF protocol assignments
+		"192.168.0.0/16", // Private
+		"198.18.0.0/15",  // Benchmarking
+		"240.0.0.0/4",    // Reserved
+		"64:ff9b::/96",   // IPv4/IPv6 translation, which could reach any of the above
+		"fc00::/7",       // Unique local
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return
+}()
+
+// Connects to the host for a mirror download, refusing hosts which resolve to a blocked address.  The connection is
+// made to the checked address, so the host can't resolve to a different one in between.  As every connection goes
+// through here, this also covers redirects.
+func dialMirrorHost(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("No addresses found for source URL host '%s'", host)
+	}
+	for _, a := range addrs {
+		if blockedMirrorIP(a.IP) {
+			return nil, fmt.Errorf("Source URL host '%s' is on a private or local network", host)
+		}
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+}
+
+// Client used for downloading mirror sources.  It only connects to public addresses, and doesn't use any proxy the
+// server has been set up with, as that could reach internal addresses on its behalf
+var mirrorClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("Too many redirects from source URL")
+		}
+		if s := strings.ToLower(req.URL.Scheme); s != "http" && s != "https" {
+			return fmt.Errorf("Source URL redirected to unsupported scheme '%s'", req.URL.Scheme)
+		}
+		return nil
+	},
+	Timeout: 10 * time.Minute,
+	Transport: &http.Transport{
+		DialContext:         dialMirrorHost,
+		TLSHandshakeTimeout: 30 * time.Second,
+	},
+}
+
+// Downloads (or copies) the source of a mirrored database to a temporary file, returning the open file and the last
+// modified time reported by the source.  The caller needs to close and remove the temporary file.
+func fetchMirrorSource(sourceURL string) (tempFile *os.File, lastModified time.Time, err error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	// Open the source
+	var src io.ReadCloser
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		resp, err := mirrorClient.Get(sourceURL)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, time.Time{}, fmt.Errorf("Source URL returned status '%s'", resp.Status)
+		}
+		lastModified, err = http.ParseTime(resp.Header.Get("Last-Modified"))
+		if err != nil {
+			lastModified = time.Now()
+		}
+		src = resp.Body
+	case "file":
+		// Local files are only allowed from the directory the server admin has set aside for them
+		if Conf.Mirror.LocalDir == "" {
+			return nil, time.Time{}, errors.New("Mirroring from local files isn't enabled on this server")
+		}
+		p := filepath.Clean(u.Path)
+		rel, err := filepath.Rel(filepath.Clean(Conf.Mirror.LocalDir), p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, time.Time{}, errors.New("Local source file is outside the allowed mirroring directory")
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, time.Time{}, err
+		}
+		lastModified = fi.ModTime()
+		src = f
+	default:
+		return nil, time.Time{}, fmt.Errorf("Unsupported source URL scheme '%s'", u.Scheme)
+	}
+	defer src.Close()
+
+	// Copy the source to a temporary file, refusing anything larger than the maximum database size
+	tempFile, err = ioutil.TempFile(Conf.DiskCache.Directory, "dbhub-mirror-")
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	maxSize := int64(MaxDatabaseSize * 1024 * 1024)
+	numBytes, err := io.Copy(tempFile, io.LimitReader(src, maxSize+1))
+	if err == nil && numBytes > maxSize {
+		err = fmt.Errorf("Source database is larger than the maximum allowed size of %d MB", MaxDatabaseSize)
+	}
+	if err == nil {
+		_, err = tempFile.Seek(0, 0)
+	}
+	if err != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return nil, time.Time{}, err
+	}
+	return tempFile, lastModified, nil
+}
+
+// Re-imports a single mirrored database, adding a new commit to its mirror branch if the source has changed
+func mirrorDatabase(db MirrorEntry) error {
+	tempFile, lastModified, err := fetchMirrorSource(db.SourceURL)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	// Calculate the SHA256 of the source
+	s := sha256.New()
+	_, err = io.Copy(s, tempFile)
+	if err != nil {
+		return err
+	}
+	sha := hex.EncodeToString(s.Sum(nil))
+
+	// If the source matches the head of the mirror branch, there's nothing to do
+	branches, err := GetBranches(db.Owner, db.Folder, db.Name)
+	if err != nil {
+		return err
+	}
+	b, ok := branches[db.Branch]
+	if !ok {
+		return fmt.Errorf("Mirror branch '%s' doesn't exist", db.Branch)
+	}
+	head, ok, err := GetCommit(db.Owner, db.Folder, db.Name, b.Commit)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("Head commit '%s' of branch '%s' not found", b.Commit, db.Branch)
+	}
+	if len(head.Tree.Entries) > 0 && head.Tree.Entries[0].Sha256 == sha {
+		return nil
+	}
+
+	// The source has changed, so add it as a new commit
+	_, err = tempFile.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Automatic re-import from source URL %s", db.SourceURL)
+	_, newCommit, _, err := AddDatabase(nil, db.Owner, db.Owner, db.Folder, db.Name, false, db.Branch, "",
+		db.Public, "", msg, db.SourceURL, tempFile, "dbhub-mirror", lastModified, time.Time{}, "", "", "", "",
+		nil, sha)
+	if err != nil {
+		return err
+	}
+	log.Printf("Mirrored '%s%s%s' from '%s', new commit '%s' on branch '%s'\n", db.Owner, db.Folder, db.Name,
+		db.SourceURL, newCommit, db.Branch)
+	return nil
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"net"
+	"testing"
+)
+
+// Checks mirroring refuses addresses on the server's own network, including IPv4 addresses written as IPv6
+func TestBlockedMirrorIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{ip: "127.0.0.1", blocked: true},
+		{ip: "127.1.2.3", blocked: true},
+		{ip: "::1", blocked: true},
+		{ip: "0.0.0.0", blocked: true},
+		{ip: "::", blocked: true},
+		{ip: "10.1.2.3", blocked: true},
+		{ip: "172.16.0.1", blocked: true},
+		{ip: "172.31.255.255", blocked: true},
+		{ip: "192.168.1.1", blocked: true},
+		{ip: "100.64.0.1", blocked: true},
+		{ip: "169.254.169.254", blocked: true},
+		{ip: "fe80::1", blocked: true},
+		{ip: "fd00::1", blocked: true},
+		{ip: "::ffff:10.0.0.1", blocked: true},
+		{ip: "::ffff:127.0.0.1", blocked: true},
+		{ip: "64:ff9b::a00:1", blocked: true},
+		{ip: "224.0.0.1", blocked: true},
+		{ip: "255.255.255.255", blocked: true},
+		{ip: "8.8.8.8", blocked: false},
+		{ip: "172.32.0.1", blocked: false},
+		{ip: "100.128.0.1", blocked: false},
+		{ip: "2001:4860:4860::8888", blocked: false},
+		{ip: "::ffff:8.8.8.8", blocked: false},
+	}
+	for _, j := range tests {
+		if got := blockedMirrorIP(net.ParseIP(j.ip)); got != j.blocked {
+			t.Errorf("blockedMirrorIP(%s) = %v, wanted %v", j.ip, got, j.blocked)
+		}
+	}
+}
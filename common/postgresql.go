@@ -7,8 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
-	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -79,12 +80,72 @@ func AddUser(auth0ID string, userName string, password string, email string, dis
 		log.Printf("Wrong number of rows affected when creating user: %v, username: %v\n", numRows, userName)
 	}
 
+	// Record the details of the initial client certificate, so it can be revoked later if needed
+	serial, expires, err := clientCertDetails(cert)
+	if err != nil {
+		return err
+	}
+	err = StoreClientCertDetails(userName, "Initial certificate", serial, expires)
+	if err != nil {
+		return err
+	}
+
 	// Log the user registration
 	log.Printf("User registered: '%s' Email: '%s'\n", userName, email)
 
 	return nil
 }
 
+// Adds client_certificates entries for the certificates issued before certificates were recorded there, so they can
+// be listed and revoked like the newer ones.  Only the certificate last issued to each user (the one in the users
+// table) is known, so any older ones will be refused and need replacing.
+func BackfillClientCerts() error {
+	dbQuery := `
+		SELECT u.user_name, u.client_cert
+		FROM users AS u
+		WHERE length(u.client_cert) > 0
+			AND NOT EXISTS (
+				SELECT 1
+				FROM client_certificates AS c
+				WHERE c.user_id = u.user_id
+			)`
+	rows, err := pdb.Query(dbQuery)
+	if err != nil {
+		log.Printf("Retrieving client certs to backfill failed: %v\n", err)
+		return err
+	}
+	certs := make(map[string][]byte)
+	for rows.Next() {
+		var userName string
+		var cert []byte
+		err = rows.Scan(&userName, &cert)
+		if err != nil {
+			rows.Close()
+			log.Printf("Error retrieving client certs to backfill: %v\n", err)
+			return err
+		}
+		certs[userName] = cert
+	}
+	rows.Close()
+
+	// Record each certificate under the same name new accounts use for their first one
+	for userName, cert := range certs {
+		serial, expires, err := clientCertDetails(cert)
+		if err != nil {
+			log.Printf("Skipping unreadable client cert for '%s' when backfilling: %v\n", userName, err)
+			continue
+		}
+		err = StoreClientCertDetails(userName, "Initial certificate", serial, expires)
+		if err != nil {
+			return err
+		}
+	}
+	if len(certs) > 0 {
+		log.Printf("Backfilled client certificate details for %d user(s)\n", len(certs))
+	}
+	return nil
+}
+
 // Check if a database exists
 // If an error occurred, the true/false value should be ignored, as only the error value is valid.
 func CheckDBExists(loggedInUser string, dbOwner string, dbFolder string, dbName string) (bool, error) {
@@ -319,6 +380,230 @@ func ClientCert(userName string) ([]byte, error) {
 	return cert, nil
 }
 
+// Returns true if a client certificate with the given serial number (as hex) has been revoked.  Certificates without
+// a client_certificates entry are treated as revoked, as every certificate still in use is recorded there (see
+// BackfillClientCerts), so the owner of an unknown one needs to generate a new certificate.
+func ClientCertRevoked(serial string) (bool, error) {
+	var revoked bool
+	err := pdb.QueryRow(`
+		SELECT date_revoked IS NOT NULL
+		FROM client_certificates
+		WHERE serial_number = $1`, serial).Scan(&revoked)
+	if err == pgx.ErrNoRows {
+		log.Printf("Client cert '%s' isn't in the client_certificates table, so treating it as revoked\n", serial)
+		return true, nil
+	}
+	if err != nil {
+		log.Printf("Checking revocation status of client cert '%s' failed: %v\n", serial, err)
+		return false, err
+	}
+	return revoked, nil
+}
+
+// Returns the list of named client certificates issued to a user.
+func ClientCerts(userName string) (list []ClientCertEntry, err error) {
+	dbQuery := `
+		SELECT cert_id, cert_name, serial_number, date_issued, date_expires, date_revoked
+		FROM client_certificates
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+		ORDER BY date_issued DESC`
+	rows, err := pdb.Query(dbQuery, userName)
+	if err != nil {
+		log.Printf("Retrieving client certs for '%s' failed: %v\n", userName, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var oneRow ClientCertEntry
+		var revoked pgx.NullTime
+		err = rows.Scan(&oneRow.ID, &oneRow.Name, &oneRow.Serial, &oneRow.Issued, &oneRow.Expires, &revoked)
+		if err != nil {
+			log.Printf("Error retrieving client certs for '%s': %v\n", userName, err)
+			return nil, err
+		}
+		if revoked.Valid {
+			oneRow.Revoked = revoked.Time
+		}
+		list = append(list, oneRow)
+	}
+	return list, nil
+}
+
+// Returns the IDs of the commits in the history of the given commits, including themselves.  Like the branch history
+// pages, this follows the first parent of each commit.
+func commitAncestors(dbOwner string, dbFolder string, dbName string, heads []string) (ids map[string]bool, err error) {
+	dbQuery := `
+		WITH RECURSIVE d AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($1)
+				)
+				AND folder = $2
+				AND db_name = $3
+				AND is_deleted = false
+		), hist AS (
+			SELECT c.commit_id, c.parent
+			FROM database_commits AS c, d
+			WHERE c.db_id = d.db_id
+				AND c.commit_id = ANY($4)
+			UNION
+			SELECT c.commit_id, c.parent
+			FROM database_commits AS c, d, hist AS h
+			WHERE c.db_id = d.db_id
+				AND c.commit_id = h.parent
+		)
+		SELECT commit_id
+		FROM hist`
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName, heads)
+	if err != nil {
+		log.Printf("Retrieving commit history for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return nil, err
+	}
+	defer rows.Close()
+	ids = make(map[string]bool)
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			log.Printf("Retrieving commit history for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// Compares the history of a commit in one database with the history of a commit in another (eg a fork and its
+// upstream database).  Returns the IDs of the commits only in the history of the first one (ahead), and the IDs of
+// those only in the history of the other one (behind).  Unlike commitAncestors, this follows every parent of each
+// commit, so history brought in by merge commits is included.
+func commitHistoryDiff(dbOwner string, dbFolder string, dbName string, commitID string, otherOwner string,
+	otherFolder string, otherDBName string, otherCommitID string) (ahead []string, behind []string, err error) {
+	dbQuery := `
+		WITH RECURSIVE d AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($1)
+				)
+				AND folder = $2
+				AND db_name = $3
+				AND is_deleted = false
+		), other AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($5)
+				)
+				AND folder = $6
+				AND db_name = $7
+				AND is_deleted = false
+		), hist AS (
+			SELECT c.commit_id, array_prepend(c.parent, c.other_parents) AS parents
+			FROM database_commits AS c, d
+			WHERE c.db_id = d.db_id
+				AND c.commit_id = $4
+			UNION
+			SELECT c.commit_id, array_prepend(c.parent, c.other_parents)
+			FROM database_commits AS c, d, hist AS h
+			WHERE c.db_id = d.db_id
+				AND c.commit_id = ANY(h.parents)
+		), other_hist AS (
+			SELECT c.commit_id, array_prepend(c.parent, c.other_parents) AS parents
+			FROM database_commits AS c, other
+			WHERE c.db_id = other.db_id
+				AND c.commit_id = $8
+			UNION
+			SELECT c.commit_id, array_prepend(c.parent, c.other_parents)
+			FROM database_commits AS c, other, other_hist AS h
+			WHERE c.db_id = other.db_id
+				AND c.commit_id = ANY(h.parents)
+		)
+		SELECT h.commit_id, true
+		FROM hist AS h
+		WHERE NOT EXISTS (SELECT 1 FROM other_hist AS o WHERE o.commit_id = h.commit_id)
+		UNION ALL
+		SELECT o.commit_id, false
+		FROM other_hist AS o
+		WHERE NOT EXISTS (SELECT 1 FROM hist AS h WHERE h.commit_id = o.commit_id)`
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName, commitID, otherOwner, otherFolder, otherDBName,
+		otherCommitID)
+	if err != nil {
+		log.Printf("Comparing the commit history of '%s%s%s' with '%s%s%s' failed: %v\n", dbOwner, dbFolder,
+			dbName, otherOwner, otherFolder, otherDBName, err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var isAhead bool
+		err = rows.Scan(&id, &isAhead)
+		if err != nil {
+			log.Printf("Comparing the commit history of '%s%s%s' with '%s%s%s' failed: %v\n", dbOwner, dbFolder,
+				dbName, otherOwner, otherFolder, otherDBName, err)
+			return nil, nil, err
+		}
+		if isAhead {
+			ahead = append(ahead, id)
+		} else {
+			behind = append(behind, id)
+		}
+	}
+	return ahead, behind, nil
+}
+
+// Retrieves the given commits of a database.  Commits which aren't in the commit list of the database are left out.
+func commitsByID(dbOwner string, dbFolder string, dbName string, ids []string) (map[string]CommitEntry, error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		SELECT c.commit_id, c.parent, c.other_parents, c.author_name, c.author_email, c.committer_name,
+			c.committer_email, c.message, c.commit_timestamp, c.tree, c.validation_failures
+		FROM database_commits AS c, sqlite_databases AS db, u
+		WHERE c.db_id = db.db_id
+			AND db.user_id = u.user_id
+			AND db.folder = $2
+			AND db.db_name = $3
+			AND db.is_deleted = false
+			AND c.commit_id = ANY($4)`
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName, ids)
+	if err != nil {
+		log.Printf("Retrieving commits for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return nil, err
+	}
+	defer rows.Close()
+	l := make(map[string]CommitEntry)
+	for rows.Next() {
+		var c CommitEntry
+		err = rows.Scan(&c.ID, &c.Parent, &c.OtherParents, &c.AuthorName, &c.AuthorEmail, &c.CommitterName,
+			&c.CommitterEmail, &c.Message, &c.Timestamp, &c.Tree, &c.ValidationFailures)
+		if err != nil {
+			log.Printf("Retrieving commits for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+			return nil, err
+		}
+		if len(c.OtherParents) == 0 {
+			c.OtherParents = nil
+		}
+		c.Timestamp = c.Timestamp.UTC()
+		l[c.ID] = c
+	}
+	return l, nil
+}
+
 // Creates a connection pool to the PostgreSQL server.
 func ConnectPostgreSQL() (err error) {
 	pgPoolConfig := pgx.ConnPoolConfig{*pgConfig, Conf.Pg.NumConnections, nil, 2 * time.Second}
@@ -354,6 +639,21 @@ func databaseID(dbOwner string, dbFolder string, dbName string) (dbID int, err e
 	return
 }
 
+// Checks if any commit in the system uses a given database file.
+func databaseFileInUse(tx *pgx.Tx, sha string) (inUse bool, err error) {
+	dbQuery := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM database_commits
+			WHERE tree @> jsonb_build_object('entries', jsonb_build_array(jsonb_build_object('sha256', $1::text)))
+		)`
+	err = tx.QueryRow(dbQuery, sha).Scan(&inUse)
+	if err != nil {
+		log.Printf("Error checking if database file '%s' is in use: %v\n", sha, err)
+	}
+	return
+}
+
 // Return a list of 1) users with public databases, 2) along with the logged in users' most recently modified database
 // (including their private one(s)).
 func DB4SDefaultList(loggedInUser string) (map[string]UserInfo, error) {
@@ -444,10 +744,11 @@ func DBDetails(DB *SQLiteDBinfo, loggedInUser string, dbOwner string, dbFolder s
 	// Retrieve the database details
 	dbQuery := `
 		SELECT db.date_created, db.last_modified, db.watchers, db.stars, db.discussions, db.merge_requests,
-			$4::text AS commit_id, db.commit_list->$4::text->'tree'->'entries'->0 AS db_entry,
+			$4::text AS commit_id, c.tree->'entries'->0 AS db_entry,
 			db.branches, db.release_count, db.contributors, db.one_line_description, db.full_description,
 			db.default_table, db.public, db.source_url, db.tags, db.default_branch
 		FROM sqlite_databases AS db
+			LEFT JOIN database_commits AS c ON c.db_id = db.db_id AND c.commit_id = $4
 		WHERE db.user_id = (
 				SELECT user_id
 				FROM users
@@ -593,16 +894,18 @@ func DBWatchers(dbOwner string, dbFolder string, dbName string) (watcherCount in
 func DefaultCommit(dbOwner string, dbFolder string, dbName string) (string, error) {
 	// If no commit ID was supplied, we retrieve the latest commit ID from the default branch
 	dbQuery := `
-		SELECT branch_heads->default_branch->'commit' AS commit_id
-		FROM sqlite_databases
-		WHERE user_id = (
+		SELECT b.commit_id
+		FROM sqlite_databases AS db, database_branches AS b
+		WHERE b.db_id = db.db_id
+			AND b.branch_name = db.default_branch
+			AND db.user_id = (
 				SELECT user_id
 					FROM users
 					WHERE lower(user_name) = lower($1)
 			)
-			AND folder = $2
-			AND db_name = $3
-			AND is_deleted = false`
+			AND db.folder = $2
+			AND db.db_name = $3
+			AND db.is_deleted = false`
 	var commitID string
 	err := pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&commitID)
 	if err != nil {
@@ -702,6 +1005,19 @@ func DeleteComment(dbOwner string, dbFolder string, dbName string, discID int, c
 	return nil
 }
 
+// Removes commits from a database, as part of a transaction which moves or removes the branch they were on.
+func deleteCommits(tx *pgx.Tx, dbID int, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	dbQuery := `
+		DELETE FROM database_commits
+		WHERE db_id = $1
+			AND commit_id = ANY($2)`
+	_, err := tx.Exec(dbQuery, dbID, ids)
+	return err
+}
+
 // Deletes a database from PostgreSQL.
 func DeleteDatabase(dbOwner string, dbFolder string, dbName string) error {
 	// TODO: At some point we'll need to figure out a garbage collection approach to remove databases from Minio which
@@ -937,57 +1253,24 @@ func DeleteLicence(userName string, licenceName string) (err error) {
 
 	// * Check if there are databases present which use this licence.  If there are, then abort. *
 
-	// TODO: Get around to adding appropriate GIN indexes
-
-	// Note - This uses the JsQuery extension for PostgreSQL, which needs compiling on the server and adding in.
-	//        However, this seems like it'll be much more straight forward and usable for writing queries with than
-	//        than to use straight PG SQL
-	//        JsQuery repo: https://github.com/postgrespro/jsquery
-	//        Some useful examples: https://postgrespro.ru/media/2017/04/04/jsonb-pgconf.us-2017.pdf
+	// The GIN index on the commit trees is used for the containment (@>) check
 	dbQuery := `
-		SELECT DISTINCT count(*)
-		FROM sqlite_databases AS db
-		WHERE db.commit_list @@ '*.licence = %s'
-			AND (user_id = (
+		SELECT count(DISTINCT db.db_id)
+		FROM sqlite_databases AS db, database_commits AS c
+		WHERE c.db_id = db.db_id
+			AND c.tree @> jsonb_build_object('entries', jsonb_build_array(jsonb_build_object('licence', $2::text)))
+			AND (db.user_id = (
 				SELECT user_id
 				FROM users
 				WHERE user_name = 'default'
 			)
-			OR user_id = (
+			OR db.user_id = (
 				SELECT user_id
 				FROM users
 				WHERE lower(user_name) = lower($1)
 			))`
-	// We do this because licSHA needs to be unquoted for JsQuery to work, and the Go PG driver mucks things
-	// up if it's given as a parameter to that (eg as $2)
-	dbQuery = fmt.Sprintf(dbQuery, licSHA)
-
-	// The same query in straight PG:
-	//dbQuery := `
-	//	WITH working_set AS (
-	//		SELECT DISTINCT db.db_id
-	//		FROM sqlite_databases AS db
-	//			CROSS JOIN jsonb_each(db.commit_list) AS firstjoin
-	//			CROSS JOIN jsonb_array_elements(firstjoin.value -> 'tree' -> 'entries') AS secondjoin
-	//		WHERE secondjoin ->> 'licence' = $2
-	//			AND (
-	//				user_id = (
-	//					SELECT user_id
-	//					FROM users
-	//					WHERE user_name = 'default'
-	//				)
-	//				OR user_id = (
-	//					SELECT user_id
-	//					FROM users
-	//					WHERE lower(user_name) = lower($1)
-	//				)
-	//			)
-	//	)
-	//	SELECT count(*)
-	//	FROM working_set`
-
 	var DBCount int
-	err = pdb.QueryRow(dbQuery, userName).Scan(&DBCount)
+	err = pdb.QueryRow(dbQuery, userName, licSHA).Scan(&DBCount)
 	if err != nil {
 		log.Printf("Checking if the licence is in use failed: %v\n", err)
 		return err
@@ -1299,8 +1582,18 @@ func FlushViewCount() {
 	return
 }
 
-// Fork the PostgreSQL entry for a SQLite database from one user to another
-func ForkDatabase(srcOwner string, dbFolder string, dbName string, dstOwner string) (newForkCount int, err error) {
+// Fork the PostgreSQL entry for a SQLite database from one user to another.  The tags and releases of the source
+// database are only copied if copyTags is true
+func ForkDatabase(srcOwner string, dbFolder string, dbName string, dstOwner string, copyTags bool) (newForkCount int,
+	err error) {
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
 	// Copy the main database entry
 	dbQuery := `
 		WITH dst_u AS (
@@ -1309,11 +1602,11 @@ func ForkDatabase(srcOwner string, dbFolder string, dbName string, dstOwner stri
 			WHERE lower(user_name) = lower($1)
 		)
 		INSERT INTO sqlite_databases (user_id, folder, db_name, public, forks, one_line_description, full_description,
-			branches, contributors, root_database, default_table, source_url, commit_list, branch_heads, tags,
-			default_branch, forked_from)
+			branches, contributors, root_database, default_table, source_url, tags, default_branch, forked_from,
+			release_count)
 		SELECT dst_u.user_id, folder, db_name, public, 0, one_line_description, full_description, branches,
-			contributors, root_database, default_table, source_url, commit_list, branch_heads, tags, default_branch,
-			db_id
+			contributors, root_database, default_table, source_url, CASE WHEN $5 THEN tags ELSE 0 END,
+			default_branch, db_id, CASE WHEN $5 THEN release_count ELSE 0 END
 		FROM sqlite_databases, dst_u
 		WHERE sqlite_databases.user_id = (
 				SELECT user_id
@@ -1321,15 +1614,62 @@ func ForkDatabase(srcOwner string, dbFolder string, dbName string, dstOwner stri
 				WHERE lower(user_name) = lower($2)
 			)
 			AND folder = $3
-			AND db_name = $4`
-	commandTag, err := pdb.Exec(dbQuery, dstOwner, srcOwner, dbFolder, dbName)
+			AND db_name = $4
+		RETURNING db_id, forked_from`
+	var srcID, dstID int
+	err = tx.QueryRow(dbQuery, dstOwner, srcOwner, dbFolder, dbName, copyTags).Scan(&dstID, &srcID)
 	if err != nil {
 		log.Printf("Forking database '%s%s%s' in PostgreSQL failed: %v\n", srcOwner, dbFolder, dbName, err)
 		return 0, err
 	}
-	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong number of rows affected (%d) when forking main database entry: "+
-			"'%s%s%s' to '%s%s%s'\n", numRows, srcOwner, dbFolder, dbName, dstOwner, dbFolder, dbName)
+
+	// Copy the commit history and branches, plus the tags and releases if requested
+	dbQuery = `
+		INSERT INTO database_commits (db_id, commit_id, parent, other_parents, author_name, author_email,
+			committer_name, committer_email, message, commit_timestamp, tree, validation_failures)
+		SELECT $1, commit_id, parent, other_parents, author_name, author_email, committer_name, committer_email,
+			message, commit_timestamp, tree, validation_failures
+		FROM database_commits
+		WHERE db_id = $2`
+	_, err = tx.Exec(dbQuery, dstID, srcID)
+	if err != nil {
+		log.Printf("Copying commits when forking '%s%s%s' failed: %v\n", srcOwner, dbFolder, dbName, err)
+		return 0, err
+	}
+	dbQuery = `
+		INSERT INTO database_branches (db_id, branch_name, commit_id, commit_count, description)
+		SELECT $1, branch_name, commit_id, commit_count, description
+		FROM database_branches
+		WHERE db_id = $2`
+	_, err = tx.Exec(dbQuery, dstID, srcID)
+	if err != nil {
+		log.Printf("Copying branches when forking '%s%s%s' failed: %v\n", srcOwner, dbFolder, dbName, err)
+		return 0, err
+	}
+	if copyTags {
+		dbQuery = `
+			INSERT INTO database_tags (db_id, tag_name, commit_id, date_created, description, tagger_email,
+				tagger_name)
+			SELECT $1, tag_name, commit_id, date_created, description, tagger_email, tagger_name
+			FROM database_tags
+			WHERE db_id = $2`
+		_, err = tx.Exec(dbQuery, dstID, srcID)
+		if err != nil {
+			log.Printf("Copying tags when forking '%s%s%s' failed: %v\n", srcOwner, dbFolder, dbName, err)
+			return 0, err
+		}
+		dbQuery = `
+			INSERT INTO database_releases (db_id, release_name, commit_id, date_created, description,
+				releaser_email, releaser_name, size, manifest, signature)
+			SELECT $1, release_name, commit_id, date_created, description, releaser_email, releaser_name, size,
+				manifest, signature
+			FROM database_releases
+			WHERE db_id = $2`
+		_, err = tx.Exec(dbQuery, dstID, srcID)
+		if err != nil {
+			log.Printf("Copying releases when forking '%s%s%s' failed: %v\n", srcOwner, dbFolder, dbName, err)
+			return 0, err
+		}
 	}
 
 	// Update the fork count for the root database
@@ -1355,11 +1695,17 @@ func ForkDatabase(srcOwner string, dbFolder string, dbName string, dstOwner stri
 		FROM new_count, root_db
 		WHERE sqlite_databases.db_id = root_db.id
 		RETURNING new_count.forks - 1`
-	err = pdb.QueryRow(dbQuery, dstOwner, dbFolder, dbName).Scan(&newForkCount)
+	err = tx.QueryRow(dbQuery, dstOwner, dbFolder, dbName).Scan(&newForkCount)
 	if err != nil {
 		log.Printf("Updating fork count in PostgreSQL failed: %v\n", err)
 		return 0, err
 	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
 	return newForkCount, nil
 }
 
@@ -1767,53 +2113,138 @@ func GetActivityStats() (stats ActivityStats, err error) {
 // TODO  which of the branches is the default.
 func GetBranches(dbOwner string, dbFolder string, dbName string) (branches map[string]BranchEntry, err error) {
 	dbQuery := `
-		SELECT db.branch_heads
-		FROM sqlite_databases AS db
-		WHERE db.user_id = (
+		SELECT b.branch_name, b.commit_id, b.commit_count, b.description
+		FROM database_branches AS b, sqlite_databases AS db
+		WHERE b.db_id = db.db_id
+			AND db.user_id = (
 				SELECT user_id
 				FROM users
 				WHERE lower(user_name) = lower($1)
 			)
 			AND db.folder = $2
 			AND db.db_name = $3`
-	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&branches)
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName)
 	if err != nil {
 		log.Printf("Error when retrieving branch heads for database '%s%s%s': %v\n", dbOwner, dbFolder, dbName,
 			err)
 		return nil, err
 	}
+	defer rows.Close()
+	branches = make(map[string]BranchEntry)
+	for rows.Next() {
+		var name string
+		var b BranchEntry
+		err = rows.Scan(&name, &b.Commit, &b.CommitCount, &b.Description)
+		if err != nil {
+			log.Printf("Error when retrieving branch heads for database '%s%s%s': %v\n", dbOwner, dbFolder,
+				dbName, err)
+			return nil, err
+		}
+		branches[name] = b
+	}
 	return branches, nil
 }
 
-// Retrieves the full commit list for a database.
-func GetCommitList(dbOwner string, dbFolder string, dbName string) (map[string]CommitEntry, error) {
+// Retrieves a single commit for a database.  If the commit isn't in the commit list of the database, ok is false.
+func GetCommit(dbOwner string, dbFolder string, dbName string, commitID string) (c CommitEntry, ok bool, err error) {
 	dbQuery := `
 		WITH u AS (
 			SELECT user_id
 			FROM users
 			WHERE lower(user_name) = lower($1)
 		)
-		SELECT commit_list as commits
-		FROM sqlite_databases AS db, u
-		WHERE db.user_id = u.user_id
+		SELECT c.commit_id, c.parent, c.other_parents, c.author_name, c.author_email, c.committer_name,
+			c.committer_email, c.message, c.commit_timestamp, c.tree, c.validation_failures
+		FROM database_commits AS c, sqlite_databases AS db, u
+		WHERE c.db_id = db.db_id
+			AND db.user_id = u.user_id
 			AND db.folder = $2
 			AND db.db_name = $3
-			AND db.is_deleted = false`
-	var l map[string]CommitEntry
-	err := pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&l)
+			AND db.is_deleted = false
+			AND c.commit_id = $4`
+	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName, commitID).Scan(&c.ID, &c.Parent, &c.OtherParents,
+		&c.AuthorName, &c.AuthorEmail, &c.CommitterName, &c.CommitterEmail, &c.Message, &c.Timestamp, &c.Tree,
+		&c.ValidationFailures)
+	if err == pgx.ErrNoRows {
+		return CommitEntry{}, false, nil
+	}
 	if err != nil {
-		log.Printf("Retrieving commit list for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
-		return map[string]CommitEntry{}, err
+		log.Printf("Retrieving commit '%s' for '%s%s%s' failed: %v\n", commitID, dbOwner, dbFolder, dbName, err)
+		return CommitEntry{}, false, err
 	}
-	return l, nil
+	if len(c.OtherParents) == 0 {
+		c.OtherParents = nil
+	}
+	c.Timestamp = c.Timestamp.UTC()
+	return c, true, nil
 }
 
-// Returns the default branch name for a database.
-func GetDefaultBranchName(dbOwner string, dbFolder string, dbName string) (branchName string, err error) {
+// Retrieves the history of a commit, newest first, following the first parent of each commit.  The first offset
+// commits are skipped, and at most limit commits are returned, so long histories can be shown a page at a time.
+func GetCommitHistory(dbOwner string, dbFolder string, dbName string, commitID string, offset int,
+	limit int) (list []CommitEntry, err error) {
 	dbQuery := `
-		SELECT db.default_branch
-		FROM sqlite_databases AS db
-		WHERE db.user_id = (
+		WITH RECURSIVE d AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($1)
+				)
+				AND folder = $2
+				AND db_name = $3
+				AND is_deleted = false
+		), hist AS (
+			SELECT c.commit_id, c.parent, 0 AS depth
+			FROM database_commits AS c, d
+			WHERE c.db_id = d.db_id
+				AND c.commit_id = $4
+			UNION ALL
+			SELECT c.commit_id, c.parent, h.depth + 1
+			FROM database_commits AS c, d, hist AS h
+			WHERE c.db_id = d.db_id
+				AND c.commit_id = h.parent
+				AND h.depth + 1 < $7
+		)
+		SELECT c.commit_id, c.parent, c.other_parents, c.author_name, c.author_email, c.committer_name,
+			c.committer_email, c.message, c.commit_timestamp, c.tree, c.validation_failures
+		FROM database_commits AS c, d, hist AS h
+		WHERE c.db_id = d.db_id
+			AND c.commit_id = h.commit_id
+		ORDER BY h.depth
+		OFFSET $5
+		LIMIT $6`
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName, commitID, offset, limit, offset+limit)
+	if err != nil {
+		log.Printf("Retrieving commit history for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c CommitEntry
+		err = rows.Scan(&c.ID, &c.Parent, &c.OtherParents, &c.AuthorName, &c.AuthorEmail, &c.CommitterName,
+			&c.CommitterEmail, &c.Message, &c.Timestamp, &c.Tree, &c.ValidationFailures)
+		if err != nil {
+			log.Printf("Retrieving commit history for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+			return nil, err
+		}
+		if len(c.OtherParents) == 0 {
+			c.OtherParents = nil
+		}
+		c.Timestamp = c.Timestamp.UTC()
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// Retrieves the IDs of all the commits for a database, without the rest of the commit details.
+func GetCommitIDs(dbOwner string, dbFolder string, dbName string) (ids []string, err error) {
+	dbQuery := `
+		SELECT c.commit_id
+		FROM database_commits AS c, sqlite_databases AS db
+		WHERE c.db_id = db.db_id
+			AND db.user_id = (
 				SELECT user_id
 				FROM users
 				WHERE lower(user_name) = lower($1)
@@ -1821,21 +2252,125 @@ func GetDefaultBranchName(dbOwner string, dbFolder string, dbName string) (branc
 			AND db.folder = $2
 			AND db.db_name = $3
 			AND db.is_deleted = false`
-	var b pgx.NullString
-	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&b)
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName)
 	if err != nil {
-		if err != pgx.ErrNoRows {
-			log.Printf("Error when retrieving default branch name for database '%s%s%s': %v\n", dbOwner,
-				dbFolder, dbName, err)
-			return
-		} else {
-			log.Printf("No default branch name exists for database '%s%s%s'. This shouldn't happen\n", dbOwner,
-				dbFolder, dbName)
-			return
-		}
-	}
-	if b.Valid {
-		branchName = b.String
+		log.Printf("Retrieving commit IDs for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			log.Printf("Retrieving commit IDs for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Retrieves the full commit list for a database.
+func GetCommitList(dbOwner string, dbFolder string, dbName string) (map[string]CommitEntry, error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		SELECT c.commit_id, c.parent, c.other_parents, c.author_name, c.author_email, c.committer_name,
+			c.committer_email, c.message, c.commit_timestamp, c.tree, c.validation_failures
+		FROM database_commits AS c, sqlite_databases AS db, u
+		WHERE c.db_id = db.db_id
+			AND db.user_id = u.user_id
+			AND db.folder = $2
+			AND db.db_name = $3
+			AND db.is_deleted = false`
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName)
+	if err != nil {
+		log.Printf("Retrieving commit list for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return map[string]CommitEntry{}, err
+	}
+	defer rows.Close()
+	l := make(map[string]CommitEntry)
+	for rows.Next() {
+		var c CommitEntry
+		err = rows.Scan(&c.ID, &c.Parent, &c.OtherParents, &c.AuthorName, &c.AuthorEmail, &c.CommitterName,
+			&c.CommitterEmail, &c.Message, &c.Timestamp, &c.Tree, &c.ValidationFailures)
+		if err != nil {
+			log.Printf("Retrieving commit list for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+			return map[string]CommitEntry{}, err
+		}
+		if len(c.OtherParents) == 0 {
+			c.OtherParents = nil
+		}
+		c.Timestamp = c.Timestamp.UTC()
+		l[c.ID] = c
+	}
+	return l, nil
+}
+
+// Returns the authors of the commits for a database, along with the number of commits by each of them.
+func GetContributors(dbOwner string, dbFolder string, dbName string) (list []ContributorEntry, err error) {
+	dbQuery := `
+		SELECT c.author_name, max(c.author_email), count(*)
+		FROM database_commits AS c, sqlite_databases AS db
+		WHERE c.db_id = db.db_id
+			AND db.user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db.folder = $2
+			AND db.db_name = $3
+			AND db.is_deleted = false
+		GROUP BY c.author_name`
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName)
+	if err != nil {
+		log.Printf("Retrieving contributors for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c ContributorEntry
+		err = rows.Scan(&c.AuthorName, &c.AuthorEmail, &c.NumCommits)
+		if err != nil {
+			log.Printf("Retrieving contributors for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// Returns the default branch name for a database.
+func GetDefaultBranchName(dbOwner string, dbFolder string, dbName string) (branchName string, err error) {
+	dbQuery := `
+		SELECT db.default_branch
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db.folder = $2
+			AND db.db_name = $3
+			AND db.is_deleted = false`
+	var b pgx.NullString
+	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&b)
+	if err != nil {
+		if err != pgx.ErrNoRows {
+			log.Printf("Error when retrieving default branch name for database '%s%s%s': %v\n", dbOwner,
+				dbFolder, dbName, err)
+			return
+		} else {
+			log.Printf("No default branch name exists for database '%s%s%s'. This shouldn't happen\n", dbOwner,
+				dbFolder, dbName)
+			return
+		}
+	}
+	if b.Valid {
+		branchName = b.String
 	}
 	return
 }
@@ -1899,6 +2434,27 @@ func GetDiscussionAndMRCount(dbOwner string, dbFolder string, dbName string) (di
 	return
 }
 
+// Returns whether a fork is automatically kept in sync with its upstream database.
+func GetForkSync(dbOwner string, dbFolder string, dbName string) (forkSync bool, err error) {
+	dbQuery := `
+		SELECT fork_sync
+		FROM sqlite_databases
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND folder = $2
+			AND db_name = $3`
+	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&forkSync)
+	if err != nil {
+		log.Printf("Error when retrieving fork sync setting for database '%s%s%s': %v\n", dbOwner, dbFolder, dbName,
+			err)
+		return false, err
+	}
+	return forkSync, nil
+}
+
 // Returns the text for a given licence.
 func GetLicence(userName string, licenceName string) (txt string, format string, err error) {
 	dbQuery := `
@@ -2070,10 +2626,11 @@ func GetLicenceSha256FromName(userName string, licenceName string) (sha256 strin
 	return sha256, nil
 }
 
-// Retrieve the list of releases for a database.
-func GetReleases(dbOwner string, dbFolder string, dbName string) (releases map[string]ReleaseEntry, err error) {
+// Retrieve the mirroring settings for a database.  An empty branch name means the database isn't being mirrored
+// from its source URL.
+func GetMirrorSettings(dbOwner string, dbFolder string, dbName string) (branch string, lastChecked time.Time, err error) {
 	dbQuery := `
-		SELECT release_list
+		SELECT mirror_branch, mirror_last_checked
 		FROM sqlite_databases
 		WHERE user_id = (
 				SELECT user_id
@@ -2082,14 +2639,62 @@ func GetReleases(dbOwner string, dbFolder string, dbName string) (releases map[s
 			)
 			AND folder = $2
 			AND db_name = $3`
-	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&releases)
+	var b pgx.NullString
+	var l pgx.NullTime
+	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&b, &l)
+	if err != nil {
+		log.Printf("Error when retrieving mirror settings for database '%s%s%s': %v\n", dbOwner, dbFolder, dbName,
+			err)
+		return "", time.Time{}, err
+	}
+	if b.Valid {
+		branch = b.String
+	}
+	if l.Valid {
+		lastChecked = l.Time
+	}
+	return branch, lastChecked, nil
+}
+
+// Retrieve the list of releases for a database.
+func GetReleases(dbOwner string, dbFolder string, dbName string) (releases map[string]ReleaseEntry, err error) {
+	dbQuery := `
+		SELECT r.release_name, r.commit_id, r.date_created, r.description, r.releaser_email, r.releaser_name,
+			r.size, r.manifest, r.signature
+		FROM database_releases AS r, sqlite_databases AS db
+		WHERE r.db_id = db.db_id
+			AND db.user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db.folder = $2
+			AND db.db_name = $3`
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName)
 	if err != nil {
 		log.Printf("Error when retrieving releases for database '%s%s%s': %v\n", dbOwner, dbFolder, dbName, err)
 		return nil, err
 	}
-	if releases == nil {
-		// If there aren't any releases yet, return an empty set instead of nil
-		releases = make(map[string]ReleaseEntry)
+	defer rows.Close()
+
+	// If there aren't any releases yet, this returns an empty set instead of nil
+	releases = make(map[string]ReleaseEntry)
+	for rows.Next() {
+		var name string
+		var rel ReleaseEntry
+		var m pgx.NullString
+		err = rows.Scan(&name, &rel.Commit, &rel.Date, &rel.Description, &rel.ReleaserEmail, &rel.ReleaserName,
+			&rel.Size, &m, &rel.Signature)
+		if err != nil {
+			log.Printf("Error when retrieving releases for database '%s%s%s': %v\n", dbOwner, dbFolder, dbName,
+				err)
+			return nil, err
+		}
+		if m.Valid {
+			rel.Manifest = m.String
+		}
+		rel.Date = rel.Date.UTC()
+		releases[name] = rel
 	}
 	return releases, nil
 }
@@ -2097,23 +2702,35 @@ func GetReleases(dbOwner string, dbFolder string, dbName string) (releases map[s
 // Retrieve the tags for a database.
 func GetTags(dbOwner string, dbFolder string, dbName string) (tags map[string]TagEntry, err error) {
 	dbQuery := `
-		SELECT tag_list
-		FROM sqlite_databases
-		WHERE user_id = (
+		SELECT t.tag_name, t.commit_id, t.date_created, t.description, t.tagger_email, t.tagger_name
+		FROM database_tags AS t, sqlite_databases AS db
+		WHERE t.db_id = db.db_id
+			AND db.user_id = (
 				SELECT user_id
 				FROM users
 				WHERE lower(user_name) = lower($1)
 			)
-			AND folder = $2
-			AND db_name = $3`
-	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&tags)
+			AND db.folder = $2
+			AND db.db_name = $3`
+	rows, err := pdb.Query(dbQuery, dbOwner, dbFolder, dbName)
 	if err != nil {
 		log.Printf("Error when retrieving tags for database '%s%s%s': %v\n", dbOwner, dbFolder, dbName, err)
 		return nil, err
 	}
-	if tags == nil {
-		// If there aren't any tags yet, return an empty set instead of nil
-		tags = make(map[string]TagEntry)
+	defer rows.Close()
+
+	// If there aren't any tags yet, this returns an empty set instead of nil
+	tags = make(map[string]TagEntry)
+	for rows.Next() {
+		var name string
+		var t TagEntry
+		err = rows.Scan(&name, &t.Commit, &t.Date, &t.Description, &t.TaggerEmail, &t.TaggerName)
+		if err != nil {
+			log.Printf("Error when retrieving tags for database '%s%s%s': %v\n", dbOwner, dbFolder, dbName, err)
+			return nil, err
+		}
+		t.Date = t.Date.UTC()
+		tags[name] = t
 	}
 	return tags, nil
 }
@@ -2146,6 +2763,31 @@ func GetUsernameFromEmail(email string) (userName string, avatarURL string, err
 	return
 }
 
+// Retrieve the data validation rules for a database.
+func GetValidationRules(dbOwner string, dbFolder string, dbName string) (rules []ValidationRule, err error) {
+	dbQuery := `
+		SELECT validation_rules
+		FROM sqlite_databases
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND folder = $2
+			AND db_name = $3`
+	err = pdb.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&rules)
+	if err != nil {
+		log.Printf("Error when retrieving validation rules for database '%s%s%s': %v\n", dbOwner, dbFolder, dbName,
+			err)
+		return nil, err
+	}
+	if rules == nil {
+		// If there aren't any rules yet, return an empty set instead of nil
+		rules = []ValidationRule{}
+	}
+	return rules, nil
+}
+
 // Increments the download count for a database
 func IncrementDownloadCount(dbOwner string, dbFolder string, dbName string) error {
 	dbQuery := `
@@ -2173,6 +2815,76 @@ func IncrementDownloadCount(dbOwner string, dbFolder string, dbName string) erro
 	return nil
 }
 
+// Adds a commit to the commit list of a database.  Commits already in the list are left alone, as the commit ID covers
+// their contents.
+func insertCommit(tx *pgx.Tx, dbID int, c CommitEntry) error {
+	otherParents := c.OtherParents
+	if otherParents == nil {
+		otherParents = []string{}
+	}
+	dbQuery := `
+		INSERT INTO database_commits (db_id, commit_id, parent, other_parents, author_name, author_email,
+			committer_name, committer_email, message, commit_timestamp, tree, validation_failures)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (db_id, commit_id) DO NOTHING`
+	_, err := tx.Exec(dbQuery, dbID, c.ID, c.Parent, otherParents, c.AuthorName, c.AuthorEmail, c.CommitterName,
+		c.CommitterEmail, c.Message, c.Timestamp, c.Tree, c.ValidationFailures)
+	return err
+}
+
+// Key for the PostgreSQL advisory locks held on database file SHA256s
+const databaseFileLockID = 4856236
+
+// Locks the SHA256s of database files until a transaction finishes, then checks the files are still in the storage
+// back end.  Anything storing commits holds the locks for their database files while doing so, and an upload cleaning
+// up after a failure holds the lock while it checks and removes its file, so a file can't be removed from under a
+// commit which is about to use it.
+func lockDatabaseFiles(tx *pgx.Tx, shas ...string) error {
+	// The locks are taken in order, so two uploads sharing several files can't deadlock
+	sorted := append([]string(nil), shas...)
+	sort.Strings(sorted)
+	for _, sha := range sorted {
+		_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, databaseFileLockID, sha)
+		if err != nil {
+			log.Printf("Locking database file '%s' failed: %v\n", sha, err)
+			return err
+		}
+	}
+	for _, sha := range sorted {
+		exists, err := storageBackend.Exists(sha[:MinioFolderChars], sha[MinioFolderChars:])
+		if err != nil {
+			log.Printf("Checking if database file '%s' is stored failed: %v\n", sha, err)
+			return err
+		}
+		if !exists {
+			return newActionError(http.StatusConflict, fmt.Sprintf("Database file '%s' was removed by a failed "+
+				"upload while this one was being processed.  Please try again.", sha))
+		}
+	}
+	return nil
+}
+
+// Returns the ID number for a given user's database, locking its entry until the transaction finishes.  This is used
+// to stop concurrent changes to the commit list, branches, tags, or releases of a database from clobbering each other.
+func lockDatabaseID(tx *pgx.Tx, dbOwner string, dbFolder string, dbName string) (dbID int, err error) {
+	dbQuery := `
+		SELECT db_id
+		FROM sqlite_databases
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1))
+			AND folder = $2
+			AND db_name = $3
+		FOR UPDATE`
+	err = tx.QueryRow(dbQuery, dbOwner, dbFolder, dbName).Scan(&dbID)
+	if err != nil {
+		log.Printf("Error locking database entry. Owner: '%s', Database: '%s%s'. Error: %v\n", dbOwner, dbFolder,
+			dbName, err)
+	}
+	return
+}
+
 // Create a download log entry
 func LogDownload(dbOwner string, dbFolder string, dbName string, loggedInUser string, ipAddr string, serverSw string,
 	userAgent string, downloadDate time.Time, sha string) error {
@@ -2272,9 +2984,10 @@ func MinioLocation(dbOwner string, dbFolder string, dbName string, commitID stri
 	// Retrieve the sha256 and last modified date for the requested commit's database file
 	var dbQuery string
 	dbQuery = `
-		SELECT commit_list->$4::text->'tree'->'entries'->0->'sha256' AS sha256,
-			commit_list->$4::text->'tree'->'entries'->0->'last_modified' AS last_modified
+		SELECT c.tree->'entries'->0->'sha256' AS sha256,
+			c.tree->'entries'->0->'last_modified' AS last_modified
 		FROM sqlite_databases AS db
+			LEFT JOIN database_commits AS c ON c.db_id = db.db_id AND c.commit_id = $4
 		WHERE db.user_id = (
 				SELECT user_id
 				FROM users
@@ -2313,6 +3026,34 @@ func MinioLocation(dbOwner string, dbFolder string, dbName string, commitID stri
 	return
 }
 
+// Returns the list of databases being periodically re-imported from their source URL.
+func MirroredDatabases() (list []MirrorEntry, err error) {
+	dbQuery := `
+		SELECT users.user_name, db.folder, db.db_name, db.public, db.source_url, db.mirror_branch
+		FROM sqlite_databases AS db, users
+		WHERE db.mirror_branch IS NOT NULL
+			AND db.source_url IS NOT NULL
+			AND db.is_deleted = false
+			AND db.user_id = users.user_id`
+	rows, err := pdb.Query(dbQuery)
+	if err != nil {
+		log.Printf("Database query failed: %v\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var oneRow MirrorEntry
+		err = rows.Scan(&oneRow.Owner, &oneRow.Folder, &oneRow.Name, &oneRow.Public, &oneRow.SourceURL,
+			&oneRow.Branch)
+		if err != nil {
+			log.Printf("Error retrieving list of mirrored databases: %v\n", err)
+			return nil, err
+		}
+		list = append(list, oneRow)
+	}
+	return list, nil
+}
+
 // Adds an event entry to PostgreSQL
 func NewEvent(details EventDetails) (err error) {
 	dbQuery := `
@@ -2357,6 +3098,129 @@ func PrefUserMaxRows(loggedInUser string) int {
 	return maxRows
 }
 
+// Removes a branch head from a database.  The branch is only removed if its head is still at the given commit, so a
+// branch which has moved since the caller checked it isn't lost.  The commits in delCommits (those only on the branch)
+// are removed along with it, in the same transaction.
+func RemoveBranch(dbOwner string, dbFolder string, dbName string, branchName string, head string,
+	delCommits []string) error {
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Lock the database entry, so concurrent updates to the branch list happen one after the other
+	dbID, err := lockDatabaseID(tx, dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Remove the branch, and update the branch count
+	dbQuery := `
+		DELETE FROM database_branches
+		WHERE db_id = $1
+			AND branch_name = $2
+			AND commit_id = $3`
+	commandTag, err := tx.Exec(dbQuery, dbID, branchName, head)
+	if err != nil {
+		log.Printf("Removing branch '%s' from database '%s%s%s' failed: %v\n", branchName, dbOwner, dbFolder,
+			dbName, err)
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return newActionError(http.StatusConflict, fmt.Sprintf("Branch '%s' was changed by something else "+
+			"while this update was being processed.  Please try again.", branchName))
+	}
+	err = deleteCommits(tx, dbID, delCommits)
+	if err != nil {
+		log.Printf("Removing commits of branch '%s' from database '%s%s%s' failed: %v\n", branchName, dbOwner,
+			dbFolder, dbName, err)
+		return err
+	}
+	dbQuery = `
+		UPDATE sqlite_databases
+		SET branches = (SELECT count(*) FROM database_branches WHERE db_id = $1)
+		WHERE db_id = $1`
+	_, err = tx.Exec(dbQuery, dbID)
+	if err != nil {
+		log.Printf("Updating branch count for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// Removes a release from a database.
+func RemoveRelease(dbOwner string, dbFolder string, dbName string, relName string) error {
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Lock the database entry, so concurrent updates to the release list happen one after the other
+	dbID, err := lockDatabaseID(tx, dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Remove the release, and update the release count
+	_, err = tx.Exec(`DELETE FROM database_releases WHERE db_id = $1 AND release_name = $2`, dbID, relName)
+	if err != nil {
+		log.Printf("Removing release '%s' from database '%s%s%s' failed: %v\n", relName, dbOwner, dbFolder,
+			dbName, err)
+		return err
+	}
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET release_count = (SELECT count(*) FROM database_releases WHERE db_id = $1)
+		WHERE db_id = $1`
+	_, err = tx.Exec(dbQuery, dbID)
+	if err != nil {
+		log.Printf("Updating release count for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// Removes a tag from a database.
+func RemoveTag(dbOwner string, dbFolder string, dbName string, tagName string) error {
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Lock the database entry, so concurrent updates to the tag list happen one after the other
+	dbID, err := lockDatabaseID(tx, dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Remove the tag, and update the tag count
+	_, err = tx.Exec(`DELETE FROM database_tags WHERE db_id = $1 AND tag_name = $2`, dbID, tagName)
+	if err != nil {
+		log.Printf("Removing tag '%s' from database '%s%s%s' failed: %v\n", tagName, dbOwner, dbFolder, dbName,
+			err)
+		return err
+	}
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET tags = (SELECT count(*) FROM database_tags WHERE db_id = $1)
+		WHERE db_id = $1`
+	_, err = tx.Exec(dbQuery, dbID)
+	if err != nil {
+		log.Printf("Updating tag count for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+	return tx.Commit()
+}
+
 // Rename a SQLite database.
 func RenameDatabase(userName string, dbFolder string, dbName string, newName string) error {
 	// Save the database settings
@@ -2389,6 +3253,56 @@ func RenameDatabase(userName string, dbFolder string, dbName string, newName str
 	return nil
 }
 
+// Revokes one of a user's client certificates.
+func RevokeClientCert(userName string, certID int64) error {
+	dbQuery := `
+		UPDATE client_certificates
+		SET date_revoked = now()
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND cert_id = $2
+			AND date_revoked IS NULL`
+	commandTag, err := pdb.Exec(dbQuery, userName, certID)
+	if err != nil {
+		log.Printf("Revoking client cert '%d' for '%s' failed: %v\n", certID, userName, err)
+		return err
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		return errors.New("Unknown or already revoked certificate")
+	}
+	log.Printf("Client cert '%d' for user '%s' revoked\n", certID, userName)
+	return nil
+}
+
+// Returns the list of all revoked client certificates which haven't yet expired.
+func RevokedClientCerts() (list []ClientCertEntry, err error) {
+	dbQuery := `
+		SELECT cert_id, cert_name, serial_number, date_issued, date_expires, date_revoked
+		FROM client_certificates
+		WHERE date_revoked IS NOT NULL
+			AND date_expires > now()`
+	rows, err := pdb.Query(dbQuery)
+	if err != nil {
+		log.Printf("Retrieving revoked client certs failed: %v\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var oneRow ClientCertEntry
+		err = rows.Scan(&oneRow.ID, &oneRow.Name, &oneRow.Serial, &oneRow.Issued, &oneRow.Expires,
+			&oneRow.Revoked)
+		if err != nil {
+			log.Printf("Error retrieving revoked client certs: %v\n", err)
+			return nil, err
+		}
+		list = append(list, oneRow)
+	}
+	return list, nil
+}
+
 // Saves updated database settings to PostgreSQL.
 func SaveDBSettings(userName string, dbFolder string, dbName string, oneLineDesc string, fullDesc string,
 	defaultTable string, public bool, sourceURL string, defaultBranch string) error {
@@ -2862,28 +3776,64 @@ func StatusUpdatesLoop() {
 	return
 }
 
-// Updates the branches list for a database.
-func StoreBranches(dbOwner string, dbFolder string, dbName string, branches map[string]BranchEntry) error {
+// Adds or updates a single branch head for a database.  Other branches are left alone.
+func StoreBranch(dbOwner string, dbFolder string, dbName string, branchName string, b BranchEntry) error {
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Lock the database entry, so concurrent updates to the branch list happen one after the other
+	dbID, err := lockDatabaseID(tx, dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Store the branch head
 	dbQuery := `
+		INSERT INTO database_branches (db_id, branch_name, commit_id, commit_count, description)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (db_id, branch_name)
+			DO UPDATE
+			SET commit_id = excluded.commit_id,
+				commit_count = excluded.commit_count,
+				description = excluded.description`
+	_, err = tx.Exec(dbQuery, dbID, branchName, b.Commit, b.CommitCount, b.Description)
+	if err != nil {
+		log.Printf("Updating branch '%s' for database '%s%s%s' to '%v' failed: %v\n", branchName, dbOwner,
+			dbFolder, dbName, b, err)
+		return err
+	}
+
+	// Update the branch count
+	dbQuery = `
 		UPDATE sqlite_databases
-		SET branch_heads = $4, branches = $5
-		WHERE user_id = (
-				SELECT user_id
-				FROM users
-				WHERE lower(user_name) = lower($1)
-				)
-			AND folder = $2
-			AND db_name = $3`
-	commandTag, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, branches, len(branches))
+		SET branches = (SELECT count(*) FROM database_branches WHERE db_id = $1)
+		WHERE db_id = $1`
+	_, err = tx.Exec(dbQuery, dbID)
+	if err != nil {
+		log.Printf("Updating branch count for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// Records the details of a newly issued client certificate.
+func StoreClientCertDetails(userName string, certName string, serial string, expires time.Time) error {
+	dbQuery := `
+		INSERT INTO client_certificates (user_id, cert_name, serial_number, date_expires)
+		SELECT (SELECT user_id FROM users WHERE lower(user_name) = lower($1)), $2, $3, $4`
+	commandTag, err := pdb.Exec(dbQuery, userName, certName, serial, expires)
 	if err != nil {
-		log.Printf("Updating branch heads for database '%s%s%s' to '%v' failed: %v\n", dbOwner, dbFolder,
-			dbName, branches, err)
+		log.Printf("Storing client cert details for '%s' failed: %v\n", userName, err)
 		return err
 	}
 	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf(
-			"Wrong number of rows (%v) affected when updating branch heads for database '%s%s%s' to '%v'\n",
-			numRows, dbOwner, dbFolder, dbName, branches)
+		log.Printf("Wrong number of rows (%v) affected when storing client cert details for '%s'\n", numRows,
+			userName)
 	}
 	return nil
 }
@@ -3161,41 +4111,13 @@ func StoreComment(dbOwner string, dbFolder string, dbName string, commenter stri
 	return nil
 }
 
-// Updates the commit list for a database.
-func StoreCommits(dbOwner string, dbFolder string, dbName string, commitList map[string]CommitEntry) error {
-	dbQuery := `
-		UPDATE sqlite_databases
-		SET commit_list = $4, last_modified = now()
-		WHERE user_id = (
-				SELECT user_id
-				FROM users
-				WHERE lower(user_name) = lower($1)
-				)
-			AND folder = $2
-			AND db_name = $3`
-	commandTag, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, commitList)
-	if err != nil {
-		log.Printf("Updating commit list for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
-		return err
-	}
-	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf(
-			"Wrong number of rows (%v) affected when updating commit list for database '%s%s%s'\n", numRows,
-			dbOwner, dbFolder, dbName)
-	}
-	return nil
-}
-
-// Stores database details in PostgreSQL, and the database data itself in Minio.
-func StoreDatabase(dbOwner string, dbFolder string, dbName string, branches map[string]BranchEntry, c CommitEntry,
-	pub bool, buf *os.File, sha string, dbSize int64, oneLineDesc string, fullDesc string, createDefBranch bool,
-	branchName string, sourceURL string) error {
-	// Store the database file
-	err := StoreDatabaseFile(buf, sha, dbSize)
-	if err != nil {
-		return err
-	}
-
+// Stores the details of a database upload in PostgreSQL.  The commit, branch head, counts, watcher entry, and upload
+// log entry are all written in a single transaction, so a failure part way through doesn't leave them inconsistent.
+// If oldHead isn't empty, the branch head is only moved if it still points to oldHead, otherwise a new branch is
+// created.  The database file itself needs to be in the storage back end already.
+func StoreDatabase(dbOwner string, dbFolder string, dbName string, c CommitEntry, pub bool, oneLineDesc string,
+	fullDesc string, createDefBranch bool, branchName string, oldHead string, commitCount int, sourceURL string,
+	tables []string, ipAddr string, serverSw string, userAgent string, sha string) error {
 	// Check for values which should be NULL
 	var nullable1LineDesc, nullableFullDesc pgx.NullString
 	if oneLineDesc == "" {
@@ -3210,16 +4132,31 @@ func StoreDatabase(dbOwner string, dbFolder string, dbName string, branches map[
 		nullableFullDesc.String = fullDesc
 		nullableFullDesc.Valid = true
 	}
+	if tables == nil {
+		tables = []string{}
+	}
+
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Make sure the database file is still stored, and can't be removed until the commit using it is saved
+	err = lockDatabaseFiles(tx, sha)
+	if err != nil {
+		return err
+	}
 
 	// Store the database metadata
-	cMap := map[string]CommitEntry{c.ID: c}
-	var commandTag pgx.CommandTag
 	dbQuery := `
 		WITH root AS (
 			SELECT nextval('sqlite_databases_db_id_seq') AS val
 		)
 		INSERT INTO sqlite_databases (user_id, db_id, folder, db_name, public, one_line_description, full_description,
-			branch_heads, root_database, commit_list`
+			root_database`
 	if sourceURL != "" {
 		dbQuery += `, source_url`
 	}
@@ -3228,43 +4165,150 @@ func StoreDatabase(dbOwner string, dbFolder string, dbName string, branches map[
 		SELECT (
 			SELECT user_id
 			FROM users
-			WHERE lower(user_name) = lower($1)), (SELECT val FROM root), $2, $3, $4, $5, $6, $8, (SELECT val FROM root), $7`
+			WHERE lower(user_name) = lower($1)), (SELECT val FROM root), $2, $3, $4, $5, $6, (SELECT val FROM root)`
 	if sourceURL != "" {
-		dbQuery += `, $9`
+		dbQuery += `, $7`
 	}
 	dbQuery += `
 		ON CONFLICT (user_id, folder, db_name)
 			DO UPDATE
-			SET commit_list = sqlite_databases.commit_list || $7,
-				branch_heads = sqlite_databases.branch_heads || $8,
-				last_modified = now()`
+			SET last_modified = now()`
 	if sourceURL != "" {
 		dbQuery += `,
-			source_url = $9`
-		commandTag, err = pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, pub, nullable1LineDesc, nullableFullDesc,
-			cMap, branches, sourceURL)
+			source_url = $7`
+	}
+	dbQuery += `
+		RETURNING db_id`
+	var dbID int
+	if sourceURL != "" {
+		err = tx.QueryRow(dbQuery, dbOwner, dbFolder, dbName, pub, nullable1LineDesc, nullableFullDesc,
+			sourceURL).Scan(&dbID)
 	} else {
-		commandTag, err = pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, pub, nullable1LineDesc, nullableFullDesc,
-			cMap, branches)
+		err = tx.QueryRow(dbQuery, dbOwner, dbFolder, dbName, pub, nullable1LineDesc, nullableFullDesc).Scan(&dbID)
 	}
 	if err != nil {
 		log.Printf("Storing database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
 		return err
 	}
-	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong number of rows (%v) affected while storing database '%s%s%s'\n", numRows, dbOwner,
-			dbFolder, dbName)
+
+	// Add the new commit
+	err = insertCommit(tx, dbID, c)
+	if err != nil {
+		log.Printf("Storing commit for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+
+	// Move the branch head to the new commit.  This is a compare-and-swap, so if another upload got there first the
+	// branch is left alone and this upload is rejected
+	if oldHead == "" {
+		dbQuery = `
+			INSERT INTO database_branches (db_id, branch_name, commit_id, commit_count)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (db_id, branch_name) DO NOTHING`
+		commandTag, err := tx.Exec(dbQuery, dbID, branchName, c.ID, commitCount)
+		if err != nil {
+			log.Printf("Creating branch '%s' for database '%s%s%s' failed: %v\n", branchName, dbOwner, dbFolder,
+				dbName, err)
+			return err
+		}
+		if commandTag.RowsAffected() != 1 {
+			return newActionError(http.StatusConflict, fmt.Sprintf("Branch '%s' was created by another upload "+
+				"while this one was being processed.  Please try again.", branchName))
+		}
+	} else {
+		dbQuery = `
+			UPDATE database_branches
+			SET commit_id = $4, commit_count = $5
+			WHERE db_id = $1
+				AND branch_name = $2
+				AND commit_id = $3`
+		commandTag, err := tx.Exec(dbQuery, dbID, branchName, oldHead, c.ID, commitCount)
+		if err != nil {
+			log.Printf("Updating branch '%s' for database '%s%s%s' failed: %v\n", branchName, dbOwner, dbFolder,
+				dbName, err)
+			return err
+		}
+		if commandTag.RowsAffected() != 1 {
+			return newActionError(http.StatusConflict, fmt.Sprintf("Branch '%s' was changed by another upload "+
+				"while this one was being processed.  Please try again.", branchName))
+		}
+	}
+
+	// Update the branch and contributor counts, and set the default branch for new databases
+	dbQuery = `
+		UPDATE sqlite_databases
+		SET branches = (SELECT count(*) FROM database_branches WHERE db_id = $1),
+			contributors = (SELECT count(DISTINCT author_email) FROM database_commits WHERE db_id = $1)`
+	if createDefBranch {
+		dbQuery += `,
+			default_branch = $2`
+	}
+	dbQuery += `
+		WHERE db_id = $1`
+	if createDefBranch {
+		_, err = tx.Exec(dbQuery, dbID, branchName)
+	} else {
+		_, err = tx.Exec(dbQuery, dbID)
+	}
+	if err != nil {
+		log.Printf("Updating counts for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+
+	// If the upload is on the default branch and doesn't have the default table, clear the default table value
+	dbQuery = `
+		UPDATE sqlite_databases
+		SET default_table = NULL
+		WHERE db_id = $1
+			AND default_branch = $2
+			AND default_table IS NOT NULL
+			AND NOT default_table = ANY($3)`
+	_, err = tx.Exec(dbQuery, dbID, branchName, tables)
+	if err != nil {
+		log.Printf("Clearing default table for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
 	}
 
+	// New databases are watched by their owner
 	if createDefBranch {
-		err = StoreDefaultBranchName(dbOwner, dbFolder, dbName, branchName)
+		dbQuery = `
+			INSERT INTO watchers (db_id, user_id)
+			SELECT $1, user_id
+			FROM users
+			WHERE lower(user_name) = lower($2)
+			ON CONFLICT (db_id, user_id) DO NOTHING`
+		_, err = tx.Exec(dbQuery, dbID, dbOwner)
 		if err != nil {
-			log.Printf("Storing default branch '%s' name for '%s%s%s' failed: %v\n", branchName, dbOwner,
+			log.Printf("Adding '%s' to watchers list for database '%s%s%s' failed: %v\n", dbOwner, dbOwner,
 				dbFolder, dbName, err)
 			return err
 		}
+		dbQuery = `
+			UPDATE sqlite_databases
+			SET watchers = (SELECT count(*) FROM watchers WHERE db_id = $1)
+			WHERE db_id = $1`
+		_, err = tx.Exec(dbQuery, dbID)
+		if err != nil {
+			log.Printf("Updating watchers count for '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+			return err
+		}
 	}
-	return nil
+
+	// Make a record of the upload
+	dbQuery = `
+		INSERT INTO database_uploads (db_id, user_id, ip_addr, server_sw, user_agent, upload_date, db_sha256)
+		SELECT $1, user_id, $3, $4, $5, now(), $6
+		FROM users
+		WHERE lower(user_name) = lower($2)`
+	_, err = tx.Exec(dbQuery, dbID, dbOwner, ipAddr, serverSw, userAgent, sha)
+	if err != nil {
+		log.Printf("Storing record of upload '%s%s%s', sha '%s' failed: %v\n", dbOwner, dbFolder, dbName, sha,
+			err)
+		return err
+	}
+
+	// Commit the transaction
+	return tx.Commit()
 }
 
 // Stores the default branch name for a database.
@@ -3425,6 +4469,30 @@ func StoreDiscussion(dbOwner string, dbFolder string, dbName string, loggedInUse
 	return
 }
 
+// Stores whether a fork is automatically kept in sync with its upstream database.
+func StoreForkSync(dbOwner string, dbFolder string, dbName string, forkSync bool) error {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET fork_sync = $4
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND folder = $2
+			AND db_name = $3`
+	commandTag, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, forkSync)
+	if err != nil {
+		log.Printf("Storing fork sync setting for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%v) affected when storing fork sync setting for database: '%s%s%s'\n",
+			numRows, dbOwner, dbFolder, dbName)
+	}
+	return nil
+}
+
 // Store a licence.
 func StoreLicence(userName string, licenceName string, txt []byte, url string, orderNum int, fullName string,
 	fileFormat string) error {
@@ -3461,11 +4529,16 @@ func StoreLicence(userName string, licenceName string, txt []byte, url string, o
 	return nil
 }
 
-// Store the releases for a database.
-func StoreReleases(dbOwner string, dbFolder string, dbName string, releases map[string]ReleaseEntry) error {
+// Stores the branch a database's source URL is mirrored into.  An empty branch name turns mirroring off.
+func StoreMirrorBranch(dbOwner string, dbFolder string, dbName string, branch string) error {
+	var nullableBranch pgx.NullString
+	if branch != "" {
+		nullableBranch.String = branch
+		nullableBranch.Valid = true
+	}
 	dbQuery := `
 		UPDATE sqlite_databases
-		SET release_list = $4, release_count = $5
+		SET mirror_branch = $4
 		WHERE user_id = (
 				SELECT user_id
 				FROM users
@@ -3473,18 +4546,95 @@ func StoreReleases(dbOwner string, dbFolder string, dbName string, releases map[
 			)
 			AND folder = $2
 			AND db_name = $3`
-	commandTag, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, releases, len(releases))
+	commandTag, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, nullableBranch)
 	if err != nil {
-		log.Printf("Storing releases for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		log.Printf("Storing mirror branch for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
 		return err
 	}
 	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong number of rows (%v) affected when storing releases for database: '%s%s%s'\n", numRows,
-			dbOwner, dbFolder, dbName)
+		log.Printf("Wrong number of rows (%v) affected when storing mirror branch for database: '%s%s%s'\n",
+			numRows, dbOwner, dbFolder, dbName)
+	}
+	return nil
+}
+
+// Records the time a mirrored database was last checked against its source URL.
+func StoreMirrorCheck(dbOwner string, dbFolder string, dbName string) error {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET mirror_last_checked = now()
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND folder = $2
+			AND db_name = $3`
+	_, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName)
+	if err != nil {
+		log.Printf("Storing mirror check time for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
 	}
 	return nil
 }
 
+// Adds or updates a single release for a database.  Other releases are left alone.
+func StoreRelease(dbOwner string, dbFolder string, dbName string, relName string, rel ReleaseEntry) error {
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Lock the database entry, so concurrent updates to the release list happen one after the other
+	dbID, err := lockDatabaseID(tx, dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Store the release.  Unsigned releases have a NULL manifest
+	var m pgx.NullString
+	if rel.Manifest != "" {
+		m.String = rel.Manifest
+		m.Valid = true
+	}
+	dbQuery := `
+		INSERT INTO database_releases (db_id, release_name, commit_id, date_created, description, releaser_email,
+			releaser_name, size, manifest, signature)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (db_id, release_name)
+			DO UPDATE
+			SET commit_id = excluded.commit_id,
+				date_created = excluded.date_created,
+				description = excluded.description,
+				releaser_email = excluded.releaser_email,
+				releaser_name = excluded.releaser_name,
+				size = excluded.size,
+				manifest = excluded.manifest,
+				signature = excluded.signature`
+	_, err = tx.Exec(dbQuery, dbID, relName, rel.Commit, rel.Date, rel.Description, rel.ReleaserEmail,
+		rel.ReleaserName, rel.Size, m, rel.Signature)
+	if err != nil {
+		log.Printf("Storing release '%s' for database '%s%s%s' failed: %v\n", relName, dbOwner, dbFolder, dbName,
+			err)
+		return err
+	}
+
+	// Update the release count
+	dbQuery = `
+		UPDATE sqlite_databases
+		SET release_count = (SELECT count(*) FROM database_releases WHERE db_id = $1)
+		WHERE db_id = $1`
+	_, err = tx.Exec(dbQuery, dbID)
+	if err != nil {
+		log.Printf("Updating release count for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+	return tx.Commit()
+}
+
 // Store the status updates list for a user
 func StoreStatusUpdates(userName string, statusUpdates map[string][]StatusUpdateEntry) error {
 	dbQuery := `
@@ -3504,11 +4654,57 @@ func StoreStatusUpdates(userName string, statusUpdates map[string][]StatusUpdate
 	return nil
 }
 
-// Store the tags for a database.
-func StoreTags(dbOwner string, dbFolder string, dbName string, tags map[string]TagEntry) error {
+// Adds or updates a single tag for a database.  Other tags are left alone.
+func StoreTag(dbOwner string, dbFolder string, dbName string, tagName string, t TagEntry) error {
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Lock the database entry, so concurrent updates to the tag list happen one after the other
+	dbID, err := lockDatabaseID(tx, dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Store the tag
+	dbQuery := `
+		INSERT INTO database_tags (db_id, tag_name, commit_id, date_created, description, tagger_email, tagger_name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (db_id, tag_name)
+			DO UPDATE
+			SET commit_id = excluded.commit_id,
+				date_created = excluded.date_created,
+				description = excluded.description,
+				tagger_email = excluded.tagger_email,
+				tagger_name = excluded.tagger_name`
+	_, err = tx.Exec(dbQuery, dbID, tagName, t.Commit, t.Date, t.Description, t.TaggerEmail, t.TaggerName)
+	if err != nil {
+		log.Printf("Storing tag '%s' for database '%s%s%s' failed: %v\n", tagName, dbOwner, dbFolder, dbName, err)
+		return err
+	}
+
+	// Update the tag count
+	dbQuery = `
+		UPDATE sqlite_databases
+		SET tags = (SELECT count(*) FROM database_tags WHERE db_id = $1)
+		WHERE db_id = $1`
+	_, err = tx.Exec(dbQuery, dbID)
+	if err != nil {
+		log.Printf("Updating tag count for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// Store the data validation rules for a database.
+func StoreValidationRules(dbOwner string, dbFolder string, dbName string, rules []ValidationRule) error {
 	dbQuery := `
 		UPDATE sqlite_databases
-		SET tag_list = $4, tags = $5
+		SET validation_rules = $4
 		WHERE user_id = (
 				SELECT user_id
 				FROM users
@@ -3516,18 +4712,45 @@ func StoreTags(dbOwner string, dbFolder string, dbName string, tags map[string]T
 			)
 			AND folder = $2
 			AND db_name = $3`
-	commandTag, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, tags, len(tags))
+	commandTag, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, rules)
 	if err != nil {
-		log.Printf("Storing tags for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		log.Printf("Storing validation rules for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
 		return err
 	}
 	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong number of rows (%v) affected when storing tags for database: '%s%s%s'\n", numRows,
-			dbOwner, dbFolder, dbName)
+		log.Printf("Wrong number of rows (%v) affected when storing validation rules for database: '%s%s%s'\n",
+			numRows, dbOwner, dbFolder, dbName)
 	}
 	return nil
 }
 
+// Returns the list of forks which are automatically kept in sync with their upstream database.
+func SyncedForks() (list []DBEntry, err error) {
+	dbQuery := `
+		SELECT users.user_name, db.folder, db.db_name
+		FROM sqlite_databases AS db, users
+		WHERE db.fork_sync = true
+			AND db.forked_from IS NOT NULL
+			AND db.is_deleted = false
+			AND db.user_id = users.user_id`
+	rows, err := pdb.Query(dbQuery)
+	if err != nil {
+		log.Printf("Database query failed: %v\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var oneRow DBEntry
+		err = rows.Scan(&oneRow.Owner, &oneRow.Folder, &oneRow.DBName)
+		if err != nil {
+			log.Printf("Error retrieving list of synced forks: %v\n", err)
+			return nil, err
+		}
+		list = append(list, oneRow)
+	}
+	return list, nil
+}
+
 // Toggle on or off the starring of a database by a user.
 func ToggleDBStar(loggedInUser string, dbOwner string, dbFolder string, dbName string) error {
 	// Check if the database is already starred
@@ -3729,43 +4952,93 @@ func UpdateAvatarURL(userName string, avatarURL string) error {
 	return nil
 }
 
-// Updates the contributors count for a database.
-func UpdateContributorsCount(dbOwner string, dbFolder, dbName string) error {
-	// Get the commit list for the database
-	commitList, err := GetCommitList(dbOwner, dbFolder, dbName)
+// Adds new commits to a database, and moves a branch head, in a single transaction.  The branch is only moved if it
+// still points to oldHead, so changes made since the caller read the branch aren't lost.  If it doesn't, nothing is
+// stored and a conflict error is returned.
+func UpdateBranchHead(dbOwner string, dbFolder string, dbName string, branchName string, oldHead string,
+	b BranchEntry, newCommits map[string]CommitEntry) error {
+	return updateBranchHead(dbOwner, dbFolder, dbName, branchName, oldHead, b, newCommits, nil)
+}
+
+// Does the work for UpdateBranchHead, also removing the commits in delCommits (eg those left behind when rewinding a
+// branch) in the same transaction.
+func updateBranchHead(dbOwner string, dbFolder string, dbName string, branchName string, oldHead string,
+	b BranchEntry, newCommits map[string]CommitEntry, delCommits []string) error {
+	// Begin a transaction
+	tx, err := pdb.Begin()
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback()
+
+	// Lock the database entry, so concurrent updates to the commit list and branches happen one after the other
+	dbID, err := lockDatabaseID(tx, dbOwner, dbFolder, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the database files for the new commits are still stored, and stay that way until they're saved
+	var shas []string
+	for _, c := range newCommits {
+		for _, e := range c.Tree.Entries {
+			if e.EntryType == DATABASE {
+				shas = append(shas, e.Sha256)
+			}
+		}
+	}
+	err = lockDatabaseFiles(tx, shas...)
 	if err != nil {
 		return err
 	}
 
-	// Work out the new contributor count
-	d := map[string]struct{}{}
-	for _, k := range commitList {
-		d[k.AuthorEmail] = struct{}{}
+	// Add the new commits
+	for _, c := range newCommits {
+		err = insertCommit(tx, dbID, c)
+		if err != nil {
+			log.Printf("Updating commit list for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+			return err
+		}
 	}
-	n := len(d)
 
-	// Store the new contributor count in the database
+	// Move the branch head, if it hasn't been moved by something else in the meantime
 	dbQuery := `
+		UPDATE database_branches
+		SET commit_id = $4, commit_count = $5, description = $6
+		WHERE db_id = $1
+			AND branch_name = $2
+			AND commit_id = $3`
+	commandTag, err := tx.Exec(dbQuery, dbID, branchName, oldHead, b.Commit, b.CommitCount, b.Description)
+	if err != nil {
+		log.Printf("Updating branch '%s' for database '%s%s%s' failed: %v\n", branchName, dbOwner, dbFolder,
+			dbName, err)
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return newActionError(http.StatusConflict, fmt.Sprintf("Branch '%s' was changed by something else "+
+			"while this update was being processed.  Please try again.", branchName))
+	}
+
+	// Remove any commits which are no longer needed
+	err = deleteCommits(tx, dbID, delCommits)
+	if err != nil {
+		log.Printf("Removing commits from database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName, err)
+		return err
+	}
+
+	// Update the contributor count and last modified date
+	dbQuery = `
 		UPDATE sqlite_databases
-		SET contributors = $4
-			WHERE user_id = (
-				SELECT user_id
-				FROM users
-				WHERE lower(user_name) = lower($1)
-			)
-				AND folder = $2
-				AND db_name = $3`
-	commandTag, err := pdb.Exec(dbQuery, dbOwner, dbFolder, dbName, n)
+		SET contributors = (SELECT count(DISTINCT author_email) FROM database_commits WHERE db_id = $1),
+			last_modified = now()
+		WHERE db_id = $1`
+	_, err = tx.Exec(dbQuery, dbID)
 	if err != nil {
-		log.Printf("Updating contributor count in database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName,
+		log.Printf("Updating contributor count for database '%s%s%s' failed: %v\n", dbOwner, dbFolder, dbName,
 			err)
 		return err
 	}
-	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong # of rows affected (%v) when updating contributor count for database '%s%s%s'\n",
-			numRows, dbOwner, dbFolder, dbName)
-	}
-	return nil
+	return tx.Commit()
 }
 
 // Updates the text for a comment
@@ -4018,16 +5291,18 @@ func UserDBs(userName string, public AccessType) (list []DBInfo, err error) {
 			FROM users
 			WHERE lower(user_name) = lower($1)
 		), default_commits AS (
-			SELECT DISTINCT ON (db.db_name) db_name, db.db_id, db.branch_heads->db.default_branch->>'commit' AS id
-			FROM sqlite_databases AS db, u
+			SELECT DISTINCT ON (db.db_name) db_name, db.db_id, b.commit_id AS id
+			FROM u, sqlite_databases AS db
+				LEFT JOIN database_branches AS b ON b.db_id = db.db_id AND b.branch_name = db.default_branch
 			WHERE db.user_id = u.user_id
 		), dbs AS (
 			SELECT DISTINCT ON (db.db_name) db.db_name, db.folder, db.date_created, db.last_modified, db.public,
 				db.watchers, db.stars, db.discussions, db.merge_requests, db.branches, db.release_count, db.tags,
 				db.contributors, db.one_line_description, default_commits.id,
-				db.commit_list->default_commits.id->'tree'->'entries'->0, db.source_url, db.default_branch,
-				db.download_count, db.page_views
+				c.tree->'entries'->0, db.source_url, db.default_branch, db.download_count, db.page_views
 			FROM sqlite_databases AS db, default_commits
+				LEFT JOIN database_commits AS c
+					ON c.db_id = default_commits.db_id AND c.commit_id = default_commits.id
 			WHERE db.db_id = default_commits.db_id
 				AND db.is_deleted = false`
 	switch public {
@@ -0,0 +1,158 @@
+package common
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// The ASN.1 object identifier for ed25519 keys, from RFC 8410
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// The PKCS #8 wrapping of a private key, as written by "openssl genpkey -algorithm ed25519"
+type pkcs8Key struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// The PKIX wrapping of a public key
+type pkixPublicKey struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// Returns the public half of the server release key, PEM encoded
+func ReleasePublicKey() ([]byte, error) {
+	if Conf.Sign.ReleaseKey == "" {
+		return nil, errors.New("Release signing isn't enabled on this server")
+	}
+	key, err := releaseKey()
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(pkixPublicKey{
+		Algo:      pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+		PublicKey: asn1.BitString{Bytes: key.Public().(ed25519.PublicKey), BitLength: 8 * ed25519.PublicKeySize},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// Creates the manifest for a new release, and signs it with the server release key.  The manifest JSON is kept exactly
+// as signed, so clients can check the signature against those bytes.  If no release key has been configured, the
+// release is left unsigned.
+func SignRelease(dbOwner string, dbFolder string, dbName string, relName string, rel *ReleaseEntry) error {
+	if Conf.Sign.ReleaseKey == "" {
+		rel.Manifest = ""
+		rel.Signature = ""
+		return nil
+	}
+
+	// Retrieve the details of the database file for the release commit
+	c, ok, err := GetCommit(dbOwner, dbFolder, dbName, rel.Commit)
+	if err != nil {
+		return err
+	}
+	if !ok || len(c.Tree.Entries) == 0 {
+		return fmt.Errorf("Commit '%s' not found when signing release '%s'", rel.Commit, relName)
+	}
+	m := ReleaseManifest{
+		CommitID:   rel.Commit,
+		Database:   fmt.Sprintf("%s%s%s", dbOwner, dbFolder, dbName),
+		LicenceSHA: c.Tree.Entries[0].LicenceSHA,
+		Release:    relName,
+		Sha256:     c.Tree.Entries[0].Sha256,
+		Size:       c.Tree.Entries[0].Size,
+		Timestamp:  time.Now().UTC().Truncate(time.Second),
+	}
+
+	// Sign the manifest
+	key, err := releaseKey()
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	rel.Manifest = string(msg)
+	rel.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg))
+	return nil
+}
+
+// Checks a release manifest signature against a PEM encoded public key.  The manifest is the JSON text exactly as it
+// was signed.  If the SHA256 of a downloaded database is given, it's also checked against the manifest.
+func VerifyReleaseManifest(manifest string, signature string, publicKey []byte, dbSha string) error {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return errors.New("Couldn't decode the release public key")
+	}
+	var k pkixPublicKey
+	_, err := asn1.Unmarshal(block.Bytes, &k)
+	if err != nil {
+		return err
+	}
+	if !k.Algo.Algorithm.Equal(oidEd25519) || len(k.PublicKey.Bytes) != ed25519.PublicKeySize {
+		return errors.New("Release public key isn't an ed25519 key")
+	}
+	pub := ed25519.PublicKey(k.PublicKey.Bytes)
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("Couldn't decode the release signature")
+	}
+	if !ed25519.Verify(pub, []byte(manifest), sig) {
+		return errors.New("Release signature doesn't match the manifest")
+	}
+	var m ReleaseManifest
+	err = json.Unmarshal([]byte(manifest), &m)
+	if err != nil {
+		return fmt.Errorf("Couldn't read the release manifest: %v", err)
+	}
+	if dbSha != "" && dbSha != m.Sha256 {
+		return fmt.Errorf("Database SHA256 (%s) doesn't match the release manifest (%s)", dbSha, m.Sha256)
+	}
+	return nil
+}
+
+// Loads the ed25519 private key used for signing releases
+func releaseKey() (ed25519.PrivateKey, error) {
+	keyFile, err := ioutil.ReadFile(Conf.Sign.ReleaseKey)
+	if err != nil {
+		log.Printf("Error opening release signing key: %v\n", err)
+		return nil, err
+	}
+	keyPEM, _ := pem.Decode(keyFile)
+	if keyPEM == nil {
+		log.Printf("Error when PEM decoding the release signing key\n")
+		return nil, errors.New("Couldn't decode the release signing key")
+	}
+	var k pkcs8Key
+	_, err = asn1.Unmarshal(keyPEM.Bytes, &k)
+	if err != nil {
+		log.Printf("Error when parsing the release signing key: %v\n", err)
+		return nil, err
+	}
+	if !k.Algo.Algorithm.Equal(oidEd25519) {
+		return nil, errors.New("Release signing key isn't an ed25519 key")
+	}
+
+	// The key itself is the 32 byte seed, wrapped in another octet string
+	var seed []byte
+	_, err = asn1.Unmarshal(k.PrivateKey, &seed)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("Release signing key isn't an ed25519 key")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
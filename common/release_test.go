@@ -0,0 +1,89 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Signs a release manifest with the docker test key, then checks only the exact signed manifest passes verification
+func TestReleaseManifestSignature(t *testing.T) {
+	oldKey := Conf.Sign.ReleaseKey
+	Conf.Sign.ReleaseKey = "../docker/certs/release-signing-docker.key.pem"
+	defer func() { Conf.Sign.ReleaseKey = oldKey }()
+
+	key, err := releaseKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := ReleasePublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbSha := strings.Repeat("ab", 32)
+	m := ReleaseManifest{
+		CommitID:  strings.Repeat("cd", 32),
+		Database:  "default/test.sqlite",
+		Release:   "v1",
+		Sha256:    dbSha,
+		Size:      1024,
+		Timestamp: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+	msg, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := string(msg)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg))
+
+	// The same manifest with different formatting, which has to fail as the signature covers the exact bytes
+	reformatted, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The public key for some other ed25519 key
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(pkixPublicKey{
+		Algo:      pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+		PublicKey: asn1.BitString{Bytes: otherPub, BitLength: 8 * ed25519.PublicKeySize},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	tests := []struct {
+		manifest  string
+		signature string
+		publicKey []byte
+		dbSha     string
+		ok        bool
+	}{
+		{manifest: manifest, signature: sig, publicKey: pubKey, dbSha: "", ok: true},
+		{manifest: manifest, signature: sig, publicKey: pubKey, dbSha: dbSha, ok: true},
+		{manifest: manifest, signature: sig, publicKey: pubKey, dbSha: strings.Repeat("ef", 32), ok: false},
+		{manifest: string(reformatted), signature: sig, publicKey: pubKey, dbSha: "", ok: false},
+		{manifest: strings.Replace(manifest, `"v1"`, `"v2"`, 1), signature: sig, publicKey: pubKey, ok: false},
+		{manifest: manifest, signature: sig, publicKey: otherKey, dbSha: "", ok: false},
+		{manifest: manifest, signature: "not base64!", publicKey: pubKey, dbSha: "", ok: false},
+		{manifest: manifest, signature: sig, publicKey: []byte("not a key"), dbSha: "", ok: false},
+	}
+	for i, j := range tests {
+		err = VerifyReleaseManifest(j.manifest, j.signature, j.publicKey, j.dbSha)
+		if (err == nil) != j.ok {
+			t.Errorf("VerifyReleaseManifest() case %d returned error %v, wanted ok = %v", i, err, j.ok)
+		}
+	}
+}
@@ -0,0 +1,536 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gwenn/gosqlite"
+)
+
+// Reverting and cherry picking a commit both work out the changes between two versions of a database, then apply
+// them to the head of a branch and store the result as a new commit.  A revert applies the changes from the commit
+// back to its parent, and a cherry pick applies the changes from the parent to the commit.  The commit history isn't
+// changed.  If something the changes touch doesn't match in the branch head, it's reported as a conflict rather than
+// guessing which version to keep.
+
+// Applies the changes from a commit (in the same database, or another one in its fork tree) to the head of a branch,
+// storing the result as a new commit.  Returns the ID of the new commit.
+func CherryPickCommit(r *http.Request, loggedInUser string, srcOwner string, srcFolder string, srcDBName string,
+	commitID string, dbOwner string, dbFolder string, dbName string, branchName string, serverSw string) (
+	newCommitID string, err error) {
+	// Make sure the database is owned by the logged in user. eg prevent changes to other people's databases
+	if strings.ToLower(dbOwner) != strings.ToLower(loggedInUser) {
+		return "", newActionError(http.StatusUnauthorized, "You can't change databases you don't own")
+	}
+
+	// If the commit is from a different database, it needs to be one the user can see in the same fork tree
+	sameDB := strings.ToLower(srcOwner) == strings.ToLower(dbOwner) && srcFolder == dbFolder && srcDBName == dbName
+	if !sameDB {
+		forks, err := ForkTree(loggedInUser, dbOwner, dbFolder, dbName)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, f := range forks {
+			if !f.Deleted && strings.ToLower(f.Owner) == strings.ToLower(srcOwner) && f.Folder == srcFolder &&
+				f.DBName == srcDBName {
+				found = true
+			}
+		}
+		if !found {
+			return "", newActionError(http.StatusNotFound, fmt.Sprintf("Database '%s%s%s' isn't a fork of "+
+				"'%s%s%s'", srcOwner, srcFolder, srcDBName, dbOwner, dbFolder, dbName))
+		}
+	}
+
+	// Find the source commit, which can't be the first commit in its database
+	c, ok, err := GetCommit(srcOwner, srcFolder, srcDBName, commitID)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", newActionError(http.StatusNotFound, fmt.Sprintf("Unknown commit '%s' for database '%s%s%s'",
+			commitID, srcOwner, srcFolder, srcDBName))
+	}
+	if c.Parent == "" {
+		return "", newActionError(http.StatusConflict, "The first commit of a database can't be cherry picked")
+	}
+
+	// Make sure the destination branch doesn't already have the commit
+	head, err := branchHead(dbOwner, dbFolder, dbName, branchName)
+	if err != nil {
+		return "", err
+	}
+	hist, err := commitAncestors(dbOwner, dbFolder, dbName, []string{head})
+	if err != nil {
+		return "", err
+	}
+	if hist[commitID] {
+		return "", newActionError(http.StatusConflict,
+			fmt.Sprintf("Commit '%s' is already part of branch '%s'", commitID, branchName))
+	}
+
+	// Get the database files for the commit and its parent
+	beforeFile, err := commitDBFile(loggedInUser, srcOwner, srcFolder, srcDBName, c.Parent)
+	if err != nil {
+		return "", err
+	}
+	afterFile, err := commitDBFile(loggedInUser, srcOwner, srcFolder, srcDBName, commitID)
+	if err != nil {
+		return "", err
+	}
+
+	// The original author is kept, with the user doing the cherry pick recorded as the committer
+	usr, err := User(loggedInUser)
+	if err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf("%s\n\n(cherry picked from commit %s)", strings.TrimRight(c.Message, "\n"), commitID)
+	return commitChanges(r, loggedInUser, dbOwner, dbFolder, dbName, branchName, head, beforeFile, afterFile, msg,
+		c.AuthorName, c.AuthorEmail, usr.DisplayName, usr.Email, serverSw)
+}
+
+// Reverts a commit on a branch, by adding a new commit to the branch which undoes its changes.  Returns the ID of the
+// new commit.
+func RevertCommit(r *http.Request, loggedInUser string, dbOwner string, dbFolder string, dbName string,
+	branchName string, commitID string, serverSw string) (newCommitID string, err error) {
+	// Make sure the database is owned by the logged in user. eg prevent changes to other people's databases
+	if strings.ToLower(dbOwner) != strings.ToLower(loggedInUser) {
+		return "", newActionError(http.StatusUnauthorized, "You can't change databases you don't own")
+	}
+
+	// Make sure the commit is part of the branch, and isn't the first commit in the database
+	head, err := branchHead(dbOwner, dbFolder, dbName, branchName)
+	if err != nil {
+		return "", err
+	}
+	hist, err := commitAncestors(dbOwner, dbFolder, dbName, []string{head})
+	if err != nil {
+		return "", err
+	}
+	c, ok, err := GetCommit(dbOwner, dbFolder, dbName, commitID)
+	if err != nil {
+		return "", err
+	}
+	if !ok || !hist[commitID] {
+		return "", newActionError(http.StatusNotFound,
+			fmt.Sprintf("Commit '%s' isn't part of branch '%s'", commitID, branchName))
+	}
+	if c.Parent == "" {
+		return "", newActionError(http.StatusConflict, "The first commit of a database can't be reverted")
+	}
+
+	// Get the database files for the commit and its parent
+	beforeFile, err := commitDBFile(loggedInUser, dbOwner, dbFolder, dbName, commitID)
+	if err != nil {
+		return "", err
+	}
+	afterFile, err := commitDBFile(loggedInUser, dbOwner, dbFolder, dbName, c.Parent)
+	if err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.", strings.SplitN(c.Message, "\n", 2)[0],
+		commitID)
+	return commitChanges(r, loggedInUser, dbOwner, dbFolder, dbName, branchName, head, beforeFile, afterFile, msg,
+		"", "", "", "", serverSw)
+}
+
+// Applies the changes between the "before" and "after" versions of a database to another database file
+func applyChanges(fileName string, beforeFile string, afterFile string) error {
+	beforeSchema, err := fileSchema(beforeFile)
+	if err != nil {
+		return err
+	}
+	afterSchema, err := fileSchema(afterFile)
+	if err != nil {
+		return err
+	}
+	sdb, err := sqlite.Open(fileName, sqlite.OpenReadWrite|sqlite.OpenFullMutex)
+	if err != nil {
+		log.Printf("Couldn't open database when applying changes: %s", err)
+		return err
+	}
+	defer sdb.Close()
+	headSchema, err := ReadSQLiteSchema(sdb)
+	if err != nil {
+		return err
+	}
+	err = sdb.Exec(`ATTACH DATABASE ? AS before`, beforeFile)
+	if err == nil {
+		err = sdb.Exec(`ATTACH DATABASE ? AS after`, afterFile)
+	}
+	if err != nil {
+		log.Printf("Couldn't attach databases when applying changes: %s", err)
+		return err
+	}
+
+	err = sdb.Begin()
+	if err != nil {
+		return err
+	}
+	conflicts, err := applySchemaChanges(sdb, schemaObjects(beforeSchema), schemaObjects(afterSchema),
+		schemaObjects(headSchema))
+	if err == nil && len(conflicts) > 0 {
+		err = newActionError(http.StatusConflict, "The changes can't be applied automatically, as these have "+
+			"been changed on the branch:\n  "+strings.Join(conflicts, "\n  "))
+	}
+	if err != nil {
+		sdb.Rollback()
+		return err
+	}
+	return sdb.Commit()
+}
+
+// Applies the row changes between the "before" and "after" versions of a table to the main database.  Rows are
+// matched up by their rowid.  If any of the rows don't match their "before" version in the main database, nothing is
+// changed and a description of the conflict is returned instead.
+func applyRowChanges(sdb *sqlite.Conn, tbl SchemaObject) (conflict string, err error) {
+	if !hasRowID(sdb, tbl.Name) {
+		diff, err := tableDiffers(sdb, tbl.Name)
+		if err != nil || !diff {
+			return "", err
+		}
+		return fmt.Sprintf("table '%s' (changes to WITHOUT ROWID tables can't be applied)", tbl.Name), nil
+	}
+	t := func(schema string) string {
+		return schema + sqlite.Mprintf(`."%w"`, tbl.Name)
+	}
+	var cols, afterCols, sets []string
+	for _, c := range tbl.Columns {
+		col := sqlite.Mprintf(`"%w"`, c.Name)
+		cols = append(cols, col)
+		afterCols = append(afterCols, "dbhub_a."+col)
+		sets = append(sets, col+" = (SELECT dbhub_a."+col+" FROM "+t("after")+
+			" AS dbhub_a WHERE dbhub_a.rowid = "+sqlite.Mprintf(`"%w"`, tbl.Name)+".rowid)")
+	}
+	removed := `SELECT rowid FROM ` + t("before") + ` WHERE rowid NOT IN (SELECT rowid FROM ` + t("after") + `)`
+	added := `SELECT rowid FROM ` + t("after") + ` WHERE rowid NOT IN (SELECT rowid FROM ` + t("before") + `)`
+	changed := `SELECT dbhub_a.rowid FROM ` + t("after") + ` AS dbhub_a
+		JOIN ` + t("before") + ` AS dbhub_b ON dbhub_b.rowid = dbhub_a.rowid
+		WHERE NOT (` + rowsMatch(tbl.Columns, "dbhub_a", "dbhub_b") + `)`
+
+	// Make sure the rows being removed or changed still have their "before" values, and the rows being added aren't
+	// already there with different values
+	var n int
+	err = sdb.OneValue(`SELECT
+			(SELECT count(*) FROM `+t("before")+` AS dbhub_b
+				JOIN `+t("main")+` AS dbhub_m ON dbhub_m.rowid = dbhub_b.rowid
+				WHERE dbhub_b.rowid IN (`+removed+`)
+					AND NOT (`+rowsMatch(tbl.Columns, "dbhub_m", "dbhub_b")+`)) +
+			(SELECT count(*) FROM `+t("after")+` AS dbhub_a
+				JOIN `+t("main")+` AS dbhub_m ON dbhub_m.rowid = dbhub_a.rowid
+				WHERE dbhub_a.rowid IN (`+added+`)
+					AND NOT (`+rowsMatch(tbl.Columns, "dbhub_m", "dbhub_a")+`)) +
+			(SELECT count(*) FROM `+t("before")+` AS dbhub_b
+				LEFT JOIN `+t("main")+` AS dbhub_m ON dbhub_m.rowid = dbhub_b.rowid
+				WHERE dbhub_b.rowid IN (`+changed+`)
+					AND (dbhub_m.rowid IS NULL OR NOT (`+rowsMatch(tbl.Columns, "dbhub_m", "dbhub_b")+`)))`,
+		&n)
+	if err != nil {
+		log.Printf("Error when checking rows of table '%s' before applying changes: %s", tbl.Name, err)
+		return "", err
+	}
+	if n > 0 {
+		return fmt.Sprintf("table '%s' (%d row(s))", tbl.Name, n), nil
+	}
+
+	// Remove the removed rows, add the added ones, and update the changed ones
+	err = sdb.Exec(`DELETE FROM ` + t("main") + ` WHERE rowid IN (` + removed + `)`)
+	if err == nil {
+		err = sdb.Exec(`INSERT INTO ` + t("main") + ` (rowid, ` + strings.Join(cols, ", ") + `)
+			SELECT dbhub_a.rowid, ` + strings.Join(afterCols, ", ") + ` FROM ` + t("after") + ` AS dbhub_a
+			WHERE dbhub_a.rowid IN (` + added + `) AND dbhub_a.rowid NOT IN (SELECT rowid FROM ` + t("main") + `)`)
+	}
+	if err == nil {
+		err = sdb.Exec(`UPDATE ` + t("main") + ` SET ` + strings.Join(sets, ", ") + ` WHERE rowid IN (` + changed + `)`)
+	}
+	if err != nil {
+		log.Printf("Error when applying changes to rows of table '%s': %s", tbl.Name, err)
+		return "", err
+	}
+	return "", nil
+}
+
+// Applies the schema and data changes between the "before" and "after" attached databases to the main database.
+// Returns the list of conflicts found, in which case the transaction needs to be rolled back.
+func applySchemaChanges(sdb *sqlite.Conn, beforeObjs map[string]schemaObject, afterObjs map[string]schemaObject,
+	headObjs map[string]schemaObject) (conflicts []string, err error) {
+	conflict := func(o schemaObject) {
+		conflicts = append(conflicts, fmt.Sprintf("%s '%s'", o.Type, o.Name))
+	}
+
+	// Remove indexes, triggers, and views which were removed or changed, then tables which were removed
+	for _, pass := range []bool{false, true} {
+		for name, b := range beforeObjs {
+			if (b.Type == "table") != pass {
+				continue
+			}
+			a, inAfter := afterObjs[name]
+			if inAfter && a.SQL == b.SQL {
+				continue
+			}
+			h, inHead := headObjs[name]
+			if !inHead {
+				continue
+			}
+			if h.SQL != b.SQL {
+				conflict(b)
+				continue
+			}
+			if b.Type == "table" && inAfter {
+				// The table definition was changed, which isn't something we can apply reliably
+				conflicts = append(conflicts, fmt.Sprintf("table '%s' (table definition changes can't be applied)",
+					name))
+				continue
+			}
+			err = sdb.Exec(fmt.Sprintf(`DROP %s `, strings.ToUpper(b.Type)) + sqlite.Mprintf(`main."%w"`, name))
+			if err != nil {
+				return
+			}
+			delete(headObjs, name)
+			if b.Type == "table" {
+				// Dropping a table also drops its indexes and triggers
+				for hName, h := range headObjs {
+					if h.Table == name {
+						delete(headObjs, hName)
+					}
+				}
+			}
+		}
+	}
+
+	// Triggers in the head database are removed while the rows are changed, so they don't make changes of their own
+	var triggers []string
+	for name, h := range headObjs {
+		if h.Type != "trigger" {
+			continue
+		}
+		err = sdb.Exec(sqlite.Mprintf(`DROP TRIGGER main."%w"`, name))
+		if err != nil {
+			return
+		}
+		triggers = append(triggers, h.SQL)
+	}
+
+	// Apply the row changes for tables which are in both versions
+	for name, a := range afterObjs {
+		b, inBefore := beforeObjs[name]
+		if a.Type != "table" || !inBefore || a.SQL != b.SQL {
+			continue
+		}
+		h, inHead := headObjs[name]
+		if !inHead || h.SQL != b.SQL {
+			// The table is different in the head database, which is only a problem if its data was changed
+			var diff bool
+			diff, err = tableDiffers(sdb, name)
+			if err != nil {
+				return
+			}
+			if diff {
+				conflict(a)
+			}
+			continue
+		}
+		var c string
+		c, err = applyRowChanges(sdb, a.SchemaObject)
+		if err != nil {
+			return
+		}
+		if c != "" {
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	// Create tables which were added, then indexes, triggers, and views which were added or changed
+	for _, pass := range []bool{true, false} {
+		for name, a := range afterObjs {
+			if (a.Type == "table") != pass {
+				continue
+			}
+			b, inBefore := beforeObjs[name]
+			if inBefore && a.SQL == b.SQL {
+				continue
+			}
+			if _, inHead := headObjs[name]; inHead {
+				conflict(a)
+				continue
+			}
+			if len(conflicts) > 0 {
+				// Nothing will be kept, so there's no point in doing the work
+				continue
+			}
+			err = sdb.Exec(a.SQL)
+			if err == nil && a.Type == "table" {
+				err = sdb.Exec(sqlite.Mprintf2(`INSERT INTO main."%w" SELECT * FROM after."%w"`, name, name))
+			}
+			if err != nil {
+				log.Printf("Error when creating %s '%s' while applying changes: %s", a.Type, name, err)
+				return
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return
+	}
+
+	// Put back the triggers from the head database
+	for _, sql := range triggers {
+		err = sdb.Exec(sql)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Returns the head commit of a branch
+func branchHead(dbOwner string, dbFolder string, dbName string, branchName string) (string, error) {
+	branches, err := GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		return "", err
+	}
+	b, ok := branches[branchName]
+	if !ok {
+		return "", newActionError(http.StatusBadRequest, "Unknown branch name")
+	}
+	return b.Commit, nil
+}
+
+// Applies the changes between the "before" and "after" database files to the head of a branch, then stores the
+// result as a new commit on the branch.  Empty author and committer details use those of the logged in user.
+func commitChanges(r *http.Request, loggedInUser string, dbOwner string, dbFolder string, dbName string,
+	branchName string, head string, beforeFile string, afterFile string, msg string, authorName string,
+	authorEmail string, committerName string, committerEmail string, serverSw string) (newCommitID string,
+	err error) {
+	headFile, err := commitDBFile(loggedInUser, dbOwner, dbFolder, dbName, head)
+	if err != nil {
+		return "", err
+	}
+
+	// Apply the changes to a copy of the head database
+	tempDB, err := ioutil.TempFile(Conf.DiskCache.Directory, "dbhub-changes-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempDB.Name())
+	defer tempDB.Close()
+	err = copyFile(headFile, tempDB)
+	if err != nil {
+		return "", err
+	}
+	err = applyChanges(tempDB.Name(), beforeFile, afterFile)
+	if err != nil {
+		return "", err
+	}
+	_, err = tempDB.Seek(0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	// Use the existing database settings for the new commit
+	var db SQLiteDBinfo
+	err = DBDetails(&db, loggedInUser, dbOwner, dbFolder, dbName, head)
+	if err != nil {
+		return "", err
+	}
+
+	// Make sure nothing was added to the branch while we were working, as AddDatabase() would drop it
+	newHead, err := branchHead(dbOwner, dbFolder, dbName, branchName)
+	if err != nil {
+		return "", err
+	}
+	if newHead != head {
+		return "", newActionError(http.StatusConflict, "The branch was changed while the changes were being "+
+			"applied.  Please try again")
+	}
+
+	// Store the result as a new commit on the branch
+	_, newCommitID, failures, err := AddDatabase(r, loggedInUser, dbOwner, dbFolder, dbName, false, branchName,
+		head, db.Info.Public, "", msg, db.Info.SourceURL, tempDB, serverSw, time.Now(), time.Time{}, authorName,
+		authorEmail, committerName, committerEmail, nil, "")
+	if err != nil {
+		if failures != nil {
+			return "", newActionError(http.StatusConflict, err.Error())
+		}
+		return "", err
+	}
+	return newCommitID, nil
+}
+
+// Returns the path to the database file for a commit in the disk cache, fetching it from storage if needed
+func commitDBFile(loggedInUser string, dbOwner string, dbFolder string, dbName string, commitID string) (string,
+	error) {
+	bkt, id, _, err := MinioLocation(dbOwner, dbFolder, dbName, commitID, loggedInUser)
+	if err != nil {
+		return "", err
+	}
+	sdb, err := OpenMinioObject(bkt, id)
+	if err != nil {
+		return "", err
+	}
+	sdb.Close()
+	return filepath.Join(Conf.DiskCache.Directory, bkt, id), nil
+}
+
+// Copies the contents of a file into an (open) destination file
+func copyFile(src string, dest *os.File) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = dest.ReadFrom(f)
+	return err
+}
+
+// Reads the schema of a database file
+func fileSchema(fileName string) (schema DBSchema, err error) {
+	sdb, err := sqlite.Open(fileName, sqlite.OpenReadOnly)
+	if err != nil {
+		log.Printf("Couldn't open database when reading schema: %s", err)
+		return DBSchema{}, err
+	}
+	defer sdb.Close()
+	return ReadSQLiteSchema(sdb)
+}
+
+// Returns the SQL to check if all of the columns of a row in table "a" match those of a row in table "b"
+func rowsMatch(cols []SchemaColumn, a string, b string) string {
+	var m []string
+	for _, c := range cols {
+		m = append(m, sqlite.Mprintf2(`%s."%w"`, a, c.Name)+sqlite.Mprintf2(` IS %s."%w"`, b, c.Name))
+	}
+	return strings.Join(m, " AND ")
+}
+
+// An object from a database schema, along with its type
+type schemaObject struct {
+	SchemaObject
+	Type string
+}
+
+// Returns the objects in a database schema, keyed by name
+func schemaObjects(schema DBSchema) map[string]schemaObject {
+	objs := make(map[string]schemaObject)
+	for t, lst := range map[string][]SchemaObject{"index": schema.Indexes, "table": schema.Tables,
+		"trigger": schema.Triggers, "view": schema.Views} {
+		for _, o := range lst {
+			objs[o.Name] = schemaObject{o, t}
+		}
+	}
+	return objs
+}
+
+// Checks if the contents of a table differ between the "before" and "after" attached databases
+func tableDiffers(sdb *sqlite.Conn, tblName string) (bool, error) {
+	b := sqlite.Mprintf(`before."%w"`, tblName)
+	a := sqlite.Mprintf(`after."%w"`, tblName)
+	return sdb.Exists(`SELECT * FROM (SELECT * FROM ` + b + ` EXCEPT SELECT * FROM ` + a + `)
+		UNION ALL SELECT * FROM (SELECT * FROM ` + a + ` EXCEPT SELECT * FROM ` + b + `)`)
+}
@@ -0,0 +1,150 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// Creates a SQLite database for testing, running the given statements in it
+func createTestDB(t *testing.T, fileName string, stmts []string) {
+	sdb, err := sqlite.Open(fileName, sqlite.OpenReadWrite|sqlite.OpenCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+	for _, j := range stmts {
+		err = sdb.Exec(j)
+		if err != nil {
+			t.Fatalf("Error when running '%s': %v", j, err)
+		}
+	}
+}
+
+// Checks reverting and cherry picking a commit applies its changes when they don't clash with the branch head, and
+// reports them as conflicts when they do
+func TestApplyChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbhub-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := []string{
+		`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`,
+		`INSERT INTO people VALUES (1, 'alice'), (2, 'bob'), (3, 'carol')`,
+	}
+	people := `SELECT group_concat(id || ':' || name, ',') FROM (SELECT id, name FROM people ORDER BY id)`
+	objects := `SELECT ifnull(group_concat(name, ','), '') FROM (SELECT name FROM sqlite_master ORDER BY name)`
+	addPets := []string{`CREATE TABLE pets (name TEXT)`, `INSERT INTO pets VALUES ('rex')`}
+
+	// The commit being reverted or cherry picked makes the "changes" to the base database.  The head of the branch
+	// they're applied to makes the "head" changes to the base database, which for a revert includes the commit.
+	tests := []struct {
+		name     string
+		changes  []string
+		head     []string
+		revert   bool
+		conflict bool
+		check    string
+		want     string
+	}{
+		{name: "change row", changes: []string{`UPDATE people SET name = 'bob2' WHERE id = 2`},
+			check: people, want: "1:alice,2:bob2,3:carol"},
+		{name: "change row, other row changed on branch",
+			changes: []string{`UPDATE people SET name = 'bob2' WHERE id = 2`},
+			head:    []string{`UPDATE people SET name = 'alice2' WHERE id = 1`},
+			check:   people, want: "1:alice2,2:bob2,3:carol"},
+		{name: "change row, same row changed on branch",
+			changes: []string{`UPDATE people SET name = 'bob2' WHERE id = 2`},
+			head:    []string{`UPDATE people SET name = 'robert' WHERE id = 2`}, conflict: true},
+		{name: "change row, table definition changed on branch",
+			changes: []string{`UPDATE people SET name = 'bob2' WHERE id = 2`},
+			head:    []string{`ALTER TABLE people ADD COLUMN age INTEGER`}, conflict: true},
+		{name: "add row", changes: []string{`INSERT INTO people VALUES (4, 'dave')`},
+			check: people, want: "1:alice,2:bob,3:carol,4:dave"},
+		{name: "add row, already added on branch", changes: []string{`INSERT INTO people VALUES (4, 'dave')`},
+			head: []string{`INSERT INTO people VALUES (4, 'dave')`}, check: people,
+			want: "1:alice,2:bob,3:carol,4:dave"},
+		{name: "add row, rowid used on branch", changes: []string{`INSERT INTO people VALUES (4, 'dave')`},
+			head: []string{`INSERT INTO people VALUES (4, 'eve')`}, conflict: true},
+		{name: "delete row", changes: []string{`DELETE FROM people WHERE id = 3`},
+			check: people, want: "1:alice,2:bob"},
+		{name: "delete row, already deleted on branch", changes: []string{`DELETE FROM people WHERE id = 3`},
+			head: []string{`DELETE FROM people WHERE id = 3`}, check: people, want: "1:alice,2:bob"},
+		{name: "delete row, changed on branch", changes: []string{`DELETE FROM people WHERE id = 3`},
+			head: []string{`UPDATE people SET name = 'caroline' WHERE id = 3`}, conflict: true},
+		{name: "add table", changes: addPets, check: objects, want: "people,pets"},
+		{name: "add table, name used on branch", changes: addPets,
+			head: []string{`CREATE TABLE pets (id INTEGER)`}, conflict: true},
+		{name: "drop table", changes: []string{`DROP TABLE people`}, check: objects, want: ""},
+		{name: "drop table, changed on branch", changes: []string{`DROP TABLE people`},
+			head: []string{`ALTER TABLE people ADD COLUMN age INTEGER`}, conflict: true},
+		{name: "change table definition", changes: []string{`ALTER TABLE people ADD COLUMN age INTEGER`},
+			conflict: true},
+		{name: "add index", changes: []string{`CREATE INDEX people_name ON people (name)`},
+			check: objects, want: "people,people_name"},
+		{name: "revert row change", revert: true,
+			changes: []string{`UPDATE people SET name = 'bob2' WHERE id = 2`},
+			head: []string{`UPDATE people SET name = 'bob2' WHERE id = 2`,
+				`UPDATE people SET name = 'alice2' WHERE id = 1`},
+			check: people, want: "1:alice2,2:bob,3:carol"},
+		{name: "revert row change, changed again later", revert: true,
+			changes: []string{`UPDATE people SET name = 'bob2' WHERE id = 2`},
+			head: []string{`UPDATE people SET name = 'bob2' WHERE id = 2`,
+				`UPDATE people SET name = 'bob3' WHERE id = 2`},
+			conflict: true},
+		{name: "revert added row", revert: true, changes: []string{`INSERT INTO people VALUES (4, 'dave')`},
+			head: []string{`INSERT INTO people VALUES (4, 'dave')`}, check: people, want: "1:alice,2:bob,3:carol"},
+		{name: "revert deleted row", revert: true, changes: []string{`DELETE FROM people WHERE id = 3`},
+			head: []string{`DELETE FROM people WHERE id = 3`}, check: people, want: "1:alice,2:bob,3:carol"},
+		{name: "revert deleted row, rowid reused later", revert: true,
+			changes:  []string{`DELETE FROM people WHERE id = 3`},
+			head:     []string{`DELETE FROM people WHERE id = 3`, `INSERT INTO people VALUES (3, 'zed')`},
+			conflict: true},
+		{name: "revert added table", revert: true, changes: addPets, head: addPets, check: objects, want: "people"},
+	}
+	for i, j := range tests {
+		parentFile := filepath.Join(dir, fmt.Sprintf("%d-parent.sqlite", i))
+		commitFile := filepath.Join(dir, fmt.Sprintf("%d-commit.sqlite", i))
+		headFile := filepath.Join(dir, fmt.Sprintf("%d-head.sqlite", i))
+		createTestDB(t, parentFile, base)
+		createTestDB(t, commitFile, append(append([]string{}, base...), j.changes...))
+		createTestDB(t, headFile, append(append([]string{}, base...), j.head...))
+
+		// A revert applies the changes from the commit back to its parent, a cherry pick the other way around
+		if j.revert {
+			err = applyChanges(headFile, commitFile, parentFile)
+		} else {
+			err = applyChanges(headFile, parentFile, commitFile)
+		}
+		if j.conflict {
+			if actionErrorStatus(err) != http.StatusConflict {
+				t.Errorf("%s: wanted a conflict, but applyChanges() returned error %v", j.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: applyChanges() returned error %v", j.name, err)
+			continue
+		}
+		sdb, err := sqlite.Open(headFile, sqlite.OpenReadOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		err = sdb.OneValue(j.check, &got)
+		sdb.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != j.want {
+			t.Errorf("%s: applying the changes gave %q, wanted %q", j.name, got, j.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gwenn/gosqlite"
+)
+
+// Runs the data validation rules for a database against a (candidate) database file, returning the rules which
+// failed.  The rules need to have been validated with ValidateValidationRules() first.
+func CheckValidationRules(sdb *sqlite.Conn, rules []ValidationRule) (failures []ValidationFailure, err error) {
+	for _, rule := range rules {
+		// Rules can run user supplied SQL, so they're interrupted if they take too long
+		stop := interruptAfter(sdb, MaxQueryTime)
+		var msg string
+		switch rule.Type {
+		case "query":
+			msg, err = checkRuleQuery(sdb, rule.Query)
+		case "table":
+			msg, err = checkRuleTable(sdb, rule.Table, nil)
+		case "columns":
+			msg, err = checkRuleTable(sdb, rule.Table, rule.Columns)
+		case "foreignkeys":
+			var found bool
+			found, err = queryHasRows(sdb, "PRAGMA foreign_key_check")
+			if found {
+				msg = "Foreign key violations found"
+			}
+		case "unique":
+			msg, err = checkRuleTable(sdb, rule.Table, rule.Columns)
+			if err == nil && msg == "" {
+				var cols []string
+				for _, c := range rule.Columns {
+					cols = append(cols, sqlite.Mprintf(`"%w"`, c))
+				}
+				var found bool
+				found, err = queryHasRows(sdb, sqlite.Mprintf(`SELECT 1 FROM "%w" GROUP BY `, rule.Table)+
+					strings.Join(cols, ", ")+" HAVING count(*) > 1 LIMIT 1")
+				if found {
+					msg = fmt.Sprintf("Duplicate values found in %s", strings.Join(rule.Columns, ", "))
+				}
+			}
+		default:
+			err = fmt.Errorf("Unknown validation rule type '%s'", rule.Type)
+		}
+		if stop() {
+			log.Printf("Validation rule '%s' was interrupted after %v\n", rule.Name, MaxQueryTime)
+			return nil, fmt.Errorf("Validation rule '%s' took longer than %v to run", rule.Name, MaxQueryTime)
+		}
+		if err != nil {
+			log.Printf("Error when running validation rule '%s': %v\n", rule.Name, err)
+			return nil, fmt.Errorf("Error when running validation rule '%s': %v", rule.Name, err)
+		}
+		if msg != "" {
+			failures = append(failures, ValidationFailure{Message: msg, Rejected: rule.Reject, Rule: rule.Name})
+		}
+	}
+	return
+}
+
+// Returns an error listing the failed validation rules which reject a commit, or nil if there are none
+func ValidationError(failures []ValidationFailure) error {
+	var msgs []string
+	for _, j := range failures {
+		if j.Rejected {
+			msgs = append(msgs, fmt.Sprintf("'%s': %s", j.Rule, j.Message))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Database failed validation rules. %s", strings.Join(msgs, ". "))
+}
+
+// Runs a user supplied query which must return no rows.  Only single, read only, SELECT statements are allowed.
+func checkRuleQuery(sdb *sqlite.Conn, query string) (msg string, err error) {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	if !strings.HasPrefix(q, "SELECT") && !strings.HasPrefix(q, "WITH") {
+		return "", errors.New("Only SELECT queries can be used")
+	}
+	stmt, err := sdb.Prepare(query)
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Finalize()
+	if strings.TrimSpace(stmt.Tail) != "" {
+		return "", errors.New("Only a single statement can be used")
+	}
+	if !stmt.ReadOnly() {
+		return "", errors.New("Only read only statements can be used")
+	}
+	found, err := stmt.Next()
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return "Query returned rows", nil
+	}
+	return "", nil
+}
+
+// Checks a table exists, and that it has the given columns
+func checkRuleTable(sdb *sqlite.Conn, table string, columns []string) (msg string, err error) {
+	exists, err := sdb.Exists(`SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?`, table)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return fmt.Sprintf("Table '%s' doesn't exist", table), nil
+	}
+	if len(columns) == 0 {
+		return "", nil
+	}
+	cols, err := sdb.Columns("", table)
+	if err != nil {
+		return "", err
+	}
+	present := make(map[string]struct{})
+	for _, c := range cols {
+		present[c.Name] = struct{}{}
+	}
+	var missing []string
+	for _, c := range columns {
+		if _, ok := present[c]; !ok {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("Table '%s' is missing column(s) %s", table, strings.Join(missing, ", ")), nil
+	}
+	return "", nil
+}
+
+// Runs the data validation rules against a database file, such as a new upload
+func checkValidationRulesFile(fileName string, rules []ValidationRule) ([]ValidationFailure, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	sdb, err := sqlite.Open(fileName, sqlite.OpenReadOnly)
+	if err != nil {
+		log.Printf("Couldn't open database when checking validation rules: %s", err)
+		return nil, errors.New("Internal error when checking validation rules")
+	}
+	defer sdb.Close()
+	return CheckValidationRules(sdb, rules)
+}
+
+// Returns true if a query returns at least one row
+func queryHasRows(sdb *sqlite.Conn, query string) (bool, error) {
+	stmt, err := sdb.Prepare(query)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Finalize()
+	return stmt.Next()
+}
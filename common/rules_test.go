@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+)
+
+// Checks rule lists are rejected when a rule is missing the fields its type needs, or names something invalid
+func TestValidateValidationRules(t *testing.T) {
+	tests := []struct {
+		rules []ValidationRule
+		ok    bool
+	}{
+		{rules: nil, ok: true},
+		{rules: []ValidationRule{{Name: "Has people", Type: "table", Table: "people"}}, ok: true},
+		{rules: []ValidationRule{{Name: "Odd table", Type: "table", Table: `my "odd" table ✓`}}, ok: true},
+		{rules: []ValidationRule{{Name: "Internal", Type: "table", Table: "sqlite_sequence"}}, ok: false},
+		{rules: []ValidationRule{{Name: "Control", Type: "table", Table: "bad\x00table"}}, ok: false},
+		{rules: []ValidationRule{{Name: "No table", Type: "table"}}, ok: false},
+		{rules: []ValidationRule{{Name: "Cols", Type: "columns", Table: "people", Columns: []string{"id", "name"}}}, ok: true},
+		{rules: []ValidationRule{{Name: "No cols", Type: "columns", Table: "people"}}, ok: false},
+		{rules: []ValidationRule{{Name: "Bad col", Type: "unique", Table: "people", Columns: []string{"id;"}}}, ok: false},
+		{rules: []ValidationRule{{Name: "Unique, no table", Type: "unique", Columns: []string{"id"}}}, ok: false},
+		{rules: []ValidationRule{{Name: "Adults", Type: "query", Query: "SELECT 1 FROM people WHERE age < 18"}}, ok: true},
+		{rules: []ValidationRule{{Name: "No query", Type: "query"}}, ok: false},
+		{rules: []ValidationRule{{Name: "Keys", Type: "foreignkeys"}}, ok: true},
+		{rules: []ValidationRule{{Name: "Unknown", Type: "magic"}}, ok: false},
+		{rules: []ValidationRule{{Type: "foreignkeys"}}, ok: false},
+		{rules: []ValidationRule{
+			{Name: "Keys", Type: "foreignkeys"},
+			{Name: "Keys", Type: "table", Table: "people"},
+		}, ok: false},
+	}
+	for _, j := range tests {
+		err := ValidateValidationRules(j.rules)
+		if (err == nil) != j.ok {
+			t.Errorf("ValidateValidationRules(%+v) returned error %v, wanted ok = %v", j.rules, err, j.ok)
+		}
+	}
+}
@@ -1,37 +1,273 @@
 package common
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"log"
+	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gwenn/gosqlite"
 )
 
-// Returns the number of rows in a SQLite table.
-func GetSQLiteRowCount(sdb *sqlite.Conn, dbTable string) (int, error) {
-	dbQuery := `SELECT count(*) FROM "` + dbTable + `"`
+// The filter types accepted in where clauses, and the SQL operators they map to
+var whereClauseTypes = map[string]string{
+	"contains": "LIKE",
+	"eq":       "=",
+	"ge":       ">=",
+	"gt":       ">",
+	"le":       "<=",
+	"lt":       "<",
+	"ne":       "<>",
+	"notnull":  "IS NOT NULL",
+	"null":     "IS NULL",
+}
+
+// A position in the rows of a table, used for keyset pagination.  It's given to clients as an opaque string
+type tableCursor struct {
+	Dir       string  `json:"d"` // "next", "prev", or "last"
+	Offset    int     `json:"o"`
+	RowID     int64   `json:"r"`
+	SortCol   string  `json:"c"`
+	SortDir   string  `json:"s"`
+	Value     string  `json:"v"`
+	ValueType ValType `json:"t"`
+}
+
+// Returns the SQL condition (and values to bind) matching the rows past the cursor position, in the cursor direction
+func (c tableCursor) condition() (cond string, args []interface{}, err error) {
+	// Work out the direction the rows are being read in
+	asc := c.SortCol == "" || c.SortDir != "DESC"
+	if c.Dir == "prev" {
+		asc = !asc
+	}
+	cmp := ">"
+	if !asc {
+		cmp = "<"
+	}
+
+	// Without a sort column, the rowid alone determines the position
+	if c.SortCol == "" {
+		return "rowid " + cmp + " ?", []interface{}{c.RowID}, nil
+	}
+
+	// NULLs sort before all other values in SQLite, so need special handling
+	col := sqlite.Mprintf(`"%w"`, c.SortCol)
+	if c.ValueType == Null {
+		if asc {
+			return fmt.Sprintf("(%s IS NULL AND rowid > ?) OR %s IS NOT NULL", col, col), []interface{}{c.RowID}, nil
+		}
+		return fmt.Sprintf("%s IS NULL AND rowid < ?", col), []interface{}{c.RowID}, nil
+	}
+	var val interface{}
+	switch c.ValueType {
+	case Integer:
+		val, err = strconv.ParseInt(c.Value, 10, 64)
+	case Float:
+		val, err = strconv.ParseFloat(c.Value, 64)
+	case Binary:
+		val, err = base64.StdEncoding.DecodeString(c.Value)
+	default:
+		val = c.Value
+	}
+	if err != nil {
+		return "", nil, errors.New("Invalid cursor")
+	}
+	cond = fmt.Sprintf("%s %s ? OR (%s = ? AND rowid %s ?)", col, cmp, col, cmp)
+	if !asc {
+		cond += fmt.Sprintf(" OR %s IS NULL", col)
+	}
+	return cond, []interface{}{val, val, c.RowID}, nil
+}
+
+// Returns the opaque string form of a cursor
+func (c tableCursor) encode() string {
+	j, err := json.Marshal(c)
+	if err != nil {
+		log.Printf("Error when encoding table cursor: %v\n", err)
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(j)
+}
+
+// Decodes (and validates) a cursor string given to us by a client
+func decodeTableCursor(cursor string) (c tableCursor, err error) {
+	j, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return tableCursor{}, errors.New("Invalid cursor")
+	}
+	err = json.Unmarshal(j, &c)
+	if err != nil {
+		return tableCursor{}, errors.New("Invalid cursor")
+	}
+	if c.Dir != "next" && c.Dir != "prev" && c.Dir != "last" {
+		return tableCursor{}, errors.New("Invalid cursor")
+	}
+	if c.SortCol != "" && ValidateFieldName(c.SortCol) != nil {
+		return tableCursor{}, errors.New("Invalid cursor")
+	}
+	if c.SortDir != "" && c.SortDir != "ASC" && c.SortDir != "DESC" {
+		return tableCursor{}, errors.New("Invalid cursor")
+	}
+	if c.Offset < 0 {
+		return tableCursor{}, errors.New("Invalid cursor")
+	}
+	return c, nil
+}
+
+// Returns the number of rows in a SQLite table, matching the given filter conditions (if any).
+func GetSQLiteRowCount(sdb *sqlite.Conn, dbTable string, filters []WhereClause) (int, error) {
+	// Row counts are cached, as the database files never change once stored
 	var rowCount int
-	err := sdb.OneValue(dbQuery, &rowCount)
+	cacheKey := RowCountCacheKey(sdb.Filename("main"), dbTable, filters)
+	if cacheKey != "" {
+		ok, err := GetCachedData(cacheKey, &rowCount)
+		if err != nil {
+			log.Printf("Error retrieving row count from cache: %v\n", err)
+		}
+		if ok {
+			return rowCount, nil
+		}
+	}
+
+	where, args := whereClauseSQL(filters)
+	dbQuery := sqlite.Mprintf(`SELECT count(*) FROM "%w"`, dbTable) + where
+	err := sdb.OneValue(dbQuery, &rowCount, args...)
 	if err != nil {
 		log.Printf("Error occurred when counting total rows for table '%s'.  Error: %s\n", dbTable, err)
 		return 0, errors.New("Database query failure")
 	}
+
+	// Cache the row count
+	if cacheKey != "" {
+		err = CacheData(cacheKey, rowCount, Conf.Memcache.DefaultCacheTime)
+		if err != nil {
+			log.Printf("Error when caching row count: %v\n", err)
+		}
+	}
 	return rowCount, nil
 }
 
+// Builds a data quality report for a table or view.  For each column this gathers the number of NULLs, the number
+// of distinct values, the minimum and maximum values, the most common values, the number of values whose type doesn't
+// match the column affinity, and (for numeric columns) a histogram of the values.
+func ProfileSQLiteTable(sdb *sqlite.Conn, dbTable string) (profile TableProfile, err error) {
+	profile.Tablename = dbTable
+	rowCount, err := GetSQLiteRowCount(sdb, dbTable, nil)
+	if err != nil {
+		return TableProfile{}, err
+	}
+	profile.RowCount = int64(rowCount)
+
+	cols, err := sdb.Columns("", dbTable)
+	if err != nil {
+		log.Printf("Error when reading column names for table '%s': %v\n", dbTable, err)
+		return TableProfile{}, errors.New("Error when reading data from the SQLite database")
+	}
+	tbl := sqlite.Mprintf(`"%w"`, dbTable)
+	for _, j := range cols {
+		col := sqlite.Mprintf(`"%w"`, j.Name)
+		p := ColumnProfile{
+			Affinity:     columnAffinity(j.DataType),
+			DeclaredType: j.DataType,
+			Name:         j.Name,
+		}
+
+		// NULL and distinct value counts, plus the smallest and largest values
+		stmt, err := sdb.Prepare(`SELECT count(*) - count(` + col + `), count(DISTINCT ` + col + `), min(` + col +
+			`), max(` + col + `) FROM ` + tbl)
+		if err != nil {
+			log.Printf("Error when preparing statement for database: %s\n", err)
+			return TableProfile{}, errors.New("Error when reading data from the SQLite database")
+		}
+		_, err = stmt.Next()
+		if err == nil {
+			p.Nulls, _, err = stmt.ScanInt64(0)
+		}
+		if err == nil {
+			p.Distinct, _, err = stmt.ScanInt64(1)
+		}
+		if err == nil {
+			minVal, _ := stmt.ScanValue(2, false)
+			maxVal, _ := stmt.ScanValue(3, false)
+			p.Min, p.Max = profileValue(minVal), profileValue(maxVal)
+		}
+		stmt.Finalize()
+		if err != nil {
+			log.Printf("Error when profiling column '%s' of table '%s': %s\n", j.Name, dbTable, err)
+			return TableProfile{}, errors.New("Error when reading data from the SQLite database")
+		}
+		if profile.RowCount > 0 {
+			p.NullPercent = float64(p.Nulls) * 100 / float64(profile.RowCount)
+		}
+
+		// Values stored with a type that doesn't match the column affinity (eg TEXT in an INTEGER column)
+		var mismatched string
+		switch p.Affinity {
+		case "INTEGER", "NUMERIC", "REAL":
+			mismatched = `'text', 'blob'`
+		case "TEXT":
+			mismatched = `'integer', 'real', 'blob'`
+		}
+		if mismatched != "" {
+			err = sdb.OneValue(`SELECT count(*) FROM `+tbl+` WHERE typeof(`+col+`) IN (`+mismatched+`)`,
+				&p.TypeMismatches)
+			if err != nil {
+				log.Printf("Error when checking column types for '%s' of table '%s': %s\n", j.Name, dbTable, err)
+				return TableProfile{}, errors.New("Error when reading data from the SQLite database")
+			}
+		}
+
+		// The most common values
+		stmt, err = sdb.Prepare(`SELECT ` + col + `, count(*) FROM ` + tbl + ` WHERE ` + col +
+			` IS NOT NULL GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT 5`)
+		if err != nil {
+			log.Printf("Error when preparing statement for database: %s\n", err)
+			return TableProfile{}, errors.New("Error when reading data from the SQLite database")
+		}
+		err = stmt.Select(func(s *sqlite.Stmt) error {
+			val, _ := s.ScanValue(0, false)
+			count, _, err := s.ScanInt64(1)
+			p.TopValues = append(p.TopValues, ValueCount{Count: count, Value: profileValue(val)})
+			return err
+		})
+		stmt.Finalize()
+		if err != nil {
+			log.Printf("Error when reading common values for '%s' of table '%s': %s\n", j.Name, dbTable, err)
+			return TableProfile{}, errors.New("Error when reading data from the SQLite database")
+		}
+
+		// Histogram of the numeric values
+		if p.Affinity == "INTEGER" || p.Affinity == "NUMERIC" || p.Affinity == "REAL" {
+			p.Histogram, err = numericHistogram(sdb, tbl, col)
+			if err != nil {
+				log.Printf("Error when creating histogram for '%s' of table '%s': %s\n", j.Name, dbTable, err)
+				return TableProfile{}, errors.New("Error when reading data from the SQLite database")
+			}
+		}
+		profile.Columns = append(profile.Columns, p)
+	}
+	return profile, nil
+}
+
 // Reads up to maxRows number of rows from a given SQLite database table.  If maxRows < 0 (eg -1), then read all rows.
-func ReadSQLiteDB(sdb *sqlite.Conn, dbTable string, maxRows int, sortCol string, sortDir string, rowOffset int) (SQLiteRecordSet, error) {
-	return ReadSQLiteDBCols(sdb, dbTable, false, false, maxRows, sortCol, sortDir, rowOffset)
+// If a cursor from an earlier result is given, it's used for paging instead of the row offset.
+func ReadSQLiteDB(sdb *sqlite.Conn, dbTable string, maxRows int, sortCol string, sortDir string, rowOffset int,
+	cursor string, filters []WhereClause) (SQLiteRecordSet, error) {
+	return ReadSQLiteDBCols(sdb, dbTable, false, false, maxRows, sortCol, sortDir, rowOffset, cursor, filters)
 }
 
 // Reads up to maxRows # of rows from a SQLite database.  Only returns the requested columns.
 func ReadSQLiteDBCols(sdb *sqlite.Conn, dbTable string, ignoreBinary bool, ignoreNull bool, maxRows int,
-	sortCol string, sortDir string, rowOffset int) (SQLiteRecordSet, error) {
+	sortCol string, sortDir string, rowOffset int, cursor string, filters []WhereClause) (SQLiteRecordSet, error) {
 	// Ugh, have to use string smashing for this, even though the SQL spec doesn't seem to say table names
 	// shouldn't be parametrised.  Limitation from SQLite's implementation? :(
 	var dataRows SQLiteRecordSet
@@ -50,74 +286,120 @@ func ReadSQLiteDBCols(sdb *sqlite.Conn, dbTable string, ignoreBinary bool, ignor
 		}
 	}
 
-	// If a sort column was given, we check if the database (in the local cache) has an index on that column.  If it
-	// doesn't, we create one
+	// If a sort column was given, we check if the side-car file for the database (in the local cache) has an index on
+	// that column.  If it does, the query is run against that instead.  If not, index creation is queued for the
+	// background index worker and the (slower) query is run against the database itself in the meantime
 	// TODO: If no sortCol was given, but a rowOffset was, it's likely useful having an index (on any column?) anyway
 	// TODO  It'd probably be good to check if that's the case, and add an index (on say the first column) if none are
 	// TODO  already present
+	qdb := sdb
 	if sortCol != "" && isTable == true {
-		// Grab the list of indexes in the database
-		idxList, err := sdb.Indexes("")
-		if err != nil {
-			return SQLiteRecordSet{}, err
+		idb := IndexedConn(sdb, dbTable, sortCol)
+		if idb != nil {
+			defer idb.Close()
+			qdb = idb
 		}
+	}
 
-		// Look for indexes on the table we'll be querying
-		idxFound := false
-		for idx, tbl := range idxList {
-			if tbl == dbTable {
-				idxCol, err := sdb.IndexColumns("", idx)
-				if err != nil {
-					return SQLiteRecordSet{}, err
-				}
+	// Set the table name
+	dataRows.Tablename = dbTable
 
-				// Is the index on the column we're using
-				if idxCol[0].Name == sortCol {
-					idxFound = true
-					break
+	// Count the total number of rows (matching the filter conditions)
+	totalRows, err := GetSQLiteRowCount(sdb, dbTable, filters)
+	if err != nil {
+		return dataRows, err
+	}
+
+	// Paging through tables with a rowid is done using the sort column value and rowid of the first or last row
+	// already seen (keyset pagination), as using OFFSET gets really slow deep into large tables.  Views and
+	// WITHOUT ROWID tables still use OFFSET.
+	withRowID := isTable && hasRowID(qdb, dbTable)
+	keyset := maxRows > 0 && withRowID
+	var cur tableCursor
+	if keyset && cursor != "" {
+		cur, err = decodeTableCursor(cursor)
+		if err != nil {
+			return dataRows, err
+		}
+		if cur.SortCol != sortCol || cur.SortDir != sortDir {
+			// The cursor is for a different sort order, so ignore it
+			cur = tableCursor{}
+		} else {
+			rowOffset = cur.Offset
+			if cur.Dir == "last" {
+				rowOffset = totalRows - maxRows
+				if rowOffset < 0 {
+					rowOffset = 0
 				}
 			}
 		}
+	}
+	reverse := cur.Dir == "prev" || cur.Dir == "last"
 
-		// If no matching index was found, create one
-		if !idxFound {
-			// TODO: Index creation locks the database while it's happening, which I've seen cause further query
-			// TODO  failures with "database is locked" errors (for a few seconds) in tableViewHandler().
-			// TODO  eg when clicking two or three times quickly on a column heading in the database view.  If the
-			// TODO  first click triggers index creation, then (on larger sized databases) index creation won't be
-			// TODO  finished by the time the next click comes in and triggers queries.  We'll probably need to add
-			// TODO  some detection/retry thing to the places where the failure shows up.
-			dbQuery := sqlite.Mprintf("CREATE INDEX `%w_", dbTable)
-			dbQuery += sqlite.Mprintf("%s_idx`", sortCol)
-			dbQuery += sqlite.Mprintf(" ON `%s`", dbTable)
-			dbQuery += sqlite.Mprintf(" (`%s`)", sortCol)
-			err = sdb.Exec(dbQuery)
-			if err != nil {
-				log.Printf("Error occurred when creating index: %s\n", err.Error())
-				return SQLiteRecordSet{}, err
-			}
-			sdb.Commit()
+	// Construct the main SQL query
+	keyCols := 0
+	var dbQuery string
+	if withRowID {
+		// Also retrieve the values needed for creating the cursors and BLOB download links
+		dbQuery = "SELECT rowid, "
+		keyCols++
+		if keyset && sortCol != "" {
+			dbQuery += sqlite.Mprintf(`"%w", `, sortCol)
+			keyCols++
 		}
+		dbQuery += sqlite.Mprintf(`* FROM "%w"`, dbTable)
+	} else {
+		dbQuery = sqlite.Mprintf(`SELECT * FROM "%w"`, dbTable)
 	}
 
-	// Set the table name
-	dataRows.Tablename = dbTable
-
-	// Construct the main SQL query
-	dbQuery := sqlite.Mprintf(`SELECT * FROM "%w"`, dbTable)
+	// If filter conditions were given, include them
+	where, args := whereClauseSQL(filters)
+	dbQuery += where
 
-	// If a sort column was given, include it
-	if sortCol != "" {
-		dbQuery += ` ORDER BY "%w"`
-		dbQuery = sqlite.Mprintf(dbQuery, sortCol)
+	// If we're continuing on from a cursor, only include the rows past it
+	if cur.Dir == "next" || cur.Dir == "prev" {
+		cond, condArgs, err := cur.condition()
+		if err != nil {
+			return dataRows, err
+		}
+		if where == "" {
+			dbQuery += " WHERE (" + cond + ")"
+		} else {
+			dbQuery += " AND (" + cond + ")"
+		}
+		args = append(args, condArgs...)
 	}
 
-	// If a sort direction was given, include it
-	switch sortDir {
-	case "ASC":
-		dbQuery += " ASC"
-	case "DESC":
-		dbQuery += " DESC"
+	// If a sort column was given, include it.  When paging backwards using a cursor, the sort direction is reversed
+	// (and the retrieved rows swapped back around afterwards).  For keyset pagination, the rowid is used as the tie
+	// breaker
+	dir := sortDir
+	if reverse {
+		if dir == "DESC" {
+			dir = "ASC"
+		} else {
+			dir = "DESC"
+		}
+	}
+	if sortCol != "" {
+		dbQuery += sqlite.Mprintf(` ORDER BY "%w"`, sortCol)
+		switch dir {
+		case "ASC":
+			dbQuery += " ASC"
+		case "DESC":
+			dbQuery += " DESC"
+		}
+		if keyset {
+			dbQuery += ", rowid"
+			if dir == "DESC" {
+				dbQuery += " DESC"
+			}
+		}
+	} else if keyset {
+		dbQuery += " ORDER BY rowid"
+		if reverse {
+			dbQuery += " DESC"
+		}
 	}
 
 	// If a row limit was given, add it
@@ -126,23 +408,25 @@ func ReadSQLiteDBCols(sdb *sqlite.Conn, dbTable string, ignoreBinary bool, ignor
 	}
 
 	// If an offset was given, add it
-	if rowOffset >= 0 {
+	if rowOffset >= 0 && cur.Dir == "" {
 		dbQuery = fmt.Sprintf("%s OFFSET %d", dbQuery, rowOffset)
 	}
 
 	// Use the sort column as needed
-	stmt, err = sdb.Prepare(dbQuery)
+	stmt, err = qdb.Prepare(dbQuery, args...)
 	if err != nil {
 		log.Printf("Error when preparing statement for database: %s\n", err)
 		return dataRows, errors.New("Error when reading data from the SQLite database")
 	}
 
 	// Retrieve the field names
-	dataRows.ColNames = stmt.ColumnNames()
+	dataRows.ColNames = stmt.ColumnNames()[keyCols:]
 	dataRows.ColCount = len(dataRows.ColNames)
 
 	// Process each row
 	fieldCount := -1
+	var firstKey, lastKey tableCursor
+	numRows := 0
 	err = stmt.Select(func(s *sqlite.Stmt) error {
 
 		// Get the number of fields in the result
@@ -150,10 +434,21 @@ func ReadSQLiteDBCols(sdb *sqlite.Conn, dbTable string, ignoreBinary bool, ignor
 			fieldCount = stmt.DataCount()
 		}
 
+		// Keep the position of the first and last rows, for creating the cursors
+		var rowID string
+		if withRowID {
+			lastKey = rowKey(s, keyset && sortCol != "")
+			rowID = strconv.FormatInt(lastKey.RowID, 10)
+			if numRows == 0 {
+				firstKey = lastKey
+			}
+		}
+		numRows++
+
 		// Retrieve the data for each row
 		var row []DataValue
 		addRow := true
-		for i := 0; i < fieldCount; i++ {
+		for i := keyCols; i < fieldCount; i++ {
 			// Retrieve the data type for the field
 			fieldType := stmt.ColumnType(i)
 
@@ -168,7 +463,7 @@ func ReadSQLiteDBCols(sdb *sqlite.Conn, dbTable string, ignoreBinary bool, ignor
 				}
 				if !isNull {
 					stringVal := fmt.Sprintf("%d", val)
-					row = append(row, DataValue{Name: dataRows.ColNames[i], Type: Integer,
+					row = append(row, DataValue{Name: dataRows.ColNames[i-keyCols], Type: Integer,
 						Value: stringVal})
 				}
 			case sqlite.Float:
@@ -180,23 +475,26 @@ func ReadSQLiteDBCols(sdb *sqlite.Conn, dbTable string, ignoreBinary bool, ignor
 				}
 				if !isNull {
 					stringVal := strconv.FormatFloat(val, 'f', 4, 64)
-					row = append(row, DataValue{Name: dataRows.ColNames[i], Type: Float,
+					row = append(row, DataValue{Name: dataRows.ColNames[i-keyCols], Type: Float,
 						Value: stringVal})
 				}
 			case sqlite.Text:
 				var val string
 				val, isNull = s.ScanText(i)
 				if !isNull {
-					row = append(row, DataValue{Name: dataRows.ColNames[i], Type: Text,
+					row = append(row, DataValue{Name: dataRows.ColNames[i-keyCols], Type: Text,
 						Value: val})
 				}
 			case sqlite.Blob:
 				// BLOBs can be ignored (via flag to this function) for situations like the vis data
 				if !ignoreBinary {
-					_, isNull = s.ScanBlob(i)
+					var val []byte
+					val, isNull = s.ScanBlob(i)
 					if !isNull {
-						row = append(row, DataValue{Name: dataRows.ColNames[i], Type: Binary,
-							Value: "<i>BINARY DATA</i>"})
+						v := blobPreview(val)
+						v.Name = dataRows.ColNames[i-keyCols]
+						v.RowID = rowID
+						row = append(row, v)
 					}
 				} else {
 					addRow = false
@@ -206,7 +504,7 @@ func ReadSQLiteDBCols(sdb *sqlite.Conn, dbTable string, ignoreBinary bool, ignor
 			}
 			if isNull && !ignoreNull {
 				// NULLS can be ignored (via flag to this function) for situations like the vis data
-				row = append(row, DataValue{Name: dataRows.ColNames[i], Type: Null,
+				row = append(row, DataValue{Name: dataRows.ColNames[i-keyCols], Type: Null,
 					Value: "<i>NULL</i>"})
 			}
 			if isNull && ignoreNull {
@@ -226,26 +524,75 @@ func ReadSQLiteDBCols(sdb *sqlite.Conn, dbTable string, ignoreBinary bool, ignor
 	}
 	defer stmt.Finalize()
 
-	// Add count of total rows to returned data
-	tmpCount, err := GetSQLiteRowCount(sdb, dbTable)
-	if err != nil {
-		return dataRows, err
+	// If the rows were retrieved in reverse order, swap them back around
+	if reverse {
+		for i, j := 0, len(dataRows.Records)-1; i < j; i, j = i+1, j-1 {
+			dataRows.Records[i], dataRows.Records[j] = dataRows.Records[j], dataRows.Records[i]
+		}
+		firstKey, lastKey = lastKey, firstKey
 	}
-	dataRows.RowCount = tmpCount
+
+	// Add count of total rows to returned data
+	dataRows.RowCount = totalRows
 
 	// Fill out the sort column, direction, and row offset
 	dataRows.SortCol = sortCol
 	dataRows.SortDir = sortDir
 	dataRows.Offset = rowOffset
 
+	// Create the cursors for moving to the next, previous, and last pages
+	if keyset {
+		lastPage := tableCursor{Dir: "last", SortCol: sortCol, SortDir: sortDir}
+		dataRows.LastCursor = lastPage.encode()
+		if numRows > 0 && rowOffset+numRows < totalRows {
+			lastKey.Dir = "next"
+			lastKey.Offset = rowOffset + numRows
+			lastKey.SortCol = sortCol
+			lastKey.SortDir = sortDir
+			dataRows.NextCursor = lastKey.encode()
+		}
+		if numRows > 0 && rowOffset > 0 {
+			firstKey.Dir = "prev"
+			firstKey.Offset = rowOffset - maxRows
+			if firstKey.Offset < 0 {
+				firstKey.Offset = 0
+			}
+			firstKey.SortCol = sortCol
+			firstKey.SortDir = sortDir
+			dataRows.PrevCursor = firstKey.encode()
+		}
+	}
+
 	return dataRows, nil
 }
 
+// Reads the value of a single cell from a SQLite table, as raw bytes.
+func ReadSQLiteCell(sdb *sqlite.Conn, dbTable string, colName string, rowID int64) (data []byte, err error) {
+	dbQuery := sqlite.Mprintf(`SELECT "%w"`, colName) + sqlite.Mprintf(` FROM "%w" WHERE rowid = ?`, dbTable)
+	stmt, err := sdb.Prepare(dbQuery, rowID)
+	if err != nil {
+		log.Printf("Error when preparing statement for database: %s\n", err)
+		return nil, errors.New("Error when reading data from the SQLite database")
+	}
+	defer stmt.Finalize()
+	found, err := stmt.Next()
+	if err != nil {
+		log.Printf("Error when reading cell data from database: %s\n", err)
+		return nil, errors.New("Error when reading data from the SQLite database")
+	}
+	if !found {
+		return nil, errors.New("Requested row not found")
+	}
+	data, _ = stmt.ScanBlob(0)
+	return data, nil
+}
+
 // This is a specialised variation of the ReadSQLiteDB() function, just for our CSV exporting code. It'll probably
 // need to be merged with the above function at some point.
-func ReadSQLiteDBCSV(sdb *sqlite.Conn, dbTable string) ([][]string, error) {
-	// Retrieve all of the data from the selected database table
-	stmt, err := sdb.Prepare(`SELECT * FROM "` + dbTable + `"`)
+func ReadSQLiteDBCSV(sdb *sqlite.Conn, dbTable string, filters []WhereClause) ([][]string, error) {
+	// Retrieve all of the data (matching the filter conditions) from the selected database table
+	where, args := whereClauseSQL(filters)
+	stmt, err := sdb.Prepare(sqlite.Mprintf(`SELECT * FROM "%w"`, dbTable)+where, args...)
 	if err != nil {
 		log.Printf("Error when preparing statement for database: %s\n", err)
 		return nil, err
@@ -428,6 +775,141 @@ func ReadSQLiteDBRedash(sdb *sqlite.Conn, dbTable string) (dash RedashTableData,
 	return dash, nil
 }
 
+// Reads the structure of a SQLite database.  Returns each table, view, index and trigger along with the SQL used to
+// create it, and for tables and views their columns and foreign keys.
+func ReadSQLiteSchema(sdb *sqlite.Conn) (schema DBSchema, err error) {
+	stmt, err := sdb.Prepare(`SELECT type, name, tbl_name, sql FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%' ORDER BY type, name`)
+	if err != nil {
+		log.Printf("Error when preparing statement for database: %s\n", err)
+		return DBSchema{}, errors.New("Error when reading the database schema")
+	}
+	defer stmt.Finalize()
+	err = stmt.Select(func(s *sqlite.Stmt) error {
+		var o SchemaObject
+		objType, _ := s.ScanText(0)
+		o.Name, _ = s.ScanText(1)
+		o.Table, _ = s.ScanText(2)
+		o.SQL, _ = s.ScanText(3)
+		switch objType {
+		case "index":
+			cols, err := sdb.IndexColumns("", o.Name)
+			if err != nil {
+				return err
+			}
+			for _, c := range cols {
+				o.Columns = append(o.Columns, SchemaColumn{Name: c.Name})
+			}
+			schema.Indexes = append(schema.Indexes, o)
+		case "table", "view":
+			cols, err := sdb.Columns("", o.Name)
+			if err != nil {
+				return err
+			}
+			for _, c := range cols {
+				o.Columns = append(o.Columns, SchemaColumn{
+					Default:    c.DfltValue,
+					Name:       c.Name,
+					NotNull:    c.NotNull,
+					PrimaryKey: c.Pk,
+					Type:       c.DataType,
+				})
+			}
+			if objType == "view" {
+				schema.Views = append(schema.Views, o)
+				break
+			}
+			fks, err := sdb.ForeignKeys("", o.Name)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < len(fks); i++ {
+				if fk, ok := fks[i]; ok {
+					o.ForeignKeys = append(o.ForeignKeys, SchemaForeignKey{From: fk.From, Table: fk.Table, To: fk.To})
+				}
+			}
+			schema.Tables = append(schema.Tables, o)
+		case "trigger":
+			schema.Triggers = append(schema.Triggers, o)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error when reading database schema: %s\n", err)
+		return DBSchema{}, errors.New("Error when reading the database schema")
+	}
+	return
+}
+
+// Gathers statistics about a database file: its page size, schema version, text encoding, journal mode, and the
+// number of rows and bytes used by each table.  Byte counts need the dbstat virtual table, so are left as zero if
+// SQLite wasn't compiled with it.
+func ReadSQLiteStats(fileName string) (stats DBStats, err error) {
+	sdb, err := sqlite.Open(fileName, sqlite.OpenReadOnly)
+	if err != nil {
+		log.Printf("Couldn't open database when gathering statistics: %s", err)
+		return DBStats{}, errors.New("Internal error when gathering database statistics")
+	}
+	defer sdb.Close()
+
+	// Database wide settings
+	err = sdb.OneValue("PRAGMA page_size", &stats.PageSize)
+	if err == nil {
+		err = sdb.OneValue("PRAGMA schema_version", &stats.SchemaVersion)
+	}
+	if err == nil {
+		err = sdb.OneValue("PRAGMA encoding", &stats.Encoding)
+	}
+	if err == nil {
+		err = sdb.OneValue("PRAGMA journal_mode", &stats.JournalMode)
+	}
+	if err != nil {
+		log.Printf("Error when reading database settings for statistics: %s\n", err)
+		return DBStats{}, errors.New("Internal error when gathering database statistics")
+	}
+
+	// Row counts for each table
+	tables, err := sdb.Tables("")
+	if err != nil {
+		log.Printf("Error retrieving table names when gathering statistics: %s\n", err)
+		return DBStats{}, errors.New("Internal error when gathering database statistics")
+	}
+	stats.Tables = make(map[string]TableStats)
+	for _, t := range tables {
+		var ts TableStats
+		err = sdb.OneValue(sqlite.Mprintf(`SELECT count(*) FROM "%w"`, t), &ts.Rows)
+		if err != nil {
+			log.Printf("Error counting rows in table '%s' when gathering statistics: %s\n", t, err)
+			return DBStats{}, errors.New("Internal error when gathering database statistics")
+		}
+		stats.Tables[t] = ts
+	}
+
+	// Space used by each table
+	stmt, err := sdb.Prepare("SELECT name, sum(pgsize) FROM dbstat GROUP BY name")
+	if err != nil {
+		log.Printf("Couldn't query dbstat, so table sizes won't be available: %s\n", err)
+		return stats, nil
+	}
+	defer stmt.Finalize()
+	err = stmt.Select(func(s *sqlite.Stmt) error {
+		name, _ := s.ScanText(0)
+		size, _, err := s.ScanInt64(1)
+		if err != nil {
+			return err
+		}
+		if ts, ok := stats.Tables[name]; ok {
+			ts.Bytes = size
+			stats.Tables[name] = ts
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error reading table sizes from dbstat: %s\n", err)
+	}
+	return stats, nil
+}
+
 // Performs basic sanity checks of an uploaded database.
 func SanityCheck(fileName string) (tables []string, err error) {
 	// Perform a read on the database, as a basic sanity check to ensure it's really a SQLite database
@@ -532,3 +1014,219 @@ func Tables(sdb *sqlite.Conn, dbName string) ([]string, error) {
 	tables = append(tables, vw...)
 	return tables, nil
 }
+
+// Builds the WHERE portion of a SQL query from a list of filter conditions, returning it along with the values to be
+// bound to its parameters.  The filter conditions need to have been validated first.
+func whereClauseSQL(filters []WhereClause) (where string, args []interface{}) {
+	var conds []string
+	for _, j := range filters {
+		op := whereClauseTypes[j.Type]
+		switch j.Type {
+		case "null", "notnull":
+			conds = append(conds, sqlite.Mprintf(`"%w" `, j.Column)+op)
+		case "contains":
+			// Escape any wildcard characters in the value, so they're matched literally
+			v := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(j.Value)
+			conds = append(conds, sqlite.Mprintf(`"%w" `, j.Column)+op+` ? ESCAPE '\'`)
+			args = append(args, "%"+v+"%")
+		default:
+			conds = append(conds, sqlite.Mprintf(`"%w" `, j.Column)+op+" ?")
+			args = append(args, j.Value)
+		}
+	}
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	return
+}
+
+// Works out the type of data in a BLOB, returning a cell value with a short HTML preview of it.  Images are given the
+// Image type, so the table view can display them.
+func blobPreview(data []byte) (v DataValue) {
+	v.Type = Binary
+	v.MimeType = SniffBlob(data)
+	switch v.MimeType {
+	case "image/gif", "image/jpeg", "image/png", "image/svg+xml":
+		v.Type = Image
+		v.Value = "<i>IMAGE</i>"
+	case "application/pdf":
+		v.Value = fmt.Sprintf("<i>PDF DOCUMENT</i> (%d bytes)", len(data))
+	case "application/json":
+		preview := []rune(string(data))
+		if len(preview) > 100 {
+			preview = append(preview[:100], '…')
+		}
+		v.Value = "<i>JSON</i> " + html.EscapeString(string(preview))
+	default:
+		// Show the first few bytes in hex for unknown binary data
+		n := len(data)
+		if n > 16 {
+			n = 16
+		}
+		preview := fmt.Sprintf("% x", data[:n])
+		if len(data) > n {
+			preview += " …"
+		}
+		v.Value = fmt.Sprintf("<i>BINARY DATA</i> %s (%d bytes)", preview, len(data))
+	}
+	return
+}
+
+// Returns the type affinity SQLite uses for a declared column type, following the rules in section 3.1 of
+// https://sqlite.org/datatype3.html
+func columnAffinity(declType string) string {
+	t := strings.ToUpper(declType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return "INTEGER"
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return "TEXT"
+	case t == "", strings.Contains(t, "BLOB"):
+		return "BLOB"
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return "REAL"
+	}
+	return "NUMERIC"
+}
+
+// Checks if a SQLite table has a rowid (eg isn't a WITHOUT ROWID table)
+func hasRowID(sdb *sqlite.Conn, dbTable string) bool {
+	stmt, err := sdb.Prepare(sqlite.Mprintf(`SELECT rowid FROM "%w" LIMIT 0`, dbTable))
+	if err != nil {
+		return false
+	}
+	stmt.Finalize()
+	return true
+}
+
+// Interrupts whatever is running on a SQLite connection once the time limit is reached.  The returned function stops
+// the timer, and reports whether the interrupt happened.
+func interruptAfter(sdb *sqlite.Conn, limit time.Duration) (stop func() bool) {
+	var interrupted int32
+	t := time.AfterFunc(limit, func() {
+		atomic.StoreInt32(&interrupted, 1)
+		sdb.Interrupt()
+	})
+	return func() bool {
+		t.Stop()
+		return atomic.LoadInt32(&interrupted) == 1
+	}
+}
+
+// Splits the numeric values of a column into ten equal width buckets, returning the number of values in each.  The
+// table and column names need to be quoted already.
+func numericHistogram(sdb *sqlite.Conn, tbl string, col string) (buckets []HistogramBucket, err error) {
+	numeric := ` WHERE typeof(` + col + `) IN ('integer', 'real')`
+	stmt, err := sdb.Prepare(`SELECT min(` + col + `), max(` + col + `), count(*) FROM ` + tbl + numeric)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Finalize()
+	_, err = stmt.Next()
+	if err != nil {
+		return nil, err
+	}
+	lo, isNull, err := stmt.ScanDouble(0)
+	if err != nil || isNull {
+		// No numeric values
+		return nil, err
+	}
+	hi, _, err := stmt.ScanDouble(1)
+	if err != nil {
+		return nil, err
+	}
+	if lo == hi {
+		// All the values are the same, so there's only one bucket
+		count, _, err := stmt.ScanInt64(2)
+		if err != nil {
+			return nil, err
+		}
+		return []HistogramBucket{{Count: count, From: lo, To: hi}}, nil
+	}
+
+	const numBuckets = 10
+	width := (hi - lo) / numBuckets
+	for i := 0; i < numBuckets; i++ {
+		buckets = append(buckets, HistogramBucket{From: lo + float64(i)*width, To: lo + float64(i+1)*width})
+	}
+	buckets[numBuckets-1].To = hi
+	err = sdb.Select(`SELECT min(CAST((`+col+` - ?) / ? AS INTEGER), ?), count(*) FROM `+tbl+numeric+` GROUP BY 1`,
+		func(s *sqlite.Stmt) error {
+			b, _, err := s.ScanInt(0)
+			if err != nil {
+				return err
+			}
+			if b >= 0 && b < numBuckets {
+				buckets[b].Count, _, err = s.ScanInt64(1)
+			}
+			return err
+		}, lo, width, numBuckets-1)
+	return buckets, err
+}
+
+// Formats a value read from a SQLite database for display in the table profile report
+func profileValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return fmt.Sprintf("BLOB (%d bytes)", len(v))
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	s := []rune(fmt.Sprintf("%v", val))
+	if len(s) > 100 {
+		s = append(s[:100], '…')
+	}
+	return string(s)
+}
+
+// Returns the position of the current row of a keyset paginated query, which has the rowid as its first column and
+// (optionally) the sort column value as the second
+func rowKey(s *sqlite.Stmt, sorted bool) (c tableCursor) {
+	c.RowID, _, _ = s.ScanInt64(0)
+	if !sorted {
+		return
+	}
+	val, isNull := s.ScanValue(1, false)
+	if isNull {
+		c.ValueType = Null
+		return
+	}
+	switch v := val.(type) {
+	case int64:
+		c.Value, c.ValueType = strconv.FormatInt(v, 10), Integer
+	case float64:
+		c.Value, c.ValueType = strconv.FormatFloat(v, 'g', -1, 64), Float
+	case []byte:
+		c.Value, c.ValueType = base64.StdEncoding.EncodeToString(v), Binary
+	default:
+		c.Value, c.ValueType = fmt.Sprintf("%s", v), Text
+	}
+	return
+}
+
+// Returns the mime type of the data in a BLOB.  Recognises PNG, JPEG, GIF, SVG, PDF, and JSON, with anything else
+// being returned as "application/octet-stream".
+func SniffBlob(data []byte) string {
+	switch t := http.DetectContentType(data); t {
+	case "image/gif", "image/jpeg", "image/png", "application/pdf":
+		return t
+	}
+
+	// SVG images and JSON are text, so need checking for separately
+	start := bytes.TrimSpace(data)
+	if len(start) > 1024 {
+		start = start[:1024]
+	}
+	if bytes.HasPrefix(start, []byte("<svg")) ||
+		(bytes.HasPrefix(start, []byte("<?xml")) && bytes.Contains(start, []byte("<svg"))) {
+		return "image/svg+xml"
+	}
+	if (bytes.HasPrefix(start, []byte("{")) || bytes.HasPrefix(start, []byte("["))) && json.Valid(data) {
+		return "application/json"
+	}
+	return "application/octet-stream"
+}
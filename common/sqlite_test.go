@@ -0,0 +1,82 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// Pages through a table with a TEXT primary key using the keyset cursors, checking each row is returned once and in
+// order
+func TestReadSQLiteDBTextKeyPaging(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbhub-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sdb, err := sqlite.Open(filepath.Join(dir, "paging.sqlite"), sqlite.OpenReadWrite|sqlite.OpenCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+
+	// The rows are inserted out of order, so the rowid order doesn't match the key order
+	err = sdb.Exec(`CREATE TABLE people (name TEXT PRIMARY KEY, age INTEGER)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"eve", "alice", "dave", "bob", "carol", "grace", "frank"} {
+		err = sdb.Exec(`INSERT INTO people (name, age) VALUES (?, ?)`, name, 20+i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"alice", "bob", "carol", "dave", "eve", "frank", "grace"}
+
+	// Read the rows a page at a time, following the "next" cursors
+	var got []string
+	var rs SQLiteRecordSet
+	cursor := ""
+	for pages := 0; pages < len(want); pages++ {
+		rs, err = ReadSQLiteDB(sdb, "people", 2, "name", "ASC", 0, cursor, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rs.Records {
+			got = append(got, row[0].Value.(string))
+		}
+		if rs.NextCursor == "" {
+			break
+		}
+		cursor = rs.NextCursor
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Paging forward returned %v, wanted %v", got, want)
+	}
+
+	// Then back again from the last page, following the "prev" cursors
+	got = nil
+	cursor = rs.LastCursor
+	for pages := 0; pages < len(want); pages++ {
+		rs, err = ReadSQLiteDB(sdb, "people", 2, "name", "ASC", 0, cursor, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page []string
+		for _, row := range rs.Records {
+			page = append(page, row[0].Value.(string))
+		}
+		got = append(page, got...)
+		if rs.PrevCursor == "" {
+			break
+		}
+		cursor = rs.PrevCursor
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Paging backward returned %v, wanted %v", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// The storage back end used for database (and related) files
+	storageBackend StorageBackend
+)
+
+// Interface for the different places database files can be stored
+type StorageBackend interface {
+	Delete(bucket string, id string) error
+	Exists(bucket string, id string) (bool, error)
+	Get(bucket string, id string) (StorageObject, error)
+	List(bucket string) ([]string, error)
+	Put(bucket string, id string, data io.Reader, size int64, contentType string) (int64, error)
+}
+
+// A handle to an object retrieved from the storage back end
+type StorageObject interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+	Size() (int64, error)
+}
+
+// Storage back end which keeps files in a directory on the local filesystem
+type localStorage struct {
+	dir string
+}
+
+// Handle for a file in the local storage directory
+type localObject struct {
+	*os.File
+}
+
+// Sets up the storage back end chosen in the configuration file
+func ConnectStorage() (err error) {
+	switch Conf.Storage.Backend {
+	case "minio":
+		err = ConnectMinio()
+		if err != nil {
+			return
+		}
+		storageBackend = minioStorage{}
+	case "local":
+		err = os.MkdirAll(Conf.Storage.Directory, 0750)
+		if err != nil {
+			return fmt.Errorf("Couldn't create local storage directory '%s': %v\n", Conf.Storage.Directory, err)
+		}
+		storageBackend = localStorage{dir: Conf.Storage.Directory}
+		log.Printf("Local storage config ok. Directory: %v\n", Conf.Storage.Directory)
+	default:
+		return fmt.Errorf("Unknown storage back end '%s'\n", Conf.Storage.Backend)
+	}
+	return
+}
+
+// Returns the storage back end handle
+func Storage() StorageBackend {
+	return storageBackend
+}
+
+// Removes a file from the local storage directory
+func (s localStorage) Delete(bucket string, id string) error {
+	err := os.Remove(s.path(bucket, id))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing file '%s/%s' from local storage: %v\n", bucket, id, err)
+		return err
+	}
+	return nil
+}
+
+// Checks if a file is present in the local storage directory
+func (s localStorage) Exists(bucket string, id string) (bool, error) {
+	_, err := os.Stat(s.path(bucket, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Opens a file in the local storage directory for reading
+func (s localStorage) Get(bucket string, id string) (StorageObject, error) {
+	f, err := os.Open(s.path(bucket, id))
+	if err != nil {
+		log.Printf("Error retrieving file '%s/%s' from local storage: %v\n", bucket, id, err)
+		return nil, errors.New("Error retrieving database from internal storage")
+	}
+	return localObject{f}, nil
+}
+
+// Returns the ids of the files in a bucket of the local storage directory
+func (s localStorage) List(bucket string) (ids []string, err error) {
+	entries, err := ioutil.ReadDir(filepath.Join(s.dir, bucket))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, j := range entries {
+		// Skip directories, and files still being written
+		if j.IsDir() || strings.HasPrefix(j.Name(), ".new-") {
+			continue
+		}
+		ids = append(ids, j.Name())
+	}
+	return
+}
+
+// Returns the full path to a file in the local storage directory
+func (s localStorage) path(bucket string, id string) string {
+	return filepath.Join(s.dir, bucket, id)
+}
+
+// Writes a file into the local storage directory.  The content type is ignored.
+func (s localStorage) Put(bucket string, id string, data io.Reader, size int64, contentType string) (int64, error) {
+	err := os.MkdirAll(filepath.Join(s.dir, bucket), 0750)
+	if err != nil {
+		log.Printf("Error creating local storage directory for bucket '%s': %v\n", bucket, err)
+		return 0, err
+	}
+
+	// Write the data to a uniquely named temporary file first, then rename it into place once it's complete.  This
+	// way concurrent writes of the same file don't truncate each other's data part way through
+	dest := s.path(bucket, id)
+	f, err := ioutil.TempFile(filepath.Dir(dest), ".new-"+id+"-")
+	if err != nil {
+		log.Printf("Error creating file in local storage: %v\n", err)
+		return 0, err
+	}
+	tmpName := f.Name()
+	numBytes, err := io.Copy(f, data)
+	if err == nil {
+		err = f.Chmod(0640)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		log.Printf("Error writing file to local storage: %v\n", err)
+		return 0, err
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(tmpName)
+		return 0, err
+	}
+	if size >= 0 && numBytes != size {
+		os.Remove(tmpName)
+		return numBytes, fmt.Errorf("Short write to local storage.  Expected %d bytes, wrote %d", size, numBytes)
+	}
+	err = os.Rename(tmpName, dest)
+	if err != nil {
+		os.Remove(tmpName)
+		log.Printf("Error renaming file into place in local storage: %v\n", err)
+		return 0, err
+	}
+	return numBytes, nil
+}
+
+// Returns the size of a file in the local storage directory
+func (o localObject) Size() (int64, error) {
+	fi, err := o.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
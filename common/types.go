@@ -21,6 +21,14 @@ const (
 	ALL_TIME                 = "all"
 )
 
+type ForkSyncResult string
+
+const (
+	FORK_DIVERGED       ForkSyncResult = "diverged"
+	FORK_FAST_FORWARDED                = "fast_forwarded"
+	FORK_UP_TO_DATE                    = "up_to_date"
+)
+
 type ForkType int
 
 const (
@@ -42,15 +50,24 @@ const (
 	Float
 )
 
+// Number of commits to display on each page of the commit history for a branch
+const CommitsPerPage = 100
+
 // Number of rows to display by default on the database page
 const DefaultNumDisplayRows = 25
 
+// Release name which can be requested to get the most recent release of a database
+const LatestRelease = "latest"
+
 // The maximum database size accepted for upload (in MB)
 const MaxDatabaseSize = 512
 
 // The maximum licence size accepted for upload (in MB)
 const MaxLicenceSize = 1
 
+// The maximum time user supplied SQL (eg validation rule queries) is allowed to run, before being interrupted
+const MaxQueryTime = 30 * time.Second
+
 // The number of leading characters of a files' sha256 used as the Minio folder name
 // eg: When set to 6, then "34f4255a737156147fbd0a44323a895d18ade79d4db521564d1b0dbb8764cbbc"
 //        -> Minio folder: "34f425"
@@ -68,11 +85,14 @@ type TomlConfig struct {
 	Environment EnvInfo
 	DiskCache   DiskCacheInfo
 	Event       EventProcessingInfo
+	ForkSync    ForkSyncInfo
 	Licence     LicenceInfo
 	Memcache    MemcacheInfo
 	Minio       MinioInfo
+	Mirror      MirrorInfo
 	Pg          PGInfo
 	Sign        SigningInfo
+	Storage     StorageInfo
 	Web         WebInfo
 }
 
@@ -117,6 +137,11 @@ type EventProcessingInfo struct {
 	EmailQueueProcessingDelay time.Duration `toml:"email_queue_processing_delay"`
 }
 
+// Automatic syncing of forks with their upstream database
+type ForkSyncInfo struct {
+	Interval time.Duration `toml:"interval"`
+}
+
 // Path to the licence files
 type LicenceInfo struct {
 	LicenceDir string `toml:"licence_dir"`
@@ -137,10 +162,19 @@ type MinioInfo struct {
 	Server    string
 }
 
+// Scheduled re-import of databases from their source URL
+type MirrorInfo struct {
+	Enabled  bool          `toml:"enabled"`
+	Interval time.Duration `toml:"interval"`
+	LocalDir string        `toml:"local_dir"`
+}
+
 // PostgreSQL connection parameters
 type PGInfo struct {
+	AutoMigrate    bool `toml:"auto_migrate"`
 	Database       string
-	NumConnections int `toml:"num_connections"`
+	MigrationsDir  string `toml:"migrations_dir"`
+	NumConnections int    `toml:"num_connections"`
 	Port           int
 	Password       string
 	Server         string
@@ -153,6 +187,13 @@ type SigningInfo struct {
 	CertDaysValid    int    `toml:"cert_days_valid"`
 	IntermediateCert string `toml:"intermediate_cert"`
 	IntermediateKey  string `toml:"intermediate_key"`
+	ReleaseKey       string `toml:"release_key"`
+}
+
+// Storage back end for the database files
+type StorageInfo struct {
+	Backend   string `toml:"backend"`
+	Directory string `toml:"directory"`
 }
 
 type WebInfo struct {
@@ -194,6 +235,31 @@ type BranchEntry struct {
 	Description string `json:"description"`
 }
 
+// A named client certificate issued to a user
+type ClientCertEntry struct {
+	Expires time.Time `json:"expires"`
+	ID      int64     `json:"id"`
+	Issued  time.Time `json:"issued"`
+	Name    string    `json:"name"`
+	Revoked time.Time `json:"revoked"`
+	Serial  string    `json:"serial"`
+}
+
+// Summary of the data in a single column, used by the table profile report
+type ColumnProfile struct {
+	Affinity       string            `json:"affinity"`
+	DeclaredType   string            `json:"declared_type"`
+	Distinct       int64             `json:"distinct"`
+	Histogram      []HistogramBucket `json:"histogram,omitempty"`
+	Max            string            `json:"max"`
+	Min            string            `json:"min"`
+	Name           string            `json:"name"`
+	NullPercent    float64           `json:"null_percent"`
+	Nulls          int64             `json:"nulls"`
+	TopValues      []ValueCount      `json:"top_values"`
+	TypeMismatches int64             `json:"type_mismatches"`
+}
+
 type CommitData struct {
 	AuthorAvatar   string    `json:"author_avatar"`
 	AuthorEmail    string    `json:"author_email"`
@@ -205,6 +271,35 @@ type CommitData struct {
 	Timestamp      time.Time `json:"timestamp"`
 }
 
+// The layout of a databases' commit history, for drawing as a graph.  Lanes is the number of lanes (columns) needed
+type CommitGraph struct {
+	Commits []CommitGraphNode `json:"commits"`
+	Lanes   int               `json:"lanes"`
+}
+
+// A line in the commit graph, running from a commit down its Lane to one of the commit's parents
+type CommitGraphEdge struct {
+	Lane       int    `json:"lane"`
+	Merge      bool   `json:"merge"`
+	Parent     string `json:"parent"`
+	ParentLane int    `json:"parent_lane"`
+	ParentRow  int    `json:"parent_row"`
+}
+
+// A single commit in the commit graph, along with the names of the branches, tags, and releases pointing at it
+type CommitGraphNode struct {
+	AuthorName string            `json:"author_name"`
+	Branches   []string          `json:"branches"`
+	Edges      []CommitGraphEdge `json:"edges"`
+	ID         string            `json:"id"`
+	Lane       int               `json:"lane"`
+	Message    string            `json:"message"`
+	Releases   []string          `json:"releases"`
+	Row        int               `json:"row"`
+	Tags       []string          `json:"tags"`
+	Timestamp  time.Time         `json:"timestamp"`
+}
+
 type CommitEntry struct {
 	AuthorEmail    string    `json:"author_email"`
 	AuthorName     string    `json:"author_name"`
@@ -216,12 +311,23 @@ type CommitEntry struct {
 	Parent         string    `json:"parent"`
 	Timestamp      time.Time `json:"timestamp"`
 	Tree           DBTree    `json:"tree"`
+
+	// Failures of data validation rules which flag (rather than reject) a commit.  Not part of the commit ID.
+	ValidationFailures []ValidationFailure `json:"validation_failures,omitempty"`
+}
+
+type ContributorEntry struct {
+	AuthorEmail string `json:"author_email"`
+	AuthorName  string `json:"author_name"`
+	NumCommits  int    `json:"num_commits"`
 }
 
 type DataValue struct {
-	Name  string
-	Type  ValType
-	Value interface{}
+	MimeType string `json:",omitempty"`
+	Name     string
+	RowID    string `json:",omitempty"`
+	Type     ValType
+	Value    interface{}
 }
 type DataRow []DataValue
 
@@ -252,6 +358,16 @@ type DBTreeEntry struct {
 	Name         string          `json:"name"`
 	Sha256       string          `json:"sha256"`
 	Size         int64           `json:"size"`
+	Stats        *DBStats        `json:"stats,omitempty"`
+}
+
+// Statistics for a database file, gathered when it's uploaded.  Not part of the tree ID.
+type DBStats struct {
+	Encoding      string                `json:"encoding"`
+	JournalMode   string                `json:"journal_mode"`
+	PageSize      int                   `json:"page_size"`
+	SchemaVersion int                   `json:"schema_version"`
+	Tables        map[string]TableStats `json:"tables"`
 }
 
 type DBInfo struct {
@@ -289,6 +405,14 @@ type DBInfo struct {
 	Watchers      int
 }
 
+// The structure of a SQLite database, as shown on the schema page
+type DBSchema struct {
+	Indexes  []SchemaObject `json:"indexes"`
+	Tables   []SchemaObject `json:"tables"`
+	Triggers []SchemaObject `json:"triggers"`
+	Views    []SchemaObject `json:"views"`
+}
+
 type DiscussionCommentType string
 
 const (
@@ -364,6 +488,25 @@ type ForkEntry struct {
 	Deleted    bool       `json:"deleted"`
 }
 
+// How a branch of a fork compares with the same branch of its upstream (parent) database
+type ForkSyncStatus struct {
+	Ahead          int            `json:"ahead"`
+	Behind         int            `json:"behind"`
+	Branch         string         `json:"branch"`
+	DiscID         int            `json:"discussion_id,omitempty"`
+	MissingTags    []string       `json:"missing_tags"`
+	Result         ForkSyncResult `json:"result,omitempty"`
+	UpstreamDBName string         `json:"upstream_database_name"`
+	UpstreamFolder string         `json:"upstream_folder"`
+	UpstreamOwner  string         `json:"upstream_owner"`
+}
+
+type HistogramBucket struct {
+	Count int64   `json:"count"`
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+}
+
 type LicenceEntry struct {
 	FileFormat string `json:"file_format"`
 	FullName   string `json:"full_name"`
@@ -406,6 +549,16 @@ type MetaInfo struct {
 	Title            string
 }
 
+// A database which is periodically re-imported from its source URL
+type MirrorEntry struct {
+	Branch    string
+	Folder    string
+	Name      string
+	Owner     string
+	Public    bool
+	SourceURL string
+}
+
 // When SQLite data is prepared for sending to Redash (as JSON), the RedashColumnMeta and RedashTableData structures
 // are used to hold it
 type RedashColumnMeta struct {
@@ -423,11 +576,56 @@ type ReleaseEntry struct {
 	Commit        string    `json:"commit"`
 	Date          time.Time `json:"date"`
 	Description   string    `json:"description"`
+	Manifest      string    `json:"manifest,omitempty"` // The signed ReleaseManifest JSON, byte for byte
 	ReleaserEmail string    `json:"email"`
 	ReleaserName  string    `json:"name"`
+	Signature     string    `json:"signature,omitempty"`
 	Size          int64     `json:"size"`
 }
 
+// The details of a release which are signed by the server, so clients can check the database they downloaded
+type ReleaseManifest struct {
+	CommitID   string    `json:"commit"`
+	Database   string    `json:"database"`
+	LicenceSHA string    `json:"licence_sha256"`
+	Release    string    `json:"release"`
+	Sha256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type SchemaColumn struct {
+	Default    string `json:"default"`
+	Name       string `json:"name"`
+	NotNull    bool   `json:"not_null"`
+	PrimaryKey int    `json:"primary_key"`
+	Type       string `json:"type"`
+}
+
+type SchemaForeignKey struct {
+	From  []string `json:"from"`
+	Table string   `json:"table"`
+	To    []string `json:"to"`
+}
+
+// A table, view, index or trigger in a SQLite database.  For indexes and triggers, Table is the table they're on
+// and Columns holds the indexed columns
+type SchemaObject struct {
+	Columns     []SchemaColumn     `json:"columns,omitempty"`
+	ForeignKeys []SchemaForeignKey `json:"foreign_keys,omitempty"`
+	Name        string             `json:"name"`
+	SQL         string             `json:"sql"`
+	Table       string             `json:"table"`
+}
+
+// A signed release manifest, along with the public key needed to check it.  The signature covers the exact bytes of
+// the Manifest string, which is the JSON of a ReleaseManifest
+type SignedReleaseManifest struct {
+	Manifest  string `json:"manifest"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
 type SQLiteDBinfo struct {
 	Info     DBInfo
 	MaxRows  int
@@ -436,15 +634,18 @@ type SQLiteDBinfo struct {
 }
 
 type SQLiteRecordSet struct {
-	ColCount  int
-	ColNames  []string
-	Offset    int
-	Records   []DataRow
-	RowCount  int
-	SortCol   string
-	SortDir   string
-	Tablename string
-	TotalRows int
+	ColCount   int
+	ColNames   []string
+	LastCursor string
+	NextCursor string
+	Offset     int
+	PrevCursor string
+	Records    []DataRow
+	RowCount   int
+	SortCol    string
+	SortDir    string
+	Tablename  string
+	TotalRows  int
 }
 
 type StatusUpdateEntry struct {
@@ -453,6 +654,18 @@ type StatusUpdateEntry struct {
 	URL    string `json:"event_url"`
 }
 
+// Data quality report for a table or view
+type TableProfile struct {
+	Columns   []ColumnProfile `json:"columns"`
+	RowCount  int64           `json:"row_count"`
+	Tablename string          `json:"table"`
+}
+
+type TableStats struct {
+	Bytes int64 `json:"bytes"`
+	Rows  int64 `json:"rows"`
+}
+
 type TagEntry struct {
 	Commit      string    `json:"commit"`
 	Date        time.Time `json:"date"`
@@ -467,10 +680,50 @@ type UploadRow struct {
 	UploadDate time.Time `json:"upload_date"`
 }
 
+// A resumable upload in progress.  Fields holds the form fields given when the upload was started, which are used
+// when adding the database once the upload is finished.
+type UploadSession struct {
+	Created time.Time           `json:"created"`
+	DBName  string              `json:"dbname"`
+	Fields  map[string][]string `json:"fields"`
+	ID      string              `json:"id"`
+	Sha256  string              `json:"sha256"`
+	Size    int64               `json:"size"`
+	User    string              `json:"user"`
+}
+
+// A filter condition for table data.  Type is one of the keys of whereClauseTypes (eg "eq", "contains", "null")
 type WhereClause struct {
-	Column string
-	Type   string
-	Value  string
+	Column string `json:"column"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+}
+
+type ValidationFailure struct {
+	Message  string `json:"message"`
+	Rejected bool   `json:"rejected"`
+	Rule     string `json:"rule"`
+}
+
+// A data validation rule, checked against each new commit of a database.  Type is one of:
+//   * "query" - Query must return no rows
+//   * "table" - Table must exist
+//   * "columns" - Table must have all of the given columns
+//   * "foreignkeys" - PRAGMA foreign_key_check must return no rows
+//   * "unique" - The given columns of Table must be unique
+// When Reject is true, commits failing the rule are rejected.  Otherwise they're accepted but flagged.
+type ValidationRule struct {
+	Columns []string `json:"columns,omitempty"`
+	Name    string   `json:"name"`
+	Query   string   `json:"query,omitempty"`
+	Reject  bool     `json:"reject"`
+	Table   string   `json:"table,omitempty"`
+	Type    string   `json:"type"`
+}
+
+type ValueCount struct {
+	Count int64  `json:"count"`
+	Value string `json:"value"`
 }
 
 type UserInfo struct {
@@ -0,0 +1,296 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resumable uploads let large databases be sent in chunks.  The client starts an upload session with the size and
+// SHA256 of the database, sends the chunks in order (resuming from the current offset after a dropped connection),
+// then finishes the session.  The partial file and the session details are kept in the disk cache directory.
+
+// How long an unfinished upload session is kept after the last chunk was received for it
+const UploadSessionExpiry = 24 * time.Hour
+
+// The maximum number of unfinished upload sessions each user can have
+const MaxUploadSessionsPerUser = 5
+
+// The maximum total size (in MB) reserved by all unfinished upload sessions, as the data for them is kept in the disk
+// cache directory
+const MaxUploadSessionsSize = 8192
+
+var (
+	// Locks used to stop chunks for the same upload session being written at the same time
+	uploadLocks sync.Map
+
+	// Lock used so new upload sessions are checked against the limits one at a time
+	uploadSessionsLock sync.Mutex
+)
+
+// Background worker which removes expired upload sessions
+func UploadSessionWorker() {
+	for {
+		expireUploadSessions()
+		time.Sleep(time.Hour)
+	}
+}
+
+// Starts a new resumable upload session for a database
+func CreateUploadSession(loggedInUser string, dbName string, size int64, sha string,
+	fields map[string][]string) (sess UploadSession, err error) {
+	if size <= 0 || size > MaxDatabaseSize*1024*1024 {
+		return sess, newActionError(http.StatusBadRequest,
+			fmt.Sprintf("Database size needs to be between 1 byte and %d MB", MaxDatabaseSize))
+	}
+	err = ValidateCommitID(sha) // SHA256 values have the same format as commit IDs
+	if err != nil {
+		return sess, newActionError(http.StatusBadRequest, "Missing or invalid SHA256 for the database")
+	}
+
+	// Make sure the new session keeps within the limits on unfinished sessions
+	uploadSessionsLock.Lock()
+	defer uploadSessionsLock.Unlock()
+	userCount, totalSize := uploadSessionUsage(loggedInUser)
+	if userCount >= MaxUploadSessionsPerUser {
+		return sess, newActionError(http.StatusTooManyRequests, fmt.Sprintf("You already have %d unfinished "+
+			"uploads.  Please finish or cancel one of them first.", userCount))
+	}
+	if totalSize+size > MaxUploadSessionsSize*1024*1024 {
+		return sess, newActionError(http.StatusInsufficientStorage,
+			"The server doesn't have room for another upload right now.  Please try again later.")
+	}
+
+	// Create the session
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return sess, err
+	}
+	sess = UploadSession{
+		Created: time.Now().UTC(),
+		DBName:  dbName,
+		Fields:  fields,
+		ID:      hex.EncodeToString(b),
+		Sha256:  strings.ToLower(sha),
+		Size:    size,
+		User:    loggedInUser,
+	}
+	err = os.MkdirAll(uploadDir(), 0750)
+	if err != nil {
+		return sess, err
+	}
+	f, err := os.OpenFile(uploadPath(sess.ID, "part"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return sess, err
+	}
+	f.Close()
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return sess, err
+	}
+	err = ioutil.WriteFile(uploadPath(sess.ID, "json"), data, 0640)
+	if err != nil {
+		log.Printf("Error when saving upload session '%s': %v\n", sess.ID, err)
+		os.Remove(uploadPath(sess.ID, "part"))
+		return sess, err
+	}
+	return sess, nil
+}
+
+// Finishes with an upload session, once an attempt to store its database has returned the given HTTP status.  The
+// session is kept if the attempt failed in a way which retrying might fix (eg a database error, a conflict with another
+// change, or rejection by data validation rules the owner can change), so the client can finish the upload again
+// without resending the data.  Kept sessions are removed when they expire, if they're not finished first.
+func EndUploadSession(loggedInUser string, id string, status int) {
+	if status >= http.StatusInternalServerError || status == http.StatusConflict ||
+		status == http.StatusUnprocessableEntity {
+		return
+	}
+	err := RemoveUploadSession(loggedInUser, id)
+	if err != nil {
+		log.Printf("Error when removing upload session '%s': %v\n", id, err)
+	}
+}
+
+// Checks a finished upload session has all of the database, and the SHA256 matches the one given when the session
+// was started.  Returns the database file ready for reading, which the caller needs to close before finishing with
+// the session using EndUploadSession().
+func FinishUploadSession(loggedInUser string, id string) (sess UploadSession, db *os.File, err error) {
+	sess, offset, err := UploadSessionDetails(loggedInUser, id)
+	if err != nil {
+		return sess, nil, err
+	}
+	if offset != sess.Size {
+		return sess, nil, newActionError(http.StatusConflict,
+			fmt.Sprintf("Upload is incomplete.  %d of %d bytes received", offset, sess.Size))
+	}
+	db, err = os.Open(uploadPath(id, "part"))
+	if err != nil {
+		return sess, nil, err
+	}
+	s := sha256.New()
+	_, err = io.Copy(s, db)
+	if err == nil {
+		_, err = db.Seek(0, 0)
+	}
+	if err != nil {
+		db.Close()
+		return sess, nil, err
+	}
+	if hex.EncodeToString(s.Sum(nil)) != sess.Sha256 {
+		db.Close()
+		return sess, nil, newActionError(http.StatusBadRequest,
+			"SHA256 of the uploaded data doesn't match the value given when the upload was started")
+	}
+	return sess, db, nil
+}
+
+// Removes an upload session, and any data uploaded for it
+func RemoveUploadSession(loggedInUser string, id string) error {
+	_, _, err := UploadSessionDetails(loggedInUser, id)
+	if err != nil {
+		return err
+	}
+	removeUploadFiles(id)
+	return nil
+}
+
+// Returns the details of an upload session, along with the number of bytes received so far
+func UploadSessionDetails(loggedInUser string, id string) (sess UploadSession, offset int64, err error) {
+	err = Validate.Var(id, "hexadecimal,len=32")
+	if err != nil {
+		return sess, 0, newActionError(http.StatusBadRequest, "Invalid upload session ID")
+	}
+	data, err := ioutil.ReadFile(uploadPath(id, "json"))
+	if os.IsNotExist(err) {
+		return sess, 0, newActionError(http.StatusNotFound, "Unknown upload session")
+	}
+	if err != nil {
+		return sess, 0, err
+	}
+	err = json.Unmarshal(data, &sess)
+	if err != nil {
+		return sess, 0, err
+	}
+	if strings.ToLower(sess.User) != strings.ToLower(loggedInUser) {
+		return sess, 0, newActionError(http.StatusNotFound, "Unknown upload session")
+	}
+	fi, err := os.Stat(uploadPath(id, "part"))
+	if err != nil {
+		return sess, 0, err
+	}
+	return sess, fi.Size(), nil
+}
+
+// Appends a chunk of data to an upload session.  The offset given by the client has to match the amount of data
+// received so far, so chunks can't be written out of order.  Returns the new offset.
+func WriteUploadChunk(loggedInUser string, id string, offset int64, chunk io.Reader) (newOffset int64, err error) {
+	// Only write one chunk for each session at a time
+	l, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	l.(*sync.Mutex).Lock()
+	defer l.(*sync.Mutex).Unlock()
+
+	sess, cur, err := UploadSessionDetails(loggedInUser, id)
+	if err != nil {
+		return 0, err
+	}
+	if offset != cur {
+		return cur, newActionError(http.StatusConflict,
+			fmt.Sprintf("Chunk offset %d doesn't match the %d bytes received so far", offset, cur))
+	}
+
+	// Append the chunk, refusing anything past the size given when the session was started
+	f, err := os.OpenFile(uploadPath(id, "part"), os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return cur, err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, io.LimitReader(chunk, sess.Size-cur+1))
+	newOffset = cur + n
+	if err == nil && newOffset > sess.Size {
+		f.Truncate(sess.Size)
+		return sess.Size, newActionError(http.StatusRequestEntityTooLarge,
+			"Chunk goes past the end of the database size given when the upload was started")
+	}
+	// The session is kept while chunks keep arriving, even if that takes longer than the expiry time
+	now := time.Now()
+	os.Chtimes(uploadPath(id, "json"), now, now)
+	if err != nil {
+		// Keep whatever was received, so the client can resume from there
+		log.Printf("Error when writing chunk for upload session '%s': %v\n", id, err)
+		return newOffset, err
+	}
+	return newOffset, nil
+}
+
+// Returns the number of unfinished upload sessions a user has, and the total size reserved by everyone's sessions
+func uploadSessionUsage(loggedInUser string) (userCount int, totalSize int64) {
+	files, err := filepath.Glob(filepath.Join(uploadDir(), "*.json"))
+	if err != nil {
+		return
+	}
+	for _, j := range files {
+		fi, err := os.Stat(j)
+		if err != nil || time.Since(fi.ModTime()) >= UploadSessionExpiry {
+			continue
+		}
+		data, err := ioutil.ReadFile(j)
+		if err != nil {
+			continue
+		}
+		var sess UploadSession
+		err = json.Unmarshal(data, &sess)
+		if err != nil {
+			continue
+		}
+		if strings.ToLower(sess.User) == strings.ToLower(loggedInUser) {
+			userCount++
+		}
+		totalSize += sess.Size
+	}
+	return
+}
+
+// Removes upload sessions which haven't received a chunk for longer than the expiry time
+func expireUploadSessions() {
+	files, err := filepath.Glob(filepath.Join(uploadDir(), "*.json"))
+	if err != nil {
+		return
+	}
+	for _, j := range files {
+		fi, err := os.Stat(j)
+		if err != nil || time.Since(fi.ModTime()) < UploadSessionExpiry {
+			continue
+		}
+		removeUploadFiles(strings.TrimSuffix(filepath.Base(j), ".json"))
+	}
+}
+
+// Removes the files for an upload session
+func removeUploadFiles(id string) {
+	os.Remove(uploadPath(id, "json"))
+	os.Remove(uploadPath(id, "part"))
+	uploadLocks.Delete(id)
+}
+
+// Returns the directory upload sessions are kept in
+func uploadDir() string {
+	return filepath.Join(Conf.DiskCache.Directory, "uploads")
+}
+
+// Returns the path to one of the files for an upload session
+func uploadPath(id string, ext string) string {
+	return filepath.Join(uploadDir(), id+"."+ext)
+}
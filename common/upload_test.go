@@ -0,0 +1,110 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Checks upload sessions only accept sensible sizes, and that chunks have to be sent in order and can't go past the
+// size given when the session was started
+func TestUploadSessions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbhub-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldCache := Conf.DiskCache.Directory
+	Conf.DiskCache.Directory = dir
+	defer func() { Conf.DiskCache.Directory = oldCache }()
+
+	// The data the chunks below should leave behind
+	final := "012345678901234" + "01234"
+	sum := sha256.Sum256([]byte(final))
+	sha := hex.EncodeToString(sum[:])
+
+	sizes := []struct {
+		size   int64
+		sha    string
+		status int
+	}{
+		{size: 0, sha: sha, status: http.StatusBadRequest},
+		{size: -1, sha: sha, status: http.StatusBadRequest},
+		{size: MaxDatabaseSize*1024*1024 + 1, sha: sha, status: http.StatusBadRequest},
+		{size: 20, sha: "not a sha", status: http.StatusBadRequest},
+		{size: 20, sha: strings.ToUpper(sha), status: 0},
+	}
+	var sess UploadSession
+	for _, j := range sizes {
+		sess, err = CreateUploadSession("alice", "test.sqlite", j.size, j.sha, nil)
+		if actionErrorStatus(err) != j.status {
+			t.Fatalf("CreateUploadSession(size %d, sha %q) returned error %v, wanted status %d", j.size, j.sha,
+				err, j.status)
+		}
+	}
+	if sess.Sha256 != sha {
+		t.Fatalf("Upload session has SHA256 %q, wanted %q", sess.Sha256, sha)
+	}
+
+	chunks := []struct {
+		user      string
+		offset    int64
+		data      string
+		newOffset int64
+		status    int
+	}{
+		{user: "alice", offset: 0, data: "0123456789", newOffset: 10, status: 0},
+		{user: "alice", offset: 0, data: "abc", newOffset: 10, status: http.StatusConflict},
+		{user: "alice", offset: 15, data: "abc", newOffset: 10, status: http.StatusConflict},
+		{user: "bob", offset: 10, data: "abc", newOffset: 0, status: http.StatusNotFound},
+		{user: "ALICE", offset: 10, data: "01234", newOffset: 15, status: 0},
+		{user: "alice", offset: 15, data: "0123456789", newOffset: 20, status: http.StatusRequestEntityTooLarge},
+		{user: "alice", offset: 20, data: "", newOffset: 20, status: 0},
+	}
+	for _, j := range chunks {
+		n, err := WriteUploadChunk(j.user, sess.ID, j.offset, strings.NewReader(j.data))
+		if n != j.newOffset || actionErrorStatus(err) != j.status {
+			t.Fatalf("WriteUploadChunk(%q, offset %d, %q) = (%d, %v), wanted offset %d and status %d", j.user,
+				j.offset, j.data, n, err, j.newOffset, j.status)
+		}
+	}
+
+	// The finished upload should have exactly the expected data
+	_, db, err := FinishUploadSession("alice", sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(db)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != final {
+		t.Fatalf("Finished upload has data %q, wanted %q", got, final)
+	}
+	EndUploadSession("alice", sess.ID, http.StatusCreated)
+	_, _, err = UploadSessionDetails("alice", sess.ID)
+	if actionErrorStatus(err) != http.StatusNotFound {
+		t.Fatalf("Upload session still exists after being ended, error was %v", err)
+	}
+
+	// Users can only have a limited number of unfinished sessions
+	for i := 0; i <= MaxUploadSessionsPerUser; i++ {
+		want := 0
+		if i == MaxUploadSessionsPerUser {
+			want = http.StatusTooManyRequests
+		}
+		_, err = CreateUploadSession("carol", "test.sqlite", 20, sha, nil)
+		if actionErrorStatus(err) != want {
+			t.Fatalf("Upload session %d for one user returned error %v, wanted status %d", i+1, err, want)
+		}
+	}
+	_, err = CreateUploadSession("dave", "test.sqlite", 20, sha, nil)
+	if err != nil {
+		t.Fatalf("Upload session for another user returned error %v", err)
+	}
+}
@@ -2,6 +2,7 @@
 package common
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -83,6 +84,19 @@ func GetFormBranch(r *http.Request) (string, error) {
 	return b, nil
 }
 
+// Returns the table paging cursor (if any) present in the form data.
+func GetFormCursor(r *http.Request) (string, error) {
+	a := r.FormValue("cursor")
+	if a == "" {
+		return "", nil
+	}
+	_, err := decodeTableCursor(a)
+	if err != nil {
+		return "", err
+	}
+	return a, nil
+}
+
 // Return the requested database commit, from form data.
 func GetFormCommit(r *http.Request) (string, error) {
 	// If no commit was given in the input, returns an empty string
@@ -171,6 +185,25 @@ func GetFormTag(r *http.Request) (tag string, err error) {
 	return c, nil
 }
 
+// Returns the table filter conditions (if any) present in the form data.  They're expected as a JSON encoded list.
+func GetFormWhereClauses(r *http.Request) (filters []WhereClause, err error) {
+	a := r.FormValue("filter")
+	if a == "" {
+		return nil, nil
+	}
+	err = json.Unmarshal([]byte(a), &filters)
+	if err != nil {
+		log.Printf("Error when decoding table filter: %v\n", err)
+		return nil, errors.New("Invalid table filter")
+	}
+	err = ValidateWhereClauses(filters)
+	if err != nil {
+		log.Printf("Validation failed for table filter: %v\n", err)
+		return nil, errors.New("Invalid table filter")
+	}
+	return filters, nil
+}
+
 // Return the username, database, and commit (if any) present in the form data.
 func GetFormUDC(r *http.Request) (string, string, string, error) {
 	// Extract the username
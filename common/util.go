@@ -23,14 +23,14 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 	createBranch bool, branchName string, commitID string, public bool, licenceName string, commitMsg string,
 	sourceURL string, newDB io.Reader, serverSw string, lastModified time.Time, commitTime time.Time,
 	authorName string, authorEmail string, committerName string, committerEmail string, otherParents []string,
-	dbSha string) (numBytes int64, newCommitID string, err error) {
+	dbSha string) (numBytes int64, newCommitID string, failures []ValidationFailure, err error) {
 
 	// Create a temporary file to store the database in
 	tempDB, err := ioutil.TempFile(Conf.DiskCache.Directory, "dbhub-upload-")
 	if err != nil {
 		log.Printf("Error creating temporary file. User: '%s', Database: '%s%s%s', Filename: '%s', Error: %v\n",
 			loggedInUser, dbOwner, dbFolder, dbName, tempDB.Name(), err)
-		return 0, "", err
+		return 0, "", nil, err
 	}
 	tempDBName := tempDB.Name()
 
@@ -44,23 +44,29 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 	if err != nil {
 		log.Printf("Error when writing the uploaded db to a temp file. User: '%s', Database: '%s%s%s' "+
 			"Error: %v\n", loggedInUser, dbOwner, dbFolder, dbName, err)
-		return 0, "", err
+		return 0, "", nil, err
 	}
 
 	// Sanity check the uploaded database, and get the list of tables in the database
 	sTbls, err := SanityCheck(tempDBName)
 	if err != nil {
-		return 0, "", err
+		return 0, "", nil, err
+	}
+
+	// Gather the statistics for the uploaded database, to be stored with the commit
+	stats, err := ReadSQLiteStats(tempDBName)
+	if err != nil {
+		return 0, "", nil, err
 	}
 
 	// Return to the start of the temporary file
 	newOff, err := tempDB.Seek(0, 0)
 	if err != nil {
 		log.Printf("Seeking on the temporary file failed: %v\n", err.Error())
-		return 0, "", err
+		return 0, "", nil, err
 	}
 	if newOff != 0 {
-		return 0, "", errors.New("Seeking to the start of the temporary file failed")
+		return 0, "", nil, errors.New("Seeking to the start of the temporary file failed")
 	}
 
 	// Generate sha256 of the uploaded file
@@ -69,13 +75,13 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 	s := sha256.New()
 	_, err = io.CopyBuffer(s, tempDB, buf)
 	if err != nil {
-		return 0, "", err
+		return 0, "", nil, err
 	}
 	sha := hex.EncodeToString(s.Sum(nil))
 
 	// If we were given a SHA256 for the file, make sure it matches our calculated one
 	if dbSha != "" && dbSha != sha {
-		return 0, "",
+		return 0, "", nil,
 			fmt.Errorf("SHA256 given (%s) for uploaded file doesn't match the calculated value (%s)", dbSha, sha)
 	}
 
@@ -85,19 +91,19 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 	var branches map[string]BranchEntry
 	exists, err := CheckDBExists(loggedInUser, loggedInUser, dbFolder, dbName)
 	if err != err {
-		return 0, "", err
+		return 0, "", nil, err
 	}
 	if exists {
 		// Load the existing branchHeads for the database
 		branches, err = GetBranches(loggedInUser, dbFolder, dbName)
 		if err != nil {
-			return 0, "", err
+			return 0, "", nil, err
 		}
 
 		// If no branch name was given, use the default for the database
 		defBranch, err = GetDefaultBranchName(loggedInUser, dbFolder, dbName)
 		if err != nil {
-			return 0, "", err
+			return 0, "", nil, err
 		}
 		if branchName == "" {
 			branchName = defBranch
@@ -113,6 +119,23 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 		needDefaultBranchCreated = true
 	}
 
+	// Run the data validation rules for the database (if any) against the upload.  Failed rules either reject the
+	// upload, or are recorded in the commit
+	if exists {
+		rules, err := GetValidationRules(loggedInUser, dbFolder, dbName)
+		if err != nil {
+			return 0, "", nil, err
+		}
+		failures, err = checkValidationRulesFile(tempDBName, rules)
+		if err != nil {
+			return 0, "", nil, err
+		}
+		err = ValidationError(failures)
+		if err != nil {
+			return 0, "", failures, err
+		}
+	}
+
 	// Create a dbTree entry for the individual database file
 	var e DBTreeEntry
 	e.EntryType = DATABASE
@@ -120,13 +143,14 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 	e.Sha256 = sha
 	e.LastModified = lastModified.UTC()
 	e.Size = numBytes
+	e.Stats = &stats
 	if licenceName == "" || licenceName == "Not specified" {
 		// No licence was specified by the client, so check if the database is already in the system and
 		// already has one.  If so, we use that.
 		if exists {
 			lic, err := CommitLicenceSHA(loggedInUser, dbFolder, dbName, commitID)
 			if err != nil {
-				return 0, "", err
+				return 0, "", nil, err
 			}
 			if lic != "" {
 				// The previous commit for the database had a licence, so we use that for this commit too
@@ -136,7 +160,7 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 			// It's a new database, and the licence hasn't been specified
 			e.LicenceSHA, err = GetLicenceSha256FromName(loggedInUser, licenceName)
 			if err != nil {
-				return 0, "", err
+				return 0, "", nil, err
 			}
 
 			// If no commit message was given, use a default one and include the info of no licence being specified
@@ -148,7 +172,7 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 		// A licence was specified by the client, so use that
 		e.LicenceSHA, err = GetLicenceSha256FromName(loggedInUser, licenceName)
 		if err != nil {
-			return 0, "", err
+			return 0, "", nil, err
 		}
 
 		// Generate an appropriate commit message if none was provided
@@ -160,13 +184,13 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 				// The database already exists, so check if the licence has changed
 				lic, err := CommitLicenceSHA(loggedInUser, dbFolder, dbName, commitID)
 				if err != nil {
-					return 0, "", err
+					return 0, "", nil, err
 				}
 				if e.LicenceSHA != lic {
 					// The licence has changed, so we create a reasonable commit message indicating this
 					l, _, err := GetLicenceInfoFromSha256(loggedInUser, lic)
 					if err != nil {
-						return 0, "", err
+						return 0, "", nil, err
 					}
 					commitMsg = fmt.Sprintf("Database licence changed from '%s' to '%s'.", l, licenceName)
 				}
@@ -182,12 +206,12 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 	// Retrieve the details for the user
 	usr, err := User(loggedInUser)
 	if err != nil {
-		return 0, "", err
+		return 0, "", nil, err
 	}
 
 	// If either the display name or email address is empty, tell the user we need them first
 	if usr.DisplayName == "" || usr.Email == "" {
-		return 0, "", errors.New("You need to set your full name and email address in Preferences first")
+		return 0, "", nil, errors.New("You need to set your full name and email address in Preferences first")
 	}
 
 	// Construct a commit structure pointing to the tree
@@ -218,6 +242,7 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 	if otherParents != nil {
 		c.OtherParents = otherParents
 	}
+	c.ValidationFailures = failures
 
 	// If the database already exists, determine the commit ID to use as the parent
 	if exists {
@@ -256,9 +281,9 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 									}
 								}
 							}
-							return 0, "", fmt.Errorf(msg)
+							return 0, "", nil, fmt.Errorf(msg)
 						}
-						return 0, "", err
+						return 0, "", nil, err
 					}
 				}
 				c.Parent = commitID
@@ -269,7 +294,7 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 			// The branch name given isn't (yet) part of the database.  If we've been told to create the branch, then
 			// we use the commit also passed (a requirement!) as the parent.  Otherwise, we error out
 			if !createBranch {
-				return 0, "", errors.New("Error when looking up branch details")
+				return 0, "", nil, errors.New("Error when looking up branch details")
 			}
 			c.Parent = commitID
 		}
@@ -280,113 +305,87 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 
 	// If the database already exists, count the number of commits in the new branch
 	commitCount := 1
-	if exists {
-		commitList, err := GetCommitList(loggedInUser, dbFolder, dbName)
+	if exists && c.Parent != "" {
+		hist, err := commitAncestors(loggedInUser, dbFolder, dbName, []string{c.Parent})
 		if err != nil {
-			return 0, "", err
-		}
-		var ok bool
-		var c2 CommitEntry
-		c2.Parent = c.Parent
-		for c2.Parent != "" {
-			commitCount++
-			c2, ok = commitList[c2.Parent]
-			if !ok {
-				m := fmt.Sprintf("Error when counting commits in branch '%s' of database '%s%s%s'\n", branchName,
-					loggedInUser, dbFolder, dbName)
-				log.Print(m)
-				return 0, "", errors.New(m)
-			}
+			return 0, "", nil, err
 		}
+		if !hist[c.Parent] {
+			m := fmt.Sprintf("Error when counting commits in branch '%s' of database '%s%s%s'\n", branchName,
+				loggedInUser, dbFolder, dbName)
+			log.Print(m)
+			return 0, "", nil, errors.New(m)
+		}
+		commitCount += len(hist)
 	}
 
 	// Return to the start of the temporary file again
 	newOff, err = tempDB.Seek(0, 0)
 	if err != nil {
 		log.Printf("Seeking on the temporary file (2nd time) failed: %v\n", err.Error())
-		return 0, "", err
+		return 0, "", nil, err
 	}
 	if newOff != 0 {
-		return 0, "", errors.New("Seeking to start of temporary database file didn't work")
+		return 0, "", nil, errors.New("Seeking to start of temporary database file didn't work")
 	}
 
-	// Update the branch with the commit for this new database upload & the updated commit count for the branch
-	b := branches[branchName]
-	b.Commit = c.ID
-	b.CommitCount = commitCount
-	branches[branchName] = b
-	err = StoreDatabase(loggedInUser, dbFolder, dbName, branches, c, public, tempDB, sha, numBytes, "",
-		"", needDefaultBranchCreated, branchName, sourceURL)
+	// Check if the storage back end already has this database file, as an earlier upload (possibly of a different
+	// database) may have stored it.  If so, it mustn't be removed if storing the upload details fails.  StoreDatabase
+	// locks the file and checks it's still there, in case a failed upload of the same file removes it in between
+	bkt := sha[:MinioFolderChars]
+	id := sha[MinioFolderChars:]
+	fileExisted, err := storageBackend.Exists(bkt, id)
 	if err != nil {
-		return 0, "", err
+		log.Printf("Checking if database file '%s' is already stored failed: %v\n", sha, err)
+		return 0, "", nil, err
 	}
 
-	// If the database already existed, update it's contributor count
-	if exists {
-		err = UpdateContributorsCount(loggedInUser, dbFolder, dbName)
-		if err != nil {
-			return 0, "", err
+	// Store the database file
+	err = StoreDatabaseFile(tempDB, sha, numBytes)
+	if err != nil {
+		if !fileExisted {
+			removeOrphanedDatabaseFile(sha)
 		}
+		return 0, "", nil, err
 	}
 
-	// If a new branch was created, then update the branch count for the database
-	// Note, this could probably be merged into the StoreDatabase() call above, but it should be good enough for now
-	if createBranch {
-		err = StoreBranches(dbOwner, dbFolder, dbName, branches)
-		if err != nil {
-			return 0, "", err
-		}
+	// When adding to an existing branch, the branch head is only moved if it still points at the parent commit.  This
+	// stops concurrent uploads to the same branch from clobbering each other
+	var oldHead string
+	if _, ok := branches[branchName]; ok {
+		oldHead = c.Parent
 	}
 
-	// If the newly uploaded database is on the default branch, check if the default table is present in this version
-	// of the database.  If it's not, we need to clear the default table value
-	if branchName == defBranch {
-		defTbl, err := GetDefaultTableName(dbOwner, dbFolder, dbName)
-		if err != nil {
-			return 0, "", err
-		}
-		defFound := false
-		for _, j := range sTbls {
-			if j == defTbl {
-				defFound = true
-			}
-		}
-		if !defFound {
-			// The default table is present in the previous commit, so we clear the default table value
-			err = StoreDefaultTableName(dbOwner, dbFolder, dbName, "")
-			if err != nil {
-				return 0, "", err
-			}
+	// Was a user agent part of the request?  There's no request when the upload comes from a background job, such as
+	// source URL mirroring
+	var ipAddr, userAgent string
+	if r != nil {
+		ipAddr = r.RemoteAddr
+		ua, ok := r.Header["User-Agent"]
+		if ok {
+			userAgent = ua[0]
 		}
 	}
 
-	// If the database didn't previous exist, add the user to the watch list for the database
-	if !exists {
-		err = ToggleDBWatch(loggedInUser, dbOwner, dbFolder, dbName)
-		if err != nil {
-			return 0, "", err
+	// Store the commit, branch head, and the rest of the upload details
+	err = StoreDatabase(loggedInUser, dbFolder, dbName, c, public, "", "", needDefaultBranchCreated, branchName,
+		oldHead, commitCount, sourceURL, sTbls, ipAddr, serverSw, userAgent, sha)
+	if err != nil {
+		if !fileExisted {
+			removeOrphanedDatabaseFile(sha)
 		}
+		return 0, "", nil, err
 	}
 
-	// Was a user agent part of the request?
-	var userAgent string
-	ua, ok := r.Header["User-Agent"]
-	if ok {
-		userAgent = ua[0]
-	}
-
-	// Make a record of the upload
-	err = LogUpload(loggedInUser, dbFolder, dbName, loggedInUser, r.RemoteAddr, serverSw, userAgent, time.Now().UTC(), sha)
-	if err != nil {
-		return 0, "", err
-	}
+	// Cache the row counts for the tables in the new database file
+	CacheRowCounts(sha, e.Stats)
 
 	// Invalidate the memcached entry for the database (only really useful if we're updating an existing database)
 	err = InvalidateCacheEntry(loggedInUser, loggedInUser, "/", dbName, "") // Empty string indicates "for all versions"
 	if err != nil {
 		// Something went wrong when invalidating memcached entries for the database
 		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
-		return 0, "", err
+		return 0, "", nil, err
 	}
 
 	// Invalidate any memcached entries for the previous highest version # of the database
@@ -394,20 +393,19 @@ func AddDatabase(r *http.Request, loggedInUser string, dbOwner string, dbFolder
 	if err != nil {
 		// Something went wrong when invalidating memcached entries for any previous database
 		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
-		return 0, "", err
+		return 0, "", nil, err
 	}
 
 	// Database successfully uploaded
-	return numBytes, c.ID, nil
+	return numBytes, c.ID, c.ValidationFailures, nil
 }
 
 // Returns the licence used by the database in a given commit
 func CommitLicenceSHA(dbOwner string, dbFolder string, dbName string, commitID string) (licenceSHA string, err error) {
-	commits, err := GetCommitList(dbOwner, dbFolder, dbName)
+	c, ok, err := GetCommit(dbOwner, dbFolder, dbName, commitID)
 	if err != nil {
 		return "", err
 	}
-	c, ok := commits[commitID]
 	if !ok {
 		return "", fmt.Errorf("Commit not found in database commit list")
 	}
@@ -722,24 +720,20 @@ func DeleteBranchHistory(dbOwner string, dbFolder string, dbName string, branchN
 		}
 	}
 
-	// Rewind the branch history
-	b, ok := branchList[branchName]
-	b.Commit = commitID
-	b.CommitCount = commitCount
-	branchList[branchName] = b
-	err = StoreBranches(dbOwner, dbFolder, dbName, branchList)
-	if err != nil {
-		return
-	}
-
-	// Remove any no-longer-needed commits
+	// Rewind the branch history, and remove any no-longer-needed commits, as long as the branch hasn't moved since it
+	// was checked above
 	// TODO: We may want to consider clearing any memcache entries for the deleted commits too
+	var removeList []string
 	for cid, del := range checkList {
 		if del == true {
-			delete(commitList, cid)
+			removeList = append(removeList, cid)
 		}
 	}
-	err = StoreCommits(dbOwner, dbFolder, dbName, commitList)
+	b, ok := branchList[branchName]
+	oldHead := b.Commit
+	b.Commit = commitID
+	b.CommitCount = commitCount
+	err = updateBranchHead(dbOwner, dbFolder, dbName, branchName, oldHead, b, nil, removeList)
 	return
 }
 
@@ -872,6 +866,18 @@ func IsCommitInBranchHistory(dbOwner string, dbFolder string, dbName string, bra
 	return found, nil
 }
 
+// Returns the name of the most recent release in a list of releases.  Releases made at the same time are told apart
+// by their names, so the result doesn't change between calls.
+func LatestReleaseName(releases map[string]ReleaseEntry) (name string, ok bool) {
+	var latest ReleaseEntry
+	for n, r := range releases {
+		if !ok || r.Date.After(latest.Date) || (r.Date.Equal(latest.Date) && n > name) {
+			name, latest, ok = n, r, true
+		}
+	}
+	return
+}
+
 // Look for the next child fork in a fork tree
 func nextChild(loggedInUser string, rawListPtr *[]ForkEntry, outputListPtr *[]ForkEntry, forkTrailPtr *[]int, iconDepth int) ([]ForkEntry, []int, bool) {
 	// TODO: This approach feels half arsed.  Maybe redo it as a recursive function instead?
@@ -939,6 +945,63 @@ func RandomString(length int) string {
 	return string(randomString)
 }
 
+// Works out the commit ID for a database from a requested commit, release, branch, or tag name (checked in that
+// order).  The release name "latest" gives the most recent release, unless there's a release with that name.  If none
+// of them were given, the head commit of the default branch is returned.
+func ResolveCommit(dbOwner string, dbFolder string, dbName string, commitID string, releaseName string,
+	branchName string, tagName string) (string, error) {
+	switch {
+	case commitID != "":
+		_, ok, err := GetCommit(dbOwner, dbFolder, dbName, commitID)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("Unknown commit for database '%s%s%s'", dbOwner, dbFolder, dbName)
+		}
+		return commitID, nil
+	case releaseName != "":
+		releases, err := GetReleases(dbOwner, dbFolder, dbName)
+		if err != nil {
+			return "", err
+		}
+		rls, ok := releases[releaseName]
+		if !ok && releaseName == LatestRelease {
+			var name string
+			name, ok = LatestReleaseName(releases)
+			if !ok {
+				return "", errors.New("This database doesn't have any releases")
+			}
+			rls = releases[name]
+		}
+		if !ok {
+			return "", errors.New("Unknown release requested for this database")
+		}
+		return rls.Commit, nil
+	case branchName != "":
+		branchHeads, err := GetBranches(dbOwner, dbFolder, dbName)
+		if err != nil {
+			return "", err
+		}
+		b, ok := branchHeads[branchName]
+		if !ok {
+			return "", errors.New("Unknown branch requested for this database")
+		}
+		return b.Commit, nil
+	case tagName != "":
+		tags, err := GetTags(dbOwner, dbFolder, dbName)
+		if err != nil {
+			return "", err
+		}
+		tg, ok := tags[tagName]
+		if !ok {
+			return "", errors.New("Unknown tag requested for this database")
+		}
+		return tg.Commit, nil
+	}
+	return DefaultCommit(dbOwner, dbFolder, dbName)
+}
+
 // Checks if a status update for the user exists for a given discussion or MR, and if so then removes it
 func StatusUpdateCheck(dbOwner string, dbFolder string, dbName string, thisID int, userName string) (numStatusUpdates int, err error) {
 	var lst map[string][]StatusUpdateEntry
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+// Checks the most recent release is picked for "latest", with releases made at the same time told apart by name
+func TestLatestReleaseName(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		releases map[string]ReleaseEntry
+		name     string
+		ok       bool
+	}{
+		{releases: map[string]ReleaseEntry{}, name: "", ok: false},
+		{releases: map[string]ReleaseEntry{"v1": {Date: day(1)}}, name: "v1", ok: true},
+		{releases: map[string]ReleaseEntry{
+			"v1": {Date: day(1)},
+			"v3": {Date: day(2)},
+			"v2": {Date: day(5)},
+		}, name: "v2", ok: true},
+		{releases: map[string]ReleaseEntry{
+			"a": {Date: day(3)},
+			"c": {Date: day(3)},
+			"b": {Date: day(3)},
+		}, name: "c", ok: true},
+	}
+	for _, j := range tests {
+		// Map iteration order is random, so repeat each check a few times
+		for i := 0; i < 10; i++ {
+			name, ok := LatestReleaseName(j.releases)
+			if name != j.name || ok != j.ok {
+				t.Fatalf("LatestReleaseName(%v) = (%q, %v), wanted (%q, %v)", j.releases, name, ok, j.name, j.ok)
+			}
+		}
+	}
+}
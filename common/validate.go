@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	valid "gopkg.in/go-playground/validator.v9"
 )
@@ -19,6 +20,7 @@ var (
 	regexLicenceFullName = regexp.MustCompile(`^[a-z,A-Z,0-9,\.,\-,\_,\(,\),\ ]+$`)
 	regexMarkDownSource  = regexp.MustCompile(`^[a-z,A-Z,0-9` + ",`," + `‘,’,“,”,\.,\-,\_,\/,\(,\),\[,\],\\,\!,\#,\',\",\@,\$,\*,\%,\^,\&,\+,\=,\:,\;,\<,\>,\,,\?,\~,\|,\ ,\012,\015]+$`)
 	regexPGTable         = regexp.MustCompile(`^[a-z,A-Z,0-9,\.,\-,\_,\(,\),\ ]+$`)
+	regexSQLiteTable     = regexp.MustCompile(`^[^\x00-\x1f\x7f]+$`)
 	regexUsername        = regexp.MustCompile(`^[a-z,A-Z,0-9,\.,\-,\_]+$`)
 
 	// For input validation
@@ -38,6 +40,7 @@ func init() {
 	Validate.RegisterValidation("licencefullname", checkLicenceFullName)
 	Validate.RegisterValidation("markdownsource", checkMarkDownSource)
 	Validate.RegisterValidation("pgtable", checkPGTableName)
+	Validate.RegisterValidation("sqlitetable", checkSQLiteTableName)
 	Validate.RegisterValidation("username", checkUsername)
 }
 
@@ -104,6 +107,17 @@ func checkPGTableName(fl valid.FieldLevel) bool {
 	return regexPGTable.MatchString(fl.Field().String())
 }
 
+// Custom validation function for SQLite table names.
+// SQLite accepts pretty much anything in a quoted identifier, so this just rules out invalid UTF-8, control
+// characters, and SQLite's reserved "sqlite_" prefix.
+func checkSQLiteTableName(fl valid.FieldLevel) bool {
+	s := fl.Field().String()
+	if !utf8.ValidString(s) || strings.HasPrefix(strings.ToLower(s), "sqlite_") {
+		return false
+	}
+	return regexSQLiteTable.MatchString(s)
+}
+
 // Custom validation function for Usernames.
 // At the moment it just allows alphanumeric and ".-_" chars (may need to be expanded out at some point).
 func checkUsername(fl valid.FieldLevel) bool {
@@ -240,6 +254,16 @@ func ValidatePGTable(table string) error {
 	return nil
 }
 
+// Validate the provided SQLite table name.  Callers must still quote the name when putting it into SQL.
+func ValidateSQLiteTable(table string) error {
+	err := Validate.Var(table, "required,sqlitetable,max=1024")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // Validate the provided discussion or merge request title.
 func ValidateDiscussionTitle(fieldName string) error {
 	err := Validate.Var(fieldName, "discussiontitle,max=120") // 120 seems a reasonable first guess.
@@ -304,3 +328,65 @@ func ValidateUserEmail(user string, email string) error {
 
 	return nil
 }
+
+// Validate a list of table filter conditions
+func ValidateWhereClauses(filters []WhereClause) error {
+	for _, j := range filters {
+		err := ValidateFieldName(j.Column)
+		if err != nil {
+			return err
+		}
+		if _, ok := whereClauseTypes[j.Type]; !ok {
+			return fmt.Errorf("Unknown filter type '%s'", j.Type)
+		}
+		err = Validate.Var(j.Value, "max=1024")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate a list of data validation rules
+func ValidateValidationRules(rules []ValidationRule) error {
+	names := make(map[string]struct{})
+	for _, j := range rules {
+		err := Validate.Var(j.Name, "required,discussiontitle,max=80")
+		if err != nil {
+			return fmt.Errorf("Invalid rule name '%s'", j.Name)
+		}
+		if _, ok := names[j.Name]; ok {
+			return fmt.Errorf("Duplicate rule name '%s'", j.Name)
+		}
+		names[j.Name] = struct{}{}
+
+		// Check the fields needed by each type of rule are present
+		switch j.Type {
+		case "query":
+			err = Validate.Var(j.Query, "required,max=4096")
+			if err != nil {
+				return fmt.Errorf("Rule '%s' needs a query of no more than 4096 characters", j.Name)
+			}
+		case "columns", "unique":
+			if len(j.Columns) == 0 {
+				return fmt.Errorf("Rule '%s' needs at least one column", j.Name)
+			}
+			for _, c := range j.Columns {
+				err = ValidateFieldName(c)
+				if err != nil {
+					return fmt.Errorf("Invalid column name '%s' in rule '%s'", c, j.Name)
+				}
+			}
+			fallthrough
+		case "table":
+			err = ValidateSQLiteTable(j.Table)
+			if err != nil {
+				return fmt.Errorf("Invalid table name '%s' in rule '%s'", j.Table, j.Name)
+			}
+		case "foreignkeys":
+		default:
+			return fmt.Errorf("Unknown type '%s' for rule '%s'", j.Type, j.Name)
+		}
+	}
+	return nil
+}
@@ -34,6 +34,73 @@ SET default_tablespace = '';
 
 SET default_with_oids = false;
 
+--
+-- Name: client_certificates; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE client_certificates (
+    cert_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    cert_name text NOT NULL,
+    serial_number text NOT NULL,
+    date_issued timestamp with time zone DEFAULT now() NOT NULL,
+    date_expires timestamp with time zone NOT NULL,
+    date_revoked timestamp with time zone
+);
+
+
+--
+-- Name: client_certificates_cert_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE client_certificates_cert_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: client_certificates_cert_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE client_certificates_cert_id_seq OWNED BY client_certificates.cert_id;
+
+
+--
+-- Name: database_branches; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE database_branches (
+    db_id bigint NOT NULL,
+    branch_name text NOT NULL,
+    commit_id text NOT NULL,
+    commit_count integer DEFAULT 0 NOT NULL,
+    description text DEFAULT ''::text NOT NULL
+);
+
+
+--
+-- Name: database_commits; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE database_commits (
+    db_id bigint NOT NULL,
+    commit_id text NOT NULL,
+    parent text DEFAULT ''::text NOT NULL,
+    other_parents text[] DEFAULT '{}'::text[] NOT NULL,
+    author_name text NOT NULL,
+    author_email text NOT NULL,
+    committer_name text DEFAULT ''::text NOT NULL,
+    committer_email text DEFAULT ''::text NOT NULL,
+    message text DEFAULT ''::text NOT NULL,
+    commit_timestamp timestamp with time zone NOT NULL,
+    tree jsonb NOT NULL,
+    validation_failures jsonb
+);
+
+
 --
 -- Name: database_downloads; Type: TABLE; Schema: public; Owner: -
 --
@@ -117,6 +184,24 @@ CREATE SEQUENCE database_licences_lic_id_seq
 ALTER SEQUENCE database_licences_lic_id_seq OWNED BY database_licences.lic_id;
 
 
+--
+-- Name: database_releases; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE database_releases (
+    db_id bigint NOT NULL,
+    release_name text NOT NULL,
+    commit_id text NOT NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    description text DEFAULT ''::text NOT NULL,
+    releaser_email text DEFAULT ''::text NOT NULL,
+    releaser_name text DEFAULT ''::text NOT NULL,
+    size bigint DEFAULT 0 NOT NULL,
+    manifest text,
+    signature text DEFAULT ''::text NOT NULL
+);
+
+
 --
 -- Name: database_stars; Type: TABLE; Schema: public; Owner: -
 --
@@ -128,6 +213,21 @@ CREATE TABLE database_stars (
 );
 
 
+--
+-- Name: database_tags; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE database_tags (
+    db_id bigint NOT NULL,
+    tag_name text NOT NULL,
+    commit_id text NOT NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    description text DEFAULT ''::text NOT NULL,
+    tagger_email text DEFAULT ''::text NOT NULL,
+    tagger_name text DEFAULT ''::text NOT NULL
+);
+
+
 --
 -- Name: database_uploads; Type: TABLE; Schema: public; Owner: -
 --
@@ -313,6 +413,18 @@ CREATE SEQUENCE events_event_id_seq
 ALTER SEQUENCE events_event_id_seq OWNED BY events.event_id;
 
 
+--
+-- Name: schema_migrations; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE schema_migrations (
+    version integer NOT NULL,
+    name text NOT NULL,
+    checksum text NOT NULL,
+    applied_on timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
 --
 -- Name: sqlite_databases; Type: TABLE; Schema: public; Owner: -
 --
@@ -338,16 +450,16 @@ CREATE TABLE sqlite_databases (
     forked_from bigint,
     default_table text,
     source_url text,
-    commit_list jsonb,
-    branch_heads jsonb,
-    tag_list jsonb,
     default_branch text,
     is_deleted boolean DEFAULT false NOT NULL,
     tags integer DEFAULT 0 NOT NULL,
-    release_list jsonb,
     release_count integer DEFAULT 0 NOT NULL,
     download_count bigint DEFAULT 0,
-    page_views bigint DEFAULT 0
+    page_views bigint DEFAULT 0,
+    validation_rules jsonb,
+    mirror_branch text,
+    mirror_last_checked timestamp with time zone,
+    fork_sync boolean DEFAULT false NOT NULL
 );
 
 
@@ -421,6 +533,13 @@ CREATE TABLE watchers (
 );
 
 
+--
+-- Name: client_certificates cert_id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY client_certificates ALTER COLUMN cert_id SET DEFAULT nextval('client_certificates_cert_id_seq'::regclass);
+
+
 --
 -- Name: database_downloads dl_id; Type: DEFAULT; Schema: public; Owner: -
 --
@@ -484,6 +603,30 @@ ALTER TABLE ONLY sqlite_databases ALTER COLUMN db_id SET DEFAULT nextval('sqlite
 ALTER TABLE ONLY users ALTER COLUMN user_id SET DEFAULT nextval('users_user_id_seq'::regclass);
 
 
+--
+-- Name: client_certificates client_certificates_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY client_certificates
+    ADD CONSTRAINT client_certificates_pkey PRIMARY KEY (cert_id);
+
+
+--
+-- Name: database_branches database_branches_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY database_branches
+    ADD CONSTRAINT database_branches_pkey PRIMARY KEY (db_id, branch_name);
+
+
+--
+-- Name: database_commits database_commits_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY database_commits
+    ADD CONSTRAINT database_commits_pkey PRIMARY KEY (db_id, commit_id);
+
+
 --
 -- Name: database_downloads database_downloads_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -508,6 +651,14 @@ ALTER TABLE ONLY database_licences
     ADD CONSTRAINT database_licences_pkey PRIMARY KEY (user_id, friendly_name);
 
 
+--
+-- Name: database_releases database_releases_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY database_releases
+    ADD CONSTRAINT database_releases_pkey PRIMARY KEY (db_id, release_name);
+
+
 --
 -- Name: database_stars database_stars_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -516,6 +667,14 @@ ALTER TABLE ONLY database_stars
     ADD CONSTRAINT database_stars_pkey PRIMARY KEY (db_id, user_id);
 
 
+--
+-- Name: database_tags database_tags_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY database_tags
+    ADD CONSTRAINT database_tags_pkey PRIMARY KEY (db_id, tag_name);
+
+
 --
 -- Name: database_uploads database_uploads_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -564,6 +723,14 @@ ALTER TABLE ONLY events
     ADD CONSTRAINT events_pkey PRIMARY KEY (event_id);
 
 
+--
+-- Name: schema_migrations schema_migrations_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY schema_migrations
+    ADD CONSTRAINT schema_migrations_pkey PRIMARY KEY (version);
+
+
 --
 -- Name: sqlite_databases sqlite_databases_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -612,6 +779,34 @@ ALTER TABLE ONLY watchers
     ADD CONSTRAINT watchers_pkey PRIMARY KEY (db_id, user_id);
 
 
+--
+-- Name: client_certificates_serial_number_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE UNIQUE INDEX client_certificates_serial_number_idx ON client_certificates USING btree (serial_number);
+
+
+--
+-- Name: client_certificates_user_id_cert_name_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE UNIQUE INDEX client_certificates_user_id_cert_name_idx ON client_certificates USING btree (user_id, cert_name) WHERE (date_revoked IS NULL);
+
+
+--
+-- Name: database_commits_db_id_commit_timestamp_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX database_commits_db_id_commit_timestamp_idx ON database_commits USING btree (db_id, commit_timestamp);
+
+
+--
+-- Name: database_commits_tree_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX database_commits_tree_idx ON database_commits USING gin (tree jsonb_path_ops);
+
+
 --
 -- Name: database_licences_lic_id_idx; Type: INDEX; Schema: public; Owner: -
 --
@@ -717,6 +912,30 @@ CREATE INDEX users_user_name_idx ON users USING btree (user_name);
 CREATE INDEX watchers_db_id_idx ON watchers USING btree (db_id);
 
 
+--
+-- Name: client_certificates client_certificates_user_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY client_certificates
+    ADD CONSTRAINT client_certificates_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: database_branches database_branches_db_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY database_branches
+    ADD CONSTRAINT database_branches_db_id_fkey FOREIGN KEY (db_id) REFERENCES sqlite_databases(db_id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: database_commits database_commits_db_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY database_commits
+    ADD CONSTRAINT database_commits_db_id_fkey FOREIGN KEY (db_id) REFERENCES sqlite_databases(db_id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
 --
 -- Name: database_downloads database_downloads_db_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
 --
@@ -741,6 +960,14 @@ ALTER TABLE ONLY database_licences
     ADD CONSTRAINT database_licences_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id) ON UPDATE CASCADE ON DELETE CASCADE;
 
 
+--
+-- Name: database_releases database_releases_db_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY database_releases
+    ADD CONSTRAINT database_releases_db_id_fkey FOREIGN KEY (db_id) REFERENCES sqlite_databases(db_id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
 --
 -- Name: database_stars database_stars_db_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
 --
@@ -757,6 +984,14 @@ ALTER TABLE ONLY database_stars
     ADD CONSTRAINT database_stars_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id) ON UPDATE CASCADE ON DELETE CASCADE;
 
 
+--
+-- Name: database_tags database_tags_db_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY database_tags
+    ADD CONSTRAINT database_tags_db_id_fkey FOREIGN KEY (db_id) REFERENCES sqlite_databases(db_id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
 --
 -- Name: database_uploads database_uploads_db_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
 --
@@ -853,6 +1088,20 @@ ALTER TABLE ONLY watchers
     ADD CONSTRAINT watchers_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id) ON UPDATE CASCADE ON DELETE CASCADE;
 
 
+--
+-- Data for Name: schema_migrations; Type: TABLE DATA; Schema: public; Owner: -
+--
+-- This schema already includes the changes from these migrations
+--
+
+INSERT INTO schema_migrations (version, name, checksum) VALUES
+    (1, 'validation_rules', 'b99bcbadd5acb2107e5ad4b1e937229eb1a4448ed17b9988b72b17097058d670'),
+    (2, 'source_mirroring', '4a3e14730c8d669788f55c586cda5a88e2f0141e47b1c3678236fa9fb4f369af'),
+    (3, 'client_certificates', '23c93f7f340e71bca6f7896d0861b0a4539d5fd3d199849eb4535a8c69c5dbb9'),
+    (4, 'fork_sync', 'd073c5a5c1e4e4ec634100acd2cc06bc298be9ec9ca7304ec7c179b222379081'),
+    (5, 'relational_history', 'e6a3d52e56fa5da3cc42c93d7d9790d1035256c179ccbd6e6e3bc88bbf52479d');
+
+
 --
 -- PostgreSQL database dump complete
 --
@@ -0,0 +1,6 @@
+--
+-- Adds the data validation rules which new commits to a database are checked against
+--
+
+ALTER TABLE sqlite_databases
+    ADD COLUMN validation_rules jsonb;
@@ -0,0 +1,7 @@
+--
+-- Adds the branch which databases with a source URL are re-imported into, and when the source was last checked
+--
+
+ALTER TABLE sqlite_databases
+    ADD COLUMN mirror_branch text,
+    ADD COLUMN mirror_last_checked timestamp with time zone;
@@ -0,0 +1,33 @@
+--
+-- Adds a table for the named client certificates issued to each user, so they can be listed and revoked
+--
+
+CREATE TABLE client_certificates (
+    cert_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    cert_name text NOT NULL,
+    serial_number text NOT NULL,
+    date_issued timestamp with time zone DEFAULT now() NOT NULL,
+    date_expires timestamp with time zone NOT NULL,
+    date_revoked timestamp with time zone
+);
+
+CREATE SEQUENCE client_certificates_cert_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER SEQUENCE client_certificates_cert_id_seq OWNED BY client_certificates.cert_id;
+
+ALTER TABLE ONLY client_certificates ALTER COLUMN cert_id SET DEFAULT nextval('client_certificates_cert_id_seq'::regclass);
+
+ALTER TABLE ONLY client_certificates
+    ADD CONSTRAINT client_certificates_pkey PRIMARY KEY (cert_id);
+
+CREATE UNIQUE INDEX client_certificates_serial_number_idx ON client_certificates USING btree (serial_number);
+CREATE UNIQUE INDEX client_certificates_user_id_cert_name_idx ON client_certificates USING btree (user_id, cert_name) WHERE (date_revoked IS NULL);
+
+ALTER TABLE ONLY client_certificates
+    ADD CONSTRAINT client_certificates_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id) ON UPDATE CASCADE ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+--
+-- Adds the setting for keeping a fork automatically in sync with its upstream database
+--
+
+ALTER TABLE sqlite_databases
+    ADD COLUMN fork_sync boolean DEFAULT false NOT NULL;
@@ -0,0 +1,119 @@
+--
+-- Moves the commit list, branch heads, tags, and releases of each database out of the jsonb columns on
+-- sqlite_databases, and into tables of their own
+--
+
+CREATE TABLE database_commits (
+    db_id bigint NOT NULL,
+    commit_id text NOT NULL,
+    parent text DEFAULT ''::text NOT NULL,
+    other_parents text[] DEFAULT '{}'::text[] NOT NULL,
+    author_name text NOT NULL,
+    author_email text NOT NULL,
+    committer_name text DEFAULT ''::text NOT NULL,
+    committer_email text DEFAULT ''::text NOT NULL,
+    message text DEFAULT ''::text NOT NULL,
+    commit_timestamp timestamp with time zone NOT NULL,
+    tree jsonb NOT NULL,
+    validation_failures jsonb
+);
+
+CREATE TABLE database_branches (
+    db_id bigint NOT NULL,
+    branch_name text NOT NULL,
+    commit_id text NOT NULL,
+    commit_count integer DEFAULT 0 NOT NULL,
+    description text DEFAULT ''::text NOT NULL
+);
+
+CREATE TABLE database_tags (
+    db_id bigint NOT NULL,
+    tag_name text NOT NULL,
+    commit_id text NOT NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    description text DEFAULT ''::text NOT NULL,
+    tagger_email text DEFAULT ''::text NOT NULL,
+    tagger_name text DEFAULT ''::text NOT NULL
+);
+
+CREATE TABLE database_releases (
+    db_id bigint NOT NULL,
+    release_name text NOT NULL,
+    commit_id text NOT NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    description text DEFAULT ''::text NOT NULL,
+    releaser_email text DEFAULT ''::text NOT NULL,
+    releaser_name text DEFAULT ''::text NOT NULL,
+    size bigint DEFAULT 0 NOT NULL,
+    manifest text,
+    signature text DEFAULT ''::text NOT NULL
+);
+
+-- Copy the existing jsonb data across
+INSERT INTO database_commits (db_id, commit_id, parent, other_parents, author_name, author_email, committer_name,
+    committer_email, message, commit_timestamp, tree, validation_failures)
+SELECT db.db_id, c.key, COALESCE(c.value->>'parent', ''),
+    CASE WHEN jsonb_typeof(c.value->'other_parents') = 'array'
+        THEN ARRAY(SELECT jsonb_array_elements_text(c.value->'other_parents'))
+        ELSE '{}'::text[]
+    END,
+    COALESCE(c.value->>'author_name', ''), COALESCE(c.value->>'author_email', ''),
+    COALESCE(c.value->>'committer_name', ''), COALESCE(c.value->>'committer_email', ''),
+    COALESCE(c.value->>'message', ''), (c.value->>'timestamp')::timestamp with time zone, c.value->'tree',
+    c.value->'validation_failures'
+FROM sqlite_databases AS db, jsonb_each(db.commit_list) AS c
+WHERE jsonb_typeof(db.commit_list) = 'object';
+
+INSERT INTO database_branches (db_id, branch_name, commit_id, commit_count, description)
+SELECT db.db_id, b.key, b.value->>'commit', COALESCE((b.value->>'commit_count')::integer, 0),
+    COALESCE(b.value->>'description', '')
+FROM sqlite_databases AS db, jsonb_each(db.branch_heads) AS b
+WHERE jsonb_typeof(db.branch_heads) = 'object';
+
+INSERT INTO database_tags (db_id, tag_name, commit_id, date_created, description, tagger_email, tagger_name)
+SELECT db.db_id, t.key, t.value->>'commit', (t.value->>'date')::timestamp with time zone,
+    COALESCE(t.value->>'description', ''), COALESCE(t.value->>'email', ''), COALESCE(t.value->>'name', '')
+FROM sqlite_databases AS db, jsonb_each(db.tag_list) AS t
+WHERE jsonb_typeof(db.tag_list) = 'object';
+
+INSERT INTO database_releases (db_id, release_name, commit_id, date_created, description, releaser_email,
+    releaser_name, size, manifest, signature)
+SELECT db.db_id, r.key, r.value->>'commit', (r.value->>'date')::timestamp with time zone,
+    COALESCE(r.value->>'description', ''), COALESCE(r.value->>'email', ''), COALESCE(r.value->>'name', ''),
+    COALESCE((r.value->>'size')::bigint, 0), r.value->>'manifest', COALESCE(r.value->>'signature', '')
+FROM sqlite_databases AS db, jsonb_each(db.release_list) AS r
+WHERE jsonb_typeof(db.release_list) = 'object';
+
+-- Keys, indexes, and foreign keys are added after the data is copied, as that's quicker
+ALTER TABLE ONLY database_branches
+    ADD CONSTRAINT database_branches_pkey PRIMARY KEY (db_id, branch_name);
+ALTER TABLE ONLY database_commits
+    ADD CONSTRAINT database_commits_pkey PRIMARY KEY (db_id, commit_id);
+ALTER TABLE ONLY database_releases
+    ADD CONSTRAINT database_releases_pkey PRIMARY KEY (db_id, release_name);
+ALTER TABLE ONLY database_tags
+    ADD CONSTRAINT database_tags_pkey PRIMARY KEY (db_id, tag_name);
+
+CREATE INDEX database_commits_db_id_commit_timestamp_idx ON database_commits USING btree (db_id, commit_timestamp);
+CREATE INDEX database_commits_tree_idx ON database_commits USING gin (tree jsonb_path_ops);
+
+ALTER TABLE ONLY database_branches
+    ADD CONSTRAINT database_branches_db_id_fkey FOREIGN KEY (db_id) REFERENCES sqlite_databases(db_id) ON UPDATE CASCADE ON DELETE CASCADE;
+ALTER TABLE ONLY database_commits
+    ADD CONSTRAINT database_commits_db_id_fkey FOREIGN KEY (db_id) REFERENCES sqlite_databases(db_id) ON UPDATE CASCADE ON DELETE CASCADE;
+ALTER TABLE ONLY database_releases
+    ADD CONSTRAINT database_releases_db_id_fkey FOREIGN KEY (db_id) REFERENCES sqlite_databases(db_id) ON UPDATE CASCADE ON DELETE CASCADE;
+ALTER TABLE ONLY database_tags
+    ADD CONSTRAINT database_tags_db_id_fkey FOREIGN KEY (db_id) REFERENCES sqlite_databases(db_id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+-- Bring the counts on sqlite_databases in line with the copied data, then drop the old jsonb columns
+UPDATE sqlite_databases AS db
+SET branches = (SELECT count(*) FROM database_branches AS b WHERE b.db_id = db.db_id),
+    tags = (SELECT count(*) FROM database_tags AS t WHERE t.db_id = db.db_id),
+    release_count = (SELECT count(*) FROM database_releases AS r WHERE r.db_id = db.db_id);
+
+ALTER TABLE sqlite_databases
+    DROP COLUMN commit_list,
+    DROP COLUMN branch_heads,
+    DROP COLUMN tag_list,
+    DROP COLUMN release_list;
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+)
+
+// Handlers for working with branches, tags, releases, discussions, and merge requests.  The changes themselves are
+// made by the same functions in the common package as are used by the webUI.
+
+// Creates a new branch.  To simulate:
+//
+//   $ curl -kE ~/my.cert.pem -F username=someuser -F folder=/ -F dbname=somedb.sqlite -F branch=newbranch \
+//       -F commit=<commit id> -F description="Some description" https://db4s.dbhub.io:5550/branch/create
+//
+func branchCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+
+	// Extract and validate the remaining form variables
+	branchName, err := com.GetFormBranch(r)
+	if err != nil || branchName == "" {
+		http.Error(w, "Missing or incorrect branch name", http.StatusBadRequest)
+		return
+	}
+	commitID, err := com.GetFormCommit(r)
+	if err != nil || commitID == "" {
+		http.Error(w, "Missing or incorrect commit ID", http.StatusBadRequest)
+		return
+	}
+	desc, err := formDescription(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Create the branch
+	err = com.CreateBranch(userAcc, dbOwner, dbFolder, dbName, branchName, commitID, desc)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprint(w, "Success")
+}
+
+// Deletes a branch, along with any commits only on that branch
+func branchDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil || branchName == "" {
+		http.Error(w, "Missing or incorrect branch name", http.StatusBadRequest)
+		return
+	}
+	err = com.DeleteBranch(userAcc, dbOwner, dbFolder, dbName, branchName)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	fmt.Fprint(w, "Success")
+}
+
+// Extracts the account name from the client certificate, and the database details from the request, for requests
+// which make changes.  If something isn't right, the error is sent to the client and ok is false.
+func changeRequestDetails(w http.ResponseWriter, r *http.Request) (userAcc string, dbOwner string, dbFolder string,
+	dbName string, ok bool) {
+	// Changes need to be POST requests
+	if r.Method != http.MethodPost {
+		http.Error(w, "Changes need to be made using a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The "public" user isn't allowed to make changes
+	if userAcc == "public" {
+		log.Printf("User from '%s' attempted to make changes using the public certificate", r.RemoteAddr)
+		http.Error(w, "You're using the 'public' certificate, which isn't allowed to make changes on the server",
+			http.StatusUnauthorized)
+		return
+	}
+
+	// Extract and validate the database details
+	dbOwner, dbFolder, dbName, ok = databaseDetails(w, r, userAcc)
+	return
+}
+
+// Applies the changes from a commit to the head of a branch.  The destination database is given by the usual
+// "username", "folder", and "dbname" variables along with "branch".  If the commit is from another database in the
+// fork tree, that's given by "source_owner", "source_folder", and "source_dbname".  Returns the ID of the new commit
+func commitCherryPickHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil || branchName == "" {
+		http.Error(w, "Missing or incorrect branch name", http.StatusBadRequest)
+		return
+	}
+	commitID, err := com.GetFormCommit(r)
+	if err != nil || commitID == "" {
+		http.Error(w, "Missing or incorrect commit ID", http.StatusBadRequest)
+		return
+	}
+
+	// Extract and validate the source database details, which default to the destination database
+	srcOwner, srcFolder, srcDBName := dbOwner, dbFolder, dbName
+	if r.FormValue("source_dbname") != "" {
+		srcOwner = r.FormValue("source_owner")
+		srcFolder = r.FormValue("source_folder")
+		srcDBName = r.FormValue("source_dbname")
+		if srcFolder == "" {
+			srcFolder = "/"
+		}
+		if com.ValidateUser(srcOwner) != nil || com.ValidateFolder(srcFolder) != nil ||
+			com.ValidateDB(srcDBName) != nil {
+			http.Error(w, "Missing or incorrect source database details", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Apply the commit
+	newCommit, err := com.CherryPickCommit(r, userAcc, srcOwner, srcFolder, srcDBName, commitID, dbOwner, dbFolder,
+		dbName, branchName, "db4s")
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	info := struct {
+		Commit string `json:"commit_id"`
+	}{newCommit}
+	writeJSON(w, info, "cherry pick result")
+}
+
+// Returns the commit graph of a database, with the lane and row of each commit and the edges to its parents
+func commitGraphHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dbOwner, dbFolder, dbName, ok := databaseDetails(w, r, userAcc)
+	if !ok {
+		return
+	}
+	graph, err := com.GetCommitGraph(dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, graph, "commit graph")
+}
+
+// Reverts a commit, by adding a new commit to the branch which undoes its changes.  Returns the ID of the new commit
+func commitRevertHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil || branchName == "" {
+		http.Error(w, "Missing or incorrect branch name", http.StatusBadRequest)
+		return
+	}
+	commitID, err := com.GetFormCommit(r)
+	if err != nil || commitID == "" {
+		http.Error(w, "Missing or incorrect commit ID", http.StatusBadRequest)
+		return
+	}
+	newCommit, err := com.RevertCommit(r, userAcc, dbOwner, dbFolder, dbName, branchName, commitID, "db4s")
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	info := struct {
+		Commit string `json:"commit_id"`
+	}{newCommit}
+	writeJSON(w, info, "revert result")
+}
+
+// Extracts the database details from the request, and checks the database exists and is visible to the user.  If
+// something isn't right, the error is sent to the client and ok is false.
+func databaseDetails(w http.ResponseWriter, r *http.Request, userAcc string) (dbOwner string, dbFolder string,
+	dbName string, ok bool) {
+	dbOwner, dbFolder, dbName, err := com.GetUFD(r, true)
+	if err != nil || dbOwner == "" || dbName == "" {
+		http.Error(w, "Missing or incorrect data supplied", http.StatusBadRequest)
+		return
+	}
+	if dbFolder == "" {
+		dbFolder = "/"
+	}
+
+	// Check if the requested database exists
+	exists, err := com.CheckDBExists(userAcc, dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbOwner, dbFolder, dbName),
+			http.StatusNotFound)
+		return
+	}
+	ok = true
+	return
+}
+
+// Adds a comment to a discussion or merge request.  Setting "close" to true closes (or reopens) it as well, in which
+// case the comment text is optional.
+func discussionCommentHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	discID, ok := formDiscussionID(w, r)
+	if !ok {
+		return
+	}
+	discClose := r.FormValue("close") == "true"
+	comText := r.FormValue("text")
+	if comText == "" && !discClose {
+		http.Error(w, "Comment can't be empty", http.StatusBadRequest)
+		return
+	}
+	if comText != "" {
+		err := com.Validate.Var(comText, "markdownsource")
+		if err != nil {
+			http.Error(w, "Invalid characters in the comment text", http.StatusBadRequest)
+			return
+		}
+	}
+	err := com.AddComment(userAcc, dbOwner, dbFolder, dbName, discID, comText, discClose)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprint(w, "Success")
+}
+
+// Returns the comments for a discussion or merge request
+func discussionCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dbOwner, dbFolder, dbName, ok := databaseDetails(w, r, userAcc)
+	if !ok {
+		return
+	}
+	discID, ok := formDiscussionID(w, r)
+	if !ok {
+		return
+	}
+	comList, err := com.DiscussionComments(dbOwner, dbFolder, dbName, discID, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, comList, "comment list")
+}
+
+// Creates a new discussion, returning its ID
+func discussionCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	title, text, ok := formTitleAndText(w, r)
+	if !ok {
+		return
+	}
+	id, err := com.CreateDiscussion(userAcc, dbOwner, dbFolder, dbName, title, text)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, struct {
+		ID int `json:"disc_id"`
+	}{id}, "discussion ID")
+}
+
+// Returns the discussions for a database
+func discussionListHandler(w http.ResponseWriter, r *http.Request) {
+	listDiscussions(w, r, com.DISCUSSION)
+}
+
+// Returns how a branch of a fork compares with the same branch of its upstream database
+func forkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dbOwner, dbFolder, dbName, ok := databaseDetails(w, r, userAcc)
+	if !ok {
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil || branchName == "" {
+		http.Error(w, "Missing or incorrect branch name", http.StatusBadRequest)
+		return
+	}
+	status, err := com.ForkStatus(userAcc, dbOwner, dbFolder, dbName, branchName)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	writeJSON(w, status, "fork status")
+}
+
+// Brings a branch of a fork up to date with its upstream database.  If the branch has diverged, a discussion proposing
+// the upstream changes is opened instead
+func forkSyncHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil || branchName == "" {
+		http.Error(w, "Missing or incorrect branch name", http.StatusBadRequest)
+		return
+	}
+	status, err := com.SyncFork(userAcc, dbOwner, dbFolder, dbName, branchName)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	writeJSON(w, status, "fork sync result")
+}
+
+// Returns the value of the "disc_id" form variable.  If it's missing or invalid, the error is sent to the client and
+// ok is false.
+func formDiscussionID(w http.ResponseWriter, r *http.Request) (discID int, ok bool) {
+	a := r.FormValue("disc_id")
+	if a == "" {
+		http.Error(w, "Missing discussion id", http.StatusBadRequest)
+		return
+	}
+	discID, err := strconv.Atoi(a)
+	if err != nil {
+		http.Error(w, "Error when parsing discussion id value", http.StatusBadRequest)
+		return
+	}
+	return discID, true
+}
+
+// Returns the (optional) value of the "description" form variable, after validating it
+func formDescription(r *http.Request) (string, error) {
+	desc := r.FormValue("description")
+	if desc == "" {
+		return "", nil
+	}
+	err := com.Validate.Var(desc, "markdownsource")
+	if err != nil {
+		return "", fmt.Errorf("Invalid characters in description")
+	}
+	return desc, nil
+}
+
+// Returns the values of the "title" and "text" form variables used for discussions and merge requests.  If either is
+// missing or invalid, the error is sent to the client and ok is false.
+func formTitleAndText(w http.ResponseWriter, r *http.Request) (title string, text string, ok bool) {
+	title = r.FormValue("title")
+	if title == "" {
+		http.Error(w, "Title can't be blank", http.StatusBadRequest)
+		return
+	}
+	err := com.ValidateDiscussionTitle(title)
+	if err != nil {
+		http.Error(w, "Invalid characters in the title", http.StatusBadRequest)
+		return
+	}
+	text = r.FormValue("text")
+	if text == "" {
+		http.Error(w, "Text can't be empty", http.StatusBadRequest)
+		return
+	}
+	err = com.Validate.Var(text, "markdownsource")
+	if err != nil {
+		http.Error(w, "Invalid characters in the text", http.StatusBadRequest)
+		return
+	}
+	return title, text, true
+}
+
+// Returns the discussions or merge requests for a database
+func listDiscussions(w http.ResponseWriter, r *http.Request, discType com.DiscussionType) {
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dbOwner, dbFolder, dbName, ok := databaseDetails(w, r, userAcc)
+	if !ok {
+		return
+	}
+	list, err := com.Discussions(dbOwner, dbFolder, dbName, discType, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list, "discussion list")
+}
+
+// Opens a new merge request.  The destination database is given by the usual "username", "folder", and "dbname"
+// variables along with "branch", and the source by "source_owner", "source_folder", "source_dbname", and
+// "source_branch".
+func mergeRequestCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, destOwner, destFolder, destDBName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	destBranch, err := com.GetFormBranch(r)
+	if err != nil || destBranch == "" {
+		http.Error(w, "Missing or incorrect destination branch name", http.StatusBadRequest)
+		return
+	}
+
+	// Extract and validate the source database details
+	srcOwner := r.FormValue("source_owner")
+	srcFolder := r.FormValue("source_folder")
+	srcDBName := r.FormValue("source_dbname")
+	srcBranch := r.FormValue("source_branch")
+	if srcFolder == "" {
+		srcFolder = "/"
+	}
+	if com.ValidateUser(srcOwner) != nil || com.ValidateFolder(srcFolder) != nil || com.ValidateDB(srcDBName) != nil ||
+		com.ValidateBranchName(srcBranch) != nil {
+		http.Error(w, "Missing or incorrect source database details", http.StatusBadRequest)
+		return
+	}
+	srcExists, err := com.CheckDBExists(userAcc, srcOwner, srcFolder, srcDBName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !srcExists {
+		http.Error(w, fmt.Sprintf("Database '%s%s%s' doesn't exist", srcOwner, srcFolder, srcDBName),
+			http.StatusNotFound)
+		return
+	}
+	title, text, ok := formTitleAndText(w, r)
+	if !ok {
+		return
+	}
+
+	// Create the merge request
+	id, err := com.CreateMergeRequest(userAcc, srcOwner, srcFolder, srcDBName, srcBranch, destOwner, destFolder,
+		destDBName, destBranch, title, text)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, struct {
+		ID int `json:"mr_id"`
+	}{id}, "merge request ID")
+}
+
+// Returns the merge requests for a database
+func mergeRequestListHandler(w http.ResponseWriter, r *http.Request) {
+	listDiscussions(w, r, com.MERGE_REQUEST)
+}
+
+// Merges a merge request into its destination branch
+func mergeRequestMergeHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	a := r.FormValue("mr_id")
+	mrID, err := strconv.Atoi(a)
+	if err != nil {
+		http.Error(w, "Missing or incorrect merge request id", http.StatusBadRequest)
+		return
+	}
+	err = com.MergeRequest(userAcc, dbOwner, dbFolder, dbName, mrID)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	fmt.Fprint(w, "Success")
+}
+
+// Creates a new release.  If release signing is enabled on the server, the release is signed.
+func releaseCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	relName, err := com.GetFormRelease(r)
+	if err != nil || relName == "" {
+		http.Error(w, "Missing or incorrect release name", http.StatusBadRequest)
+		return
+	}
+	commitID, err := com.GetFormCommit(r)
+	if err != nil || commitID == "" {
+		http.Error(w, "Missing or incorrect commit ID", http.StatusBadRequest)
+		return
+	}
+	desc, err := formDescription(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = com.CreateRelease(userAcc, dbOwner, dbFolder, dbName, relName, commitID, desc)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprint(w, "Success")
+}
+
+// Toggles starring of a database by the user, returning the new state and star count
+func starToggleHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	err := com.ToggleDBStar(userAcc, dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Invalidate the old memcached entry for the database
+	err = com.InvalidateCacheEntry(userAcc, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
+	if err != nil {
+		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+	}
+
+	// Return the new state
+	starred, err := com.CheckDBStarred(userAcc, dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stars, err := com.DBStars(dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Starred bool `json:"starred"`
+		Stars   int  `json:"stars"`
+	}{starred, stars}, "star status")
+}
+
+// Creates a new tag
+func tagCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	tagName, err := com.GetFormTag(r)
+	if err != nil || tagName == "" {
+		http.Error(w, "Missing or incorrect tag name", http.StatusBadRequest)
+		return
+	}
+	commitID, err := com.GetFormCommit(r)
+	if err != nil || commitID == "" {
+		http.Error(w, "Missing or incorrect commit ID", http.StatusBadRequest)
+		return
+	}
+	desc, err := formDescription(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = com.CreateTag(userAcc, dbOwner, dbFolder, dbName, tagName, commitID, desc)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprint(w, "Success")
+}
+
+// Deletes a tag
+func tagDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	tagName, err := com.GetFormTag(r)
+	if err != nil || tagName == "" {
+		http.Error(w, "Missing or incorrect tag name", http.StatusBadRequest)
+		return
+	}
+	err = com.DeleteTag(userAcc, dbOwner, dbFolder, dbName, tagName)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	fmt.Fprint(w, "Success")
+}
+
+// Toggles watching of a database by the user, returning the new state and watcher count
+func watchToggleHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	err := com.ToggleDBWatch(userAcc, dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Invalidate the old memcached entry for the database
+	err = com.InvalidateCacheEntry(userAcc, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
+	if err != nil {
+		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+	}
+
+	// Return the new state
+	watching, err := com.CheckDBWatched(userAcc, dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	watchers, err := com.DBWatchers(dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Watchers int  `json:"watchers"`
+		Watching bool `json:"watching"`
+	}{watchers, watching}, "watch status")
+}
+
+// Sends a value to the client as JSON
+func writeJSON(w http.ResponseWriter, v interface{}, desc string) {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		errMsg := fmt.Sprintf("Error when JSON marshalling the %s: %v\n", desc, err)
+		log.Print(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonData)
+}
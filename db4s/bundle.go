@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+)
+
+// Returns a bundle with the commits on a branch the client doesn't have yet, along with their database files.  The
+// "commit" variable gives the newest commit the client already has, and can be left out to get the whole history.
+// To simulate:
+//
+//   $ curl -kE ~/my.cert.pem -o bundle.zip -G https://db4s.dbhub.io:5550/bundle/pull -d "username=someuser" \
+//       -d "folder=/" -d "dbname=somedb.sqlite" -d "branch=master" -d "commit=<commit id>"
+//
+func bundlePullHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dbOwner, dbFolder, dbName, ok := databaseDetails(w, r, userAcc)
+	if !ok {
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		http.Error(w, "Incorrect branch name", http.StatusBadRequest)
+		return
+	}
+	if branchName == "" {
+		branchName, err = com.GetDefaultBranchName(dbOwner, dbFolder, dbName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	sinceCommit, err := com.GetFormCommit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Send the bundle.  Errors found before anything is written are returned to the client as usual
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.bundle.zip", dbName))
+	w.Header().Set("Content-Type", "application/zip")
+	numCommits, err := com.PullBundle(dbOwner, dbFolder, dbName, branchName, sinceCommit, w)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+
+	// Log the transfer
+	log.Printf("Bundle of %d commits from '%s%s%s' branch '%s' sent to user '%s'\n", numCommits, dbOwner,
+		dbFolder, dbName, branchName, userAcc)
+}
+
+// Adds the commits in a bundle to a branch.  The bundle is sent as the "file" field of a multipart form, and the
+// commits need to follow on from the current head of the branch.  To simulate:
+//
+//   $ curl -kE ~/my.cert.pem -F username=someuser -F folder=/ -F dbname=somedb.sqlite -F branch=master \
+//       -F file=@bundle.zip https://db4s.dbhub.io:5550/bundle/push
+//
+func bundlePushHandler(w http.ResponseWriter, r *http.Request) {
+	// Set the maximum accepted size for uploading
+	r.Body = http.MaxBytesReader(w, r.Body, com.MaxBundleSize*1024*1024)
+
+	userAcc, dbOwner, dbFolder, dbName, ok := changeRequestDetails(w, r)
+	if !ok {
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		http.Error(w, "Incorrect branch name", http.StatusBadRequest)
+		return
+	}
+	if branchName == "" {
+		branchName, err = com.GetDefaultBranchName(dbOwner, dbFolder, dbName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Grab the uploaded bundle
+	bundle, handler, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Missing or incorrect bundle: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer bundle.Close()
+
+	// Add the commits
+	head, numCommits, err := com.PushBundle(r, userAcc, dbOwner, dbFolder, dbName, branchName, bundle,
+		handler.Size)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+
+	// Return the new head of the branch
+	info := struct {
+		Commit     string `json:"commit_id"`
+		NumCommits int    `json:"commits_added"`
+	}{head, numCommits}
+	writeJSON(w, info, "push result")
+
+	// Log the transfer
+	log.Printf("Bundle of %d commits pushed to '%s%s%s' branch '%s' by user '%s'\n", numCommits, dbOwner,
+		dbFolder, dbName, branchName, userAcc)
+}
@@ -60,8 +60,8 @@ func main() {
 		log.Fatalf("Setting temp directory environment variable failed: '%s'\n", err.Error())
 	}
 
-	// Connect to Minio server
-	err = com.ConnectMinio()
+	// Connect to the storage back end
+	err = com.ConnectStorage()
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
@@ -72,6 +72,18 @@ func main() {
 		log.Fatalf(err.Error())
 	}
 
+	// Make sure the PostgreSQL schema is up to date, applying any waiting migrations if that's turned on
+	_, err = com.MigrateDatabase(com.Conf.Pg.AutoMigrate)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// Record any client certificates issued before they were tracked, so they can still be used and revoked
+	err = com.BackfillClientCerts()
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
 	// Connect to the Memcached server
 	err = com.ConnectCache()
 	if err != nil {
@@ -92,6 +104,9 @@ func main() {
 		log.Fatalf(err.Error())
 	}
 
+	// Start the worker which removes expired upload sessions in the background
+	go com.UploadSessionWorker()
+
 	// Load our self signed CA chain
 	ourCAPool = x509.NewCertPool()
 	certFile, err := ioutil.ReadFile(com.Conf.DB4S.CAChain)
@@ -108,12 +123,39 @@ func main() {
 	// URL handler
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", rootHandler)
+	mux.HandleFunc("/branch/create", branchCreateHandler)
+	mux.HandleFunc("/branch/delete", branchDeleteHandler)
 	mux.HandleFunc("/branch/list", branchListHandler)
+	mux.HandleFunc("/bundle/pull", bundlePullHandler)
+	mux.HandleFunc("/bundle/push", bundlePushHandler)
+	mux.HandleFunc("/commit/cherrypick", commitCherryPickHandler)
+	mux.HandleFunc("/commit/graph", commitGraphHandler)
+	mux.HandleFunc("/commit/revert", commitRevertHandler)
+	mux.HandleFunc("/discussion/comment", discussionCommentHandler)
+	mux.HandleFunc("/discussion/comments", discussionCommentsHandler)
+	mux.HandleFunc("/discussion/create", discussionCreateHandler)
+	mux.HandleFunc("/discussion/list", discussionListHandler)
+	mux.HandleFunc("/fork/status", forkStatusHandler)
+	mux.HandleFunc("/fork/sync", forkSyncHandler)
 	mux.HandleFunc("/licence/add", licenceAddHandler)
 	mux.HandleFunc("/licence/get", licenceGetHandler)
 	mux.HandleFunc("/licence/list", licenceListHandler)
 	mux.HandleFunc("/licence/remove", licenceRemoveHandler)
+	mux.HandleFunc("/mergerequest/create", mergeRequestCreateHandler)
+	mux.HandleFunc("/mergerequest/list", mergeRequestListHandler)
+	mux.HandleFunc("/mergerequest/merge", mergeRequestMergeHandler)
 	mux.HandleFunc("/metadata/get", metadataGetHandler)
+	mux.HandleFunc("/release/create", releaseCreateHandler)
+	mux.HandleFunc("/release/key", releaseKeyHandler)
+	mux.HandleFunc("/release/verify", releaseVerifyHandler)
+	mux.HandleFunc("/schema/get", schemaGetHandler)
+	mux.HandleFunc("/star/toggle", starToggleHandler)
+	mux.HandleFunc("/tag/create", tagCreateHandler)
+	mux.HandleFunc("/tag/delete", tagDeleteHandler)
+	mux.HandleFunc("/upload/create", uploadCreateHandler)
+	mux.HandleFunc("/upload/finish", uploadFinishHandler)
+	mux.HandleFunc("/upload/session", uploadSessionHandler)
+	mux.HandleFunc("/watch/toggle", watchToggleHandler)
 
 	// Load our self signed CA Cert chain, request client certificates, and set TLS1.2 as minimum
 	newTLSConfig := &tls.Config{
@@ -232,6 +274,16 @@ func extractUserAndServer(w http.ResponseWriter, r *http.Request) (userAcc strin
 		return
 	}
 
+	// Reject certificates which have been revoked
+	revoked, err := com.ClientCertRevoked(r.TLS.PeerCertificates[0].SerialNumber.Text(16))
+	if err != nil {
+		return
+	}
+	if revoked {
+		err = errors.New("Client certificate has been revoked")
+		return
+	}
+
 	// Everything is ok, so return
 	return
 }
@@ -370,6 +422,26 @@ func getHandler(w http.ResponseWriter, r *http.Request, userAcc string) {
 		return
 	}
 
+	// A tag or release name can be given instead of a commit ID, with the release name "latest" giving the most
+	// recent release
+	tagName, err := com.GetFormTag(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	releaseName, err := com.GetFormRelease(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if commit == "" && (releaseName != "" || tagName != "") {
+		commit, err = com.ResolveCommit(dbOwner, dbFolder, dbName, "", releaseName, "", tagName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
 	// Get the branch heads list for the database
 	branchList, err := com.GetBranches(dbOwner, dbFolder, dbName)
 	if err != nil {
@@ -797,18 +869,28 @@ func metadataGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Gather the statistics for each commit, for commits uploaded after statistics were added
+	stats := make(map[string]*com.DBStats)
+	for id, c := range commitList {
+		if len(c.Tree.Entries) > 0 && c.Tree.Entries[0].Stats != nil {
+			stats[id] = c.Tree.Entries[0].Stats
+		}
+	}
+
 	// Return the list as JSON
 	info := struct {
 		Branches  map[string]com.BranchEntry  `json:"branches"`
 		Commits   map[string]com.CommitEntry  `json:"commits"`
 		DefBranch string                      `json:"default_branch"`
 		Releases  map[string]com.ReleaseEntry `json:"releases"`
+		Stats     map[string]*com.DBStats     `json:"stats"`
 		Tags      map[string]com.TagEntry     `json:"tags"`
 	}{
 		Branches:  branchList,
 		Commits:   commitList,
 		DefBranch: defBranch,
 		Releases:  relList,
+		Stats:     stats,
 		Tags:      tagList,
 	}
 	jsonList, err := json.MarshalIndent(info, "", "  ")
@@ -897,9 +979,309 @@ func postHandler(w http.ResponseWriter, r *http.Request, userAcc string) {
 	}
 	defer tempFile.Close()
 
+	// Add the database
+	storeUpload(w, r, userAcc, targetUser, handler.Filename, tempFile)
+}
+
+// Returns the PEM encoded public key used for signing release manifests.  To simulate:
+//
+//   $ curl -kE ~/my.cert.pem https://db4s.dbhub.io:5550/release/key
+//
+func releaseKeyHandler(w http.ResponseWriter, r *http.Request) {
+	pubKey, err := com.ReleasePublicKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(pubKey)
+}
+
+// Returns the signed manifest for a release, and checks it on the client's behalf.  The manifest is a string holding
+// the exact JSON which was signed, so clients can check the signature themselves.  If the client supplies the SHA256
+// of the database it downloaded, that is checked against the manifest too.  To simulate:
+//
+//   $ curl -kE ~/my.cert.pem -G https://db4s.dbhub.io:5550/release/verify \
+//       -d "username=someuser" -d "folder=/" -d "dbname=somedb.sqlite" -d "release=v1.0" -d "sha256=..."
+//
+func releaseVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Extract and validate the form variables
+	dbOwner, dbFolder, dbName, err := com.GetUFD(r, true)
+	if err != nil {
+		http.Error(w, "Missing or incorrect data supplied", http.StatusBadRequest)
+		return
+	}
+	relName, err := com.GetFormRelease(r)
+	if err != nil || relName == "" {
+		http.Error(w, "Missing or incorrect release name", http.StatusBadRequest)
+		return
+	}
+	dbSha := r.FormValue("sha256")
+	if dbSha != "" {
+		err = com.ValidateCommitID(dbSha) // SHA256 values have the same format as commit IDs
+		if err != nil {
+			http.Error(w, "Validation failed for SHA256 value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if the requested database exists
+	exists, err := com.CheckDBExists(userAcc, dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbOwner, dbFolder, dbName),
+			http.StatusNotFound)
+		return
+	}
+
+	// Retrieve the signed manifest for the release
+	rels, err := com.GetReleases(dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rel, ok := rels[relName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Release '%s' doesn't exist", relName), http.StatusNotFound)
+		return
+	}
+	if rel.Manifest == "" {
+		http.Error(w, fmt.Sprintf("Release '%s' isn't signed", relName), http.StatusNotFound)
+		return
+	}
+	pubKey, err := com.ReleasePublicKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Check the signature, and the SHA256 if one was given
+	info := struct {
+		com.SignedReleaseManifest
+		Message  string `json:"message,omitempty"`
+		Verified bool   `json:"verified"`
+	}{
+		SignedReleaseManifest: com.SignedReleaseManifest{
+			Manifest:  rel.Manifest,
+			PublicKey: string(pubKey),
+			Signature: rel.Signature,
+		},
+		Verified: true,
+	}
+	err = com.VerifyReleaseManifest(rel.Manifest, rel.Signature, pubKey, dbSha)
+	if err != nil {
+		info.Message = err.Error()
+		info.Verified = false
+	}
+	jsonData, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		errMsg := fmt.Sprintf("Error when JSON marshalling the release manifest: %v\n", err)
+		log.Print(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonData)
+}
+
+// Returns a file requested by the client.  An example curl command to simulate the request is:
+//
+//   $ curl -OL -kE ~/my.cert.pem -D headers.out -G https://db4s.dbhub.io:5550/someuser/somedb.sqlite
+//
+func retrieveDatabase(w http.ResponseWriter, r *http.Request, pageName string, userAcc string, dbOwner string,
+	dbFolder string, dbName string, branchName string, commit string) (err error) {
+	pageName += ":retrieveDatabase()"
+
+	// Retrieve the Minio details and last modified date for the requested database
+	bucket, id, lastMod, err := com.MinioLocation(dbOwner, dbFolder, dbName, commit, userAcc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Send the database to the user
+	// Note: modification-date parameter format copied from RFC 2183 (the closest match I could find easily)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; modification-date="%s";`,
+		url.QueryEscape(dbName), lastMod.Format(time.RFC3339)))
+	w.Header().Set("Content-Type", "application/x-sqlite3")
+	w.Header().Set("Branch", branchName)
+	w.Header().Set("Commit-ID", commit)
+	bytesWritten, newDownload, err := com.ServeDatabase(w, r, bucket, id, lastMod)
+	if err != nil {
+		log.Printf("%s: Error returning DB file: %v\n", pageName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Cache revalidations and partial requests don't count as new downloads
+	if !newDownload {
+		return nil
+	}
+
+	// Was a user agent part of the request?
+	var userAgent string
+	ua, ok := r.Header["User-Agent"]
+	if ok {
+		userAgent = ua[0]
+	}
+
+	// Make a record of the download
+	err = com.LogDownload(dbOwner, dbFolder, dbName, userAcc, r.RemoteAddr, "db4s", userAgent, time.Now().UTC(),
+		bucket+id)
+	if err != nil {
+		log.Printf("%s: Error when logging download: %v\n", pageName, err)
+		return nil
+	}
+
+	// If downloaded by someone other than the owner, increment the download count for the database
+	if strings.ToLower(userAcc) != strings.ToLower(dbOwner) {
+		err = com.IncrementDownloadCount(dbOwner, dbFolder, dbName)
+		if err != nil {
+			log.Printf("%s: Error when incrementing download count: %v\n", pageName, err)
+			return nil
+		}
+	}
+
+	// Log the transfer
+	log.Printf("'%s%s%s' downloaded by user '%v', %v bytes", dbOwner, dbFolder, dbName, userAcc, bytesWritten)
+	return nil
+}
+
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Main page"
+
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The handler to use depends upon the request type
+	reqType := r.Method
+	switch reqType {
+	case "GET":
+		getHandler(w, r, userAcc)
+	case "POST":
+		postHandler(w, r, userAcc)
+	default:
+		log.Printf("%s: Unknown request method received from '%v\n", pageName, userAcc)
+		http.Error(w, fmt.Sprintf("Unknown request type: %v\n", reqType), http.StatusBadRequest)
+	}
+	return
+}
+
+// Returns the schema of a database commit as JSON.  The commit can be chosen with the "commit", "branch", "tag", or
+// "release" form fields, otherwise the head of the default branch is used.
+func schemaGetHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the account name and associated server from the validated client certificate
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Extract and validate the form variables
+	dbOwner, dbFolder, dbName, err := com.GetUFD(r, true)
+	if err != nil {
+		http.Error(w, "Missing or incorrect data supplied", http.StatusBadRequest)
+		return
+	}
+	commitID, err := com.GetFormCommit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tagName, err := com.GetFormTag(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	releaseName, err := com.GetFormRelease(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check if the requested database exists
+	exists, err := com.CheckDBExists(userAcc, dbOwner, dbFolder, dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbOwner, dbFolder, dbName),
+			http.StatusNotFound)
+		return
+	}
+
+	// Work out which commit was requested
+	commitID, err = com.ResolveCommit(dbOwner, dbFolder, dbName, commitID, releaseName, branchName, tagName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Open the database file for the commit
+	bucket, id, _, err := com.MinioLocation(dbOwner, dbFolder, dbName, commitID, userAcc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sdb, err := com.OpenMinioObject(bucket, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sdb.Close()
+
+	// Read the schema
+	schema, err := com.ReadSQLiteSchema(sdb)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the schema as JSON
+	info := struct {
+		Commit string `json:"commit"`
+		com.DBSchema
+	}{
+		Commit:   commitID,
+		DBSchema: schema,
+	}
+	jsonSchema, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		errMsg := fmt.Sprintf("Error when JSON marshalling the database schema: %v\n", err)
+		log.Print(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonSchema)
+}
+
+// Adds an uploaded database to the system, using the form fields sent with it.  This is used for both normal and
+// resumable uploads.
+func storeUpload(w http.ResponseWriter, r *http.Request, userAcc string, targetUser string, targetDB string,
+	db io.Reader) {
+	pageName := "POST request handler"
+
 	// Validate the database name
-	targetDB := handler.Filename
-	err = com.ValidateDB(targetDB)
+	err := com.ValidateDB(targetDB)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -1213,11 +1595,16 @@ func postHandler(w http.ResponseWriter, r *http.Request, userAcc string) {
 	}
 
 	// Sanity check the uploaded database, and if ok then add it to the system
-	numBytes, commitID, err := com.AddDatabase(r, userAcc, targetUser, targetFolder, targetDB, createBranch,
-		branchName, commit, public, licenceName, commitMsg, sourceURL, tempFile, "db4s", lastMod,
+	numBytes, commitID, failures, err := com.AddDatabase(r, userAcc, targetUser, targetFolder, targetDB,
+		createBranch, branchName, commit, public, licenceName, commitMsg, sourceURL, db, "db4s", lastMod,
 		commitTime, authorName, authorEmail, committerName, committerEmail, otherParents, dbSHA256)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if failures != nil {
+			// The upload was rejected by the data validation rules for the database
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, err.Error(), com.ErrorStatus(err))
 		return
 	}
 
@@ -1227,7 +1614,11 @@ func postHandler(w http.ResponseWriter, r *http.Request, userAcc string) {
 	// Construct message data for returning to sender
 	u := server + filepath.Join("/", targetUser, targetFolder, targetDB)
 	u += fmt.Sprintf(`?branch=%s&commit=%s`, branchName, commitID)
-	m := map[string]string{"commit_id": commitID, "url": u}
+	m := map[string]interface{}{"commit_id": commitID, "url": u}
+	if len(failures) > 0 {
+		// Let the client know about any data validation rules which flagged the commit
+		m["validation_failures"] = failures
+	}
 
 	// Convert to JSON
 	var msg bytes.Buffer
@@ -1244,111 +1635,6 @@ func postHandler(w http.ResponseWriter, r *http.Request, userAcc string) {
 	fmt.Fprintf(w, msg.String())
 }
 
-// Returns a file requested by the client.  An example curl command to simulate the request is:
-//
-//   $ curl -OL -kE ~/my.cert.pem -D headers.out -G https://db4s.dbhub.io:5550/someuser/somedb.sqlite
-//
-func retrieveDatabase(w http.ResponseWriter, r *http.Request, pageName string, userAcc string, dbOwner string,
-	dbFolder string, dbName string, branchName string, commit string) (err error) {
-	pageName += ":retrieveDatabase()"
-
-	// Retrieve the Minio details and last modified date for the requested database
-	bucket, id, lastMod, err := com.MinioLocation(dbOwner, dbFolder, dbName, commit, userAcc)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Get a handle from Minio for the database object
-	userDB, err := com.MinioHandle(bucket, id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Close the object handle when this function finishes
-	defer func() {
-		err := com.MinioHandleClose(userDB)
-		if err != nil {
-			log.Printf("%s: Error closing object handle: %v\n", pageName, err)
-		}
-	}()
-
-	// Get the file details
-	stat, err := userDB.Stat()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Was a user agent part of the request?
-	var userAgent string
-	ua, ok := r.Header["User-Agent"]
-	if ok {
-		userAgent = ua[0]
-	}
-
-	// Make a record of the download
-	err = com.LogDownload(dbOwner, dbFolder, dbName, userAcc, r.RemoteAddr, "db4s", userAgent, time.Now().UTC(),
-		bucket+id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Send the database to the user
-	// Note: modification-date parameter format copied from RFC 2183 (the closest match I could find easily)
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; modification-date="%s";`,
-		url.QueryEscape(dbName), lastMod.Format(time.RFC3339)))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size))
-	w.Header().Set("Content-Type", "application/x-sqlite3")
-	w.Header().Set("Branch", branchName)
-	w.Header().Set("Commit-ID", commit)
-	bytesWritten, err := io.Copy(w, userDB)
-	if err != nil {
-		log.Printf("%s: Error returning DB file: %v\n", pageName, err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// If downloaded by someone other than the owner, increment the download count for the database
-	if strings.ToLower(userAcc) != strings.ToLower(dbOwner) {
-		err = com.IncrementDownloadCount(dbOwner, dbFolder, dbName)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	}
-
-	// Log the transfer
-	log.Printf("'%s%s%s' downloaded by user '%v', %v bytes", dbOwner, dbFolder, dbName, userAcc, bytesWritten)
-	return nil
-}
-
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	pageName := "Main page"
-
-	// Extract the account name and associated server from the validated client certificate
-	userAcc, _, err := extractUserAndServer(w, r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// The handler to use depends upon the request type
-	reqType := r.Method
-	switch reqType {
-	case "GET":
-		getHandler(w, r, userAcc)
-	case "POST":
-		postHandler(w, r, userAcc)
-	default:
-		log.Printf("%s: Unknown request method received from '%v\n", pageName, userAcc)
-		http.Error(w, fmt.Sprintf("Unknown request type: %v\n", reqType), http.StatusBadRequest)
-	}
-	return
-}
-
 // Returns the list of databases available to the user.  To simulate, the following curl command can be used:
 //
 //   $ curl -kE ~/my.cert.pem -D headers.out -G https://db4s.dbhub.io:5550/someuser
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+)
+
+// Handlers for resumable uploads.  An upload is started with /upload/create, the chunks are sent in order with PATCH
+// requests to /upload/session (a HEAD request there returns the offset to resume from), then the database is added
+// with /upload/finish.  To simulate:
+//
+//   $ curl -kE ~/my.cert.pem -F dbname=somedb.sqlite -F size=123456789 -F dbshasum=<sha256> -F branch=master \
+//       -F commit=<commit id> -F commitmsg=stuff https://db4s.dbhub.io:5550/upload/create
+//   $ curl -kE ~/my.cert.pem -X PATCH -H "Upload-Offset: 0" -H "Content-Type: application/offset+octet-stream" \
+//       --data-binary @chunk1 "https://db4s.dbhub.io:5550/upload/session?id=<upload id>"
+//   $ curl -kE ~/my.cert.pem -F id=<upload id> https://db4s.dbhub.io:5550/upload/finish
+//
+// The form fields given to /upload/create are the same ones used for a normal upload.
+
+// Starts a resumable upload
+func uploadCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, ok := uploadUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Uploads need to be started using a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil && err != http.ErrNotMultipart {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the target user and database name
+	targetUser := r.FormValue("username")
+	if targetUser == "" {
+		targetUser = userAcc
+		r.Form.Set("username", userAcc)
+	}
+	if strings.ToLower(targetUser) != strings.ToLower(userAcc) {
+		http.Error(w, fmt.Sprintf("You don't have write permission for '%s'", targetUser), http.StatusForbidden)
+		return
+	}
+	dbName := r.FormValue("dbname")
+	err = com.ValidateDB(dbName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.ParseInt(r.FormValue("size"), 10, 64)
+	if err != nil {
+		http.Error(w, "Missing or invalid database size", http.StatusBadRequest)
+		return
+	}
+
+	// Create the session
+	sess, err := com.CreateUploadSession(userAcc, dbName, size, r.FormValue("dbshasum"), r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		return
+	}
+	w.Header().Set("Location", "/upload/session?id="+sess.ID)
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, struct {
+		ID     string `json:"upload_id"`
+		Offset int64  `json:"offset"`
+		Size   int64  `json:"size"`
+	}{sess.ID, 0, sess.Size}, "upload session")
+}
+
+// Adds the database from a completed upload session
+func uploadFinishHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, ok := uploadUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Uploads need to be finished using a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.FormValue("id")
+	sess, db, err := com.FinishUploadSession(userAcc, id)
+	if err != nil {
+		http.Error(w, err.Error(), com.ErrorStatus(err))
+		com.EndUploadSession(userAcc, id, com.ErrorStatus(err))
+		return
+	}
+
+	// Add the database, using the form fields given when the upload was started.  The session is only removed
+	// afterwards if the upload was stored, or failed in a way which retrying won't fix
+	r.Form = sess.Fields
+	r.Form.Set("dbshasum", sess.Sha256)
+	cw := com.NewCountingWriter(w)
+	storeUpload(cw, r, userAcc, r.Form.Get("username"), sess.DBName, db)
+	db.Close()
+	com.EndUploadSession(userAcc, id, cw.Status())
+}
+
+// Returns the progress of an upload session (HEAD), adds a chunk to it (PATCH), or cancels it (DELETE).  The
+// "Upload-Offset" header gives the number of bytes received so far.
+func uploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userAcc, ok := uploadUser(w, r)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case http.MethodHead:
+		sess, offset, err := com.UploadSessionDetails(userAcc, id)
+		if err != nil {
+			w.WriteHeader(com.ErrorStatus(err))
+			return
+		}
+		w.Header().Set("Upload-Length", strconv.FormatInt(sess.Size, 10))
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil {
+			http.Error(w, "Missing or invalid Upload-Offset header", http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, com.MaxDatabaseSize*1024*1024)
+		newOffset, err := com.WriteUploadChunk(userAcc, id, offset, r.Body)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+		if err != nil {
+			http.Error(w, err.Error(), com.ErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		err := com.RemoveUploadSession(userAcc, id)
+		if err != nil {
+			http.Error(w, err.Error(), com.ErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Unsupported request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// Extracts the account name from the client certificate for upload requests.  If something isn't right, the error is
+// sent to the client and ok is false.
+func uploadUser(w http.ResponseWriter, r *http.Request) (userAcc string, ok bool) {
+	userAcc, _, err := extractUserAndServer(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The "public" user isn't allowed to make changes
+	if userAcc == "public" {
+		log.Printf("User from '%s' attempted to upload a database using the public certificate", r.RemoteAddr)
+		http.Error(w, "You're using the 'public' certificate, which isn't allowed to make changes on the server",
+			http.StatusUnauthorized)
+		return
+	}
+	return userAcc, true
+}
@@ -0,0 +1,37 @@
+package main
+
+// Applies any waiting PostgreSQL schema migrations, for when auto_migrate is turned off in the config file.  Run it
+// with the "-check" option to only report whether migrations are waiting.
+
+import (
+	"flag"
+	"log"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+)
+
+func main() {
+	check := flag.Bool("check", false, "Only check for waiting migrations, without applying them")
+	flag.Parse()
+
+	// Read server configuration
+	var err error
+	if err = com.ReadConfig(); err != nil {
+		log.Fatalf("Configuration file problem\n\n%v", err)
+	}
+
+	// Connect to PostgreSQL server
+	err = com.ConnectPostgreSQL()
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// Check the schema, applying the waiting migrations unless only a check was asked for
+	applied, err := com.MigrateDatabase(!*check)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	if len(applied) == 0 {
+		log.Printf("The PostgreSQL schema is up to date\n")
+	}
+}
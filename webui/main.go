@@ -314,7 +314,11 @@ func branchNamesHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, string(data))
 }
 
-func createBranchHandler(w http.ResponseWriter, r *http.Request) {
+// Applies the changes from a commit to the head of a branch.  The commit can be from the same database, or another
+// one in its fork tree.
+func cherryPickHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Cherry pick handler"
+
 	// Retrieve session data (if any)
 	var loggedInUser string
 	var u interface{}
@@ -322,7 +326,7 @@ func createBranchHandler(w http.ResponseWriter, r *http.Request) {
 	if com.Conf.Environment.Environment != "docker" {
 		sess, err := store.Get(r, "dbhub-user")
 		if err != nil {
-			errorPage(w, r, http.StatusBadRequest, err.Error())
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 		u = sess.Values["UserName"]
@@ -336,107 +340,204 @@ func createBranchHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Ensure we have a valid logged in user
 	if validSession != true {
-		errorPage(w, r, http.StatusUnauthorized, "You need to be logged in")
+		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	// Extract and validate the form variables
-	dbOwner, dbName, commit, err := com.GetFormUDC(r)
+	// Extract the required form variables
+	usr, dbFolder, dbName, err := com.GetUFD(r, false)
 	if err != nil {
-		errorPage(w, r, http.StatusBadRequest, "Missing or incorrect data supplied")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dbOwner := strings.ToLower(usr)
+	commit, err := com.GetFormCommit(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	branchName, err := com.GetFormBranch(r)
 	if err != nil {
-		errorPage(w, r, http.StatusBadRequest, "Missing or incorrect branch name")
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	bd := r.PostFormValue("branchdesc") // Optional
 
-	// If given, validate the branch description field
-	var branchDesc string
-	if bd != "" {
-		err = com.Validate.Var(bd, "markdownsource")
+	// If any of the required values were empty, indicate failure
+	if branchName == "" || dbFolder == "" || dbName == "" || dbOwner == "" || commit == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the source database details.  If they're not given, the commit is from the destination database
+	srcOwner, srcFolder, srcDBName := dbOwner, dbFolder, dbName
+	if r.PostFormValue("sourcedbname") != "" {
+		srcOwner = r.PostFormValue("sourceowner")
+		srcFolder = r.PostFormValue("sourcefolder")
+		srcDBName = r.PostFormValue("sourcedbname")
+		err = com.ValidateUserDB(srcOwner, srcDBName)
+		if err == nil {
+			err = com.ValidateFolder(srcFolder)
+		}
 		if err != nil {
-			errorPage(w, r, http.StatusBadRequest, "Invalid characters in branch description")
+			log.Printf("%s: Validation failed for source database details: %s", pageName, err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
 			return
 		}
-		branchDesc = bd
 	}
 
-	// Check if the requested database exists
-	dbFolder := "/"
+	// Make sure the database exists in the system
 	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
 	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	if !exists {
-		errorPage(w, r, http.StatusNotFound, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbOwner, dbFolder,
-			dbName))
+		log.Printf("%s: Validation failed for database name: %s", pageName, err)
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	// Make sure the database owner matches the logged in user
-	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
-		errorPage(w, r, http.StatusUnauthorized, "You can't change databases you don't own")
+	// Apply the commit
+	newCommit, err := com.CherryPickCommit(r, loggedInUser, srcOwner, srcFolder, srcDBName, commit, dbOwner,
+		dbFolder, dbName, branchName, "webui")
+	if err != nil {
+		log.Printf("%s: Cherry picking commit '%s' failed: %v\n", pageName, commit, err)
+		w.WriteHeader(com.ErrorStatus(err))
+		w.Write([]byte(err.Error()))
 		return
 	}
 
-	// Read the branch heads list from the database
-	branches, err := com.GetBranches(dbOwner, dbFolder, dbName)
+	// Return the ID of the new commit
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(newCommit))
+}
+
+// Returns the commit graph of a database as JSON, for drawing on the history page
+func commitGraphHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve user and database name
+	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/commitgraph/" at the start of the URL
 	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	dbFolder := "/"
 
-	// Make sure the branch name doesn't already exist
-	_, ok := branches[branchName]
-	if ok {
-		errorPage(w, r, http.StatusConflict, "A branch of that name already exists!")
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+	}
+
+	// Make sure the database exists in the system, and the user has access to it
+	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	// Count the number of commits in the new branch
-	commitList, err := com.GetCommitList(dbOwner, dbFolder, dbName)
+	// Lay out the commit graph
+	graph, err := com.GetCommitGraph(dbOwner, dbFolder, dbName)
 	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
 		return
 	}
-	c, ok := commitList[commit]
-	if !ok {
-		errorPage(w, r, http.StatusBadRequest, fmt.Sprint("The given commit ID doesn't exist"))
+
+	// Return the commit graph
+	y, err := json.MarshalIndent(graph, "", " ")
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
 		return
 	}
-	commitCount := 1
-	for c.Parent != "" {
-		commitCount++
-		c, ok = commitList[c.Parent]
-		if !ok {
-			log.Printf("Error when counting commits in new branch '%s' of database '%s%s%s'\n", branchName,
-				dbOwner, dbFolder, dbName)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(y))
+}
+
+func createBranchHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	validSession := false
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+		validSession = true
 	}
 
-	// Create the branch
-	newBranch := com.BranchEntry{
-		Commit:      commit,
-		CommitCount: commitCount,
-		Description: branchDesc,
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		errorPage(w, r, http.StatusUnauthorized, "You need to be logged in")
+		return
+	}
+
+	// Extract and validate the form variables
+	dbOwner, dbName, commit, err := com.GetFormUDC(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Missing or incorrect data supplied")
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Missing or incorrect branch name")
+		return
+	}
+	bd := r.PostFormValue("branchdesc") // Optional
+
+	// If given, validate the branch description field
+	var branchDesc string
+	if bd != "" {
+		err = com.Validate.Var(bd, "markdownsource")
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, "Invalid characters in branch description")
+			return
+		}
+		branchDesc = bd
 	}
-	branches[branchName] = newBranch
-	err = com.StoreBranches(dbOwner, dbFolder, dbName, branches)
+
+	// Check if the requested database exists
+	dbFolder := "/"
+	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if !exists {
+		errorPage(w, r, http.StatusNotFound, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbOwner, dbFolder,
+			dbName))
+		return
+	}
 
-	// Invalidate the memcache data for the database, so the new branch count gets picked up
-	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
+	// Create the branch
+	err = com.CreateBranch(loggedInUser, dbOwner, dbFolder, dbName, branchName, commit, branchDesc)
 	if err != nil {
-		// Something went wrong when invalidating memcached entries for the database
-		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+		errorPage(w, r, com.ErrorStatus(err), err.Error())
 		return
 	}
 
@@ -543,25 +644,13 @@ func createCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add the comment to PostgreSQL
-	err = com.StoreComment(dbOwner, dbFolder, dbName, loggedInUser, discID, comText, discClose,
-		com.CLOSED_WITHOUT_MERGE) // com.CLOSED_WITHOUT_MERGE is ignored for discussions.  It's only used for MRs
+	err = com.AddComment(loggedInUser, dbOwner, dbFolder, dbName, discID, comText, discClose)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(com.ErrorStatus(err))
 		fmt.Fprint(w, err.Error())
 		return
 	}
 
-	// Invalidate the memcache data for the database, so if the discussion counter for the database was changed it
-	// gets picked up
-	if discClose {
-		err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
-		if err != nil {
-			// Something went wrong when invalidating memcached entries for the database
-			log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
-			return
-		}
-	}
-
 	// Send a success message
 	w.WriteHeader(http.StatusOK)
 }
@@ -636,35 +725,9 @@ func createDiscussHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add the discussion detail to PostgreSQL
-	id, err := com.StoreDiscussion(dbOwner, dbFolder, dbName, loggedInUser, discTitle, discText, com.DISCUSSION,
-		com.MergeRequestEntry{})
-	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	// Generate an event about the new discussion
-	details := com.EventDetails{
-		DBName:   dbName,
-		DiscID:   id,
-		Folder:   dbFolder,
-		Owner:    dbOwner,
-		Title:    discTitle,
-		Type:     com.EVENT_NEW_DISCUSSION,
-		URL:      fmt.Sprintf("/discuss/%s%s%s?id=%d", dbOwner, dbFolder, dbName, id),
-		UserName: loggedInUser,
-	}
-	err = com.NewEvent(details)
+	id, err := com.CreateDiscussion(loggedInUser, dbOwner, dbFolder, dbName, discTitle, discText)
 	if err != nil {
-		log.Printf("Error when creating a new event: %s\n", err.Error())
-		return
-	}
-
-	// Invalidate the memcache data for the database, so the new discussion count gets picked up
-	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
-	if err != nil {
-		// Something went wrong when invalidating memcached entries for the database
-		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+		errorPage(w, r, com.ErrorStatus(err), err.Error())
 		return
 	}
 
@@ -908,68 +971,18 @@ func createMergeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the details of the commits for the MR
-	mrDetails := com.MergeRequestEntry{
-		DestBranch:   destBranch,
-		SourceBranch: srcBranch,
-		SourceDBName: srcDBName,
-		SourceFolder: srcFolder,
-		SourceOwner:  srcOwner,
-	}
-	var ancestorID string
-	ancestorID, mrDetails.Commits, err, _ = com.GetCommonAncestorCommits(srcOwner, srcFolder, srcDBName, srcBranch,
-		destOwner, destFolder, destDBName, destBranch)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
-		return
-	}
-
-	// Make sure the source branch will cleanly apply to the destination.  eg the destination branch hasn't received
-	// additional commits since the source was forked
-	if ancestorID == "" {
-		w.WriteHeader(http.StatusConflict)
-		fmt.Fprint(w, "Source branch is not a direct descendent of the destination branch.  Cannot merge.")
-		return
-	}
-
-	// Create the merge request in PostgreSQL
+	// Create the merge request
 	var x struct {
 		ID int `json:"mr_id"`
 	}
-	x.ID, err = com.StoreDiscussion(destOwner, destFolder, destDBName, loggedInUser, title, descrip, com.MERGE_REQUEST,
-		mrDetails)
+	x.ID, err = com.CreateMergeRequest(loggedInUser, srcOwner, srcFolder, srcDBName, srcBranch, destOwner,
+		destFolder, destDBName, destBranch, title, descrip)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(com.ErrorStatus(err))
 		fmt.Fprint(w, err.Error())
 		return
 	}
 
-	// Generate an event about the new merge request
-	details := com.EventDetails{
-		DBName:   destDBName,
-		DiscID:   x.ID,
-		Folder:   destFolder,
-		Owner:    destOwner,
-		Title:    title,
-		Type:     com.EVENT_NEW_MERGE_REQUEST,
-		URL:      fmt.Sprintf("/merge/%s%s%s?id=%d", destOwner, destFolder, destDBName, x.ID),
-		UserName: loggedInUser,
-	}
-	err = com.NewEvent(details)
-	if err != nil {
-		log.Printf("Error when creating a new event: %s\n", err.Error())
-		return
-	}
-
-	// Invalidate the memcache data for the destination database, so the new MR count gets picked up
-	err = com.InvalidateCacheEntry(loggedInUser, destOwner, destFolder, destDBName, "") // Empty string indicates "for all versions"
-	if err != nil {
-		// Something went wrong when invalidating memcached entries for the database
-		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
-		return
-	}
-
 	// Indicate success to the caller, and return the ID # of the new merge request
 	y, err := json.MarshalIndent(x, "", " ")
 	if err != nil {
@@ -1052,67 +1065,11 @@ func createTagHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make sure the database owner matches the logged in user
-	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
-		errorPage(w, r, http.StatusUnauthorized, "You can't change databases you don't own")
-		return
-	}
-
-	// Retrieve the user details
-	usr, err := com.User(loggedInUser)
-	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, "An error occurred when retrieving user details")
-	}
-
 	// Create a new tag or release as appropriate
 	if tagType == "release" {
-		// * It's a release *
-
-		// Read the releases list from the database
-		rels, err := com.GetReleases(dbOwner, dbFolder, dbName)
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		// Ensure the release doesn't already exist
-		if _, ok := rels[tagName]; ok {
-			errorPage(w, r, http.StatusConflict, "A release of that name already exists!")
-			return
-		}
-
-		// Retrieve the size of the database for this release
-		var tmp com.SQLiteDBinfo
-		err = com.DBDetails(&tmp, loggedInUser, dbOwner, dbFolder, dbName, commit)
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
-		}
-		size := tmp.Info.DBEntry.Size
-
-		// Create the release
-		newRel := com.ReleaseEntry{
-			Commit:        commit,
-			Date:          time.Now(),
-			Description:   tagDesc,
-			ReleaserEmail: usr.Email,
-			ReleaserName:  usr.DisplayName,
-			Size:          size,
-		}
-		rels[tagName] = newRel
-
-		// Store it in PostgreSQL
-		err = com.StoreReleases(dbOwner, dbFolder, dbName, rels)
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		// Invalidate the memcache data for the database
-		err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
+		err = com.CreateRelease(loggedInUser, dbOwner, dbFolder, dbName, tagName, commit, tagDesc)
 		if err != nil {
-			// Something went wrong when invalidating memcached entries for the database
-			log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+			errorPage(w, r, com.ErrorStatus(err), err.Error())
 			return
 		}
 
@@ -1120,44 +1077,9 @@ func createTagHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, fmt.Sprintf("/releases/%s%s%s", loggedInUser, dbFolder, dbName), http.StatusSeeOther)
 		return
 	}
-
-	// * It's a tag *
-
-	// Read the tags list from the database
-	tags, err := com.GetTags(dbOwner, dbFolder, dbName)
-	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	// Make sure the tag doesn't already exist
-	if _, ok := tags[tagName]; ok {
-		errorPage(w, r, http.StatusConflict, "A tag of that name already exists!")
-		return
-	}
-
-	// Create the tag
-	newTag := com.TagEntry{
-		Commit:      commit,
-		Date:        time.Now(),
-		Description: tagDesc,
-		TaggerEmail: usr.Email,
-		TaggerName:  usr.DisplayName,
-	}
-	tags[tagName] = newTag
-
-	// Store it in PostgreSQL
-	err = com.StoreTags(dbOwner, dbFolder, dbName, tags)
-	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	// Invalidate the memcache data for the database, so the new tag count gets picked up
-	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
+	err = com.CreateTag(loggedInUser, dbOwner, dbFolder, dbName, tagName, commit, tagDesc)
 	if err != nil {
-		// Something went wrong when invalidating memcached entries for the database
-		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+		errorPage(w, r, com.ErrorStatus(err), err.Error())
 		return
 	}
 
@@ -1358,12 +1280,24 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/"+userName, http.StatusSeeOther)
 }
 
-// This is called from the username selection page, to check if a name is available.
-func checkNameHandler(w http.ResponseWriter, r *http.Request) {
-	// Retrieve the potential username from the URL
-	userName := r.FormValue("name")
-
-	// Validate the user supplied username
+// Returns the certificate revocation list for revoked DB4S client certificates.
+func crlHandler(w http.ResponseWriter, r *http.Request) {
+	crl, err := com.GenerateCRL()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="dbhub-client-certs.crl.pem"`)
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(crl)
+}
+
+// This is called from the username selection page, to check if a name is available.
+func checkNameHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve the potential username from the URL
+	userName := r.FormValue("name")
+
+	// Validate the user supplied username
 	err := com.ValidateUser(userName)
 	if err != nil {
 		fmt.Fprint(w, "n")
@@ -1455,345 +1389,11 @@ func deleteBranchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make sure the database is owned by the logged in user. eg prevent changes to other people's databases
-	if strings.ToLower(dbOwner) != strings.ToLower(loggedInUser) {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	// Load the existing branchHeads for the database
-	branchList, err := com.GetBranches(loggedInUser, dbFolder, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Make sure the given branch exists
-	branch, ok := branchList[branchName]
-	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	// Make sure the branch being deleted isn't the default one
-	defBranch, err := com.GetDefaultBranchName(dbOwner, dbFolder, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if defBranch == branchName {
-		w.WriteHeader(http.StatusConflict)
-		return
-	}
-
-	// Make sure that deleting this branch wouldn't result in any isolated tags or releases.  For example, when there
-	// is a tag or release on a commit which is only in this branch, deleting the branch would leave the tag or
-	// release in place with no way to reach it
-
-	// Get the commit list for the database
-	commitList, err := com.GetCommitList(dbOwner, dbFolder, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Get the tag list for the database
-	tags, err := com.GetTags(dbOwner, dbFolder, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Get the release list for the database
-	rels, err := com.GetReleases(dbOwner, dbFolder, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// If the database has tags, walk the commit history for the branch checking if any of the tags are on commits in
-	// this branch
-	branchTags := make(map[string]string)
-	if len(tags) > 0 {
-		// Walk the commit history for the branch checking if any of the tags are on commits in this branch
-		c, ok := commitList[branch.Commit]
-		if !ok {
-			log.Printf("Error when checking for isolated tags while deleting branch '%s' of database "+
-				"'%s%s%s'\n", branchName, dbOwner, dbFolder, dbName)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		for tName, tEntry := range tags {
-			// Scan through the tags, checking if any of them are for this commit
-			if tEntry.Commit == c.ID {
-				// It's a match, so add this tag to the list of tags on this branch
-				branchTags[tName] = c.ID
-			}
-		}
-		for c.Parent != "" {
-			c, ok = commitList[c.Parent]
-			if !ok {
-				log.Printf("Error when checking for isolated tags while deleting branch '%s' of database "+
-					"'%s%s%s'\n", branchName, dbOwner, dbFolder, dbName)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			for tName, tEntry := range tags {
-				// Scan through the tags, checking if any of them are for this commit
-				if tEntry.Commit == c.ID {
-					// It's a match, so add this tag to the list of tags on this branch
-					branchTags[tName] = c.ID
-				}
-			}
-		}
-
-		// For any tags on commits in this branch, check if they're also on other branches
-		if len(branchTags) > 0 {
-			for bName, bEntry := range branchList {
-				if bName == branchName {
-					// We're only checking "other branches"
-					continue
-				}
-
-				// If there are no tags left to check, we might as well stop further looping
-				if len(branchTags) == 0 {
-					break
-				}
-
-				c := commitList[bEntry.Commit]
-				for tName, tCommit := range branchTags {
-					if c.ID == tCommit {
-						// This commit matches a tag, so remove the tag from the list
-						delete(branchTags, tName)
-					}
-				}
-				for c.Parent != "" {
-					c, ok = commitList[c.Parent]
-					if !ok {
-						log.Printf("Error when checking for isolated tags while deleting branch '%s' of "+
-							"database '%s%s%s'\n", branchName, dbOwner, dbFolder, dbName)
-						w.WriteHeader(http.StatusInternalServerError)
-						return
-					}
-					for tName, tCommit := range branchTags {
-						if c.ID == tCommit {
-							// This commit matches a tag, so remove the tag from the list
-							delete(branchTags, tName)
-						}
-					}
-				}
-			}
-		}
-
-		// If there are any tags left over which aren't on other branches, abort this branch deletion and tell the user
-		if len(branchTags) > 0 {
-			var conflictedTags string
-			for tName := range branchTags {
-				if conflictedTags == "" {
-					conflictedTags = tName
-				} else {
-					conflictedTags += ", " + tName
-				}
-			}
-
-			w.WriteHeader(http.StatusConflict)
-			if len(branchTags) > 1 {
-				w.Write([]byte(fmt.Sprintf("You need to delete the tags '%s' before you can delete this branch",
-					conflictedTags)))
-			} else {
-				w.Write([]byte(fmt.Sprintf("You need to delete the tag '%s' before you can delete this branch",
-					conflictedTags)))
-			}
-			return
-		}
-	}
-
-	// If the database has releases, walk the commit history for the branch checking if any of the releases are on
-	// commits in this branch
-	branchRels := make(map[string]string)
-	if len(rels) > 0 {
-		// Walk the commit history for the branch checking if any of the releases are on commits in this branch
-		c, ok := commitList[branch.Commit]
-		if !ok {
-			log.Printf("Error when checking for isolated releases while deleting branch '%s' of database "+
-				"'%s%s%s'\n", branchName, dbOwner, dbFolder, dbName)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		for rName, rEntry := range rels {
-			// Scan through the releases, checking if any of them are for this commit
-			if rEntry.Commit == c.ID {
-				// It's a match, so add this release to the list of releases on this branch
-				branchRels[rName] = c.ID
-			}
-		}
-		for c.Parent != "" {
-			c, ok = commitList[c.Parent]
-			if !ok {
-				log.Printf("Error when checking for isolated releases while deleting branch '%s' of database "+
-					"'%s%s%s'\n", branchName, dbOwner, dbFolder, dbName)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			for rName, rEntry := range rels {
-				// Scan through the releases, checking if any of them are for this commit
-				if rEntry.Commit == c.ID {
-					// It's a match, so add this release to the list of releases on this branch
-					branchRels[rName] = c.ID
-				}
-			}
-		}
-
-		// For any releases on commits in this branch, check if they're also on other branches
-		if len(branchRels) > 0 {
-			for bName, bEntry := range branchList {
-				if bName == branchName {
-					// We're only checking "other branches"
-					continue
-				}
-
-				// If there are no releases left to check, we might as well stop further looping
-				if len(branchRels) == 0 {
-					break
-				}
-
-				c := commitList[bEntry.Commit]
-				for rName, rCommit := range branchRels {
-					if c.ID == rCommit {
-						// This commit matches a release, so remove the release from the list
-						delete(branchRels, rName)
-					}
-				}
-				for c.Parent != "" {
-					c, ok = commitList[c.Parent]
-					if !ok {
-						log.Printf("Error when checking for isolated releases while deleting branch '%s' of "+
-							"database '%s%s%s'\n", branchName, dbOwner, dbFolder, dbName)
-						w.WriteHeader(http.StatusInternalServerError)
-						return
-					}
-					for rName, rCommit := range branchRels {
-						if c.ID == rCommit {
-							// This commit matches a release, so remove the release from the list
-							delete(branchRels, rName)
-						}
-					}
-				}
-			}
-		}
-
-		// If there are any releases left over which aren't on other branches, abort this branch deletion and tell the user
-		if len(branchRels) > 0 {
-			var conflictedRels string
-			for rName := range branchRels {
-				if conflictedRels == "" {
-					conflictedRels = rName
-				} else {
-					conflictedRels += ", " + rName
-				}
-			}
-
-			w.WriteHeader(http.StatusConflict)
-			if len(branchRels) > 1 {
-				w.Write([]byte(fmt.Sprintf("You need to delete the releases '%s' before you can delete this branch",
-					conflictedRels)))
-			} else {
-				w.Write([]byte(fmt.Sprintf("You need to delete the release '%s' before you can delete this branch",
-					conflictedRels)))
-			}
-			return
-		}
-	}
-
-	// Make a list of commits in this branch
-	lst := map[string]bool{}
-	c, ok := commitList[branch.Commit]
-	if !ok {
-		log.Printf("Error when creating commit list while deleting branch '%s' of database '%s%s%s'\n",
-			branchName, dbOwner, dbFolder, dbName)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	lst[c.ID] = true
-	for c.Parent != "" {
-		c, ok = commitList[c.Parent]
-		if !ok {
-			log.Printf("Error when creating commit list while deleting branch '%s' of database '%s%s%s'\n",
-				branchName, dbOwner, dbFolder, dbName)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		lst[c.ID] = true
-	}
-
-	// For each commit, determine if it's only on this branch, and will need to be deleted after the branch
-	for bName, bEntry := range branchList {
-		if bName == branchName {
-			// We only run this comparison from "other branches", not the branch we're deleting
-			continue
-		}
-
-		// If there are no commits left to check, we might as well stop further looping
-		if len(lst) == 0 {
-			break
-		}
-
-		c, ok = commitList[bEntry.Commit]
-		if !ok {
-			err = fmt.Errorf("Broken commit history encountered when checking for commits while deleting "+
-				"branch '%s' of database '%s%s%s'\n", branchName, dbOwner, dbFolder, dbName)
-			log.Print(err.Error()) // Broken commit history is pretty serious, so we log it for admin investigation
-			return
-		}
-		for delCommit := range lst {
-			if c.ID == delCommit {
-				// The commit is also on another branch, so we *must not* delete the commit afterwards
-				delete(lst, c.ID)
-			}
-		}
-		for c.Parent != "" {
-			c, ok = commitList[c.Parent]
-			if !ok {
-				err = fmt.Errorf("Broken commit history encountered when checking for commits while "+
-					"deleting branch '%s' of database '%s%s%s'\n", branchName, dbOwner, dbFolder, dbName)
-				log.Print(err.Error()) // Broken commit history is pretty serious, so we log it for admin investigation
-				return
-			}
-			for delCommit := range lst {
-				if c.ID == delCommit {
-					// The commit is also on another branch, so we *must not* delete the commit afterwards
-					delete(lst, c.ID)
-				}
-			}
-		}
-	}
-
 	// Delete the branch
-	delete(branchList, branchName)
-	err = com.StoreBranches(dbOwner, dbFolder, dbName, branchList)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Delete the left over commits
-	// TODO: We may want to consider clearing any memcache entries for the deleted commits too
-	for cid := range lst {
-		delete(commitList, cid)
-	}
-	err = com.StoreCommits(dbOwner, dbFolder, dbName, commitList)
-	if err != nil {
-		log.Printf("Error when updating commit list while deleting branch '%s' of database '%s%s%s': %s\n",
-			branchName, dbOwner, dbFolder, dbName, err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Invalidate the memcache data for the database, so the new branch count gets picked up
-	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
+	err = com.DeleteBranch(loggedInUser, dbOwner, dbFolder, dbName, branchName)
 	if err != nil {
-		// Something went wrong when invalidating memcached entries for the database
-		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+		w.WriteHeader(com.ErrorStatus(err))
+		w.Write([]byte(err.Error()))
 		return
 	}
 
@@ -2313,8 +1913,7 @@ func deleteReleaseHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete the release
-	delete(releases, relName)
-	err = com.StoreReleases(dbOwner, dbFolder, dbName, releases)
+	err = com.RemoveRelease(dbOwner, dbFolder, dbName, relName)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -2394,38 +1993,10 @@ func deleteTagHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make sure the database is owned by the logged in user. eg prevent changes to other people's databases
-	if strings.ToLower(dbOwner) != strings.ToLower(loggedInUser) {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	// Load the existing tags for the database
-	tags, err := com.GetTags(loggedInUser, dbFolder, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Make sure the given tag exists
-	if _, ok := tags[tagName]; !ok {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
 	// Delete the tag
-	delete(tags, tagName)
-	err = com.StoreTags(dbOwner, dbFolder, dbName, tags)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Invalidate the memcache data for the database, so the new tag count gets picked up
-	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
+	err = com.DeleteTag(loggedInUser, dbOwner, dbFolder, dbName, tagName)
 	if err != nil {
-		// Something went wrong when invalidating memcached entries for the database
-		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
+		w.WriteHeader(com.ErrorStatus(err))
 		return
 	}
 
@@ -2661,7 +2232,8 @@ func diffCommitListHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Convert the commit entries into something we can display in a commit list
 	var x struct {
-		CommitList []com.CommitData `json:"commit_list"`
+		CommitList  []com.CommitData `json:"commit_list"`
+		MissingTags []string         `json:"missing_tags"`
 	}
 	for _, j := range cList {
 		var c com.CommitData
@@ -2692,6 +2264,14 @@ func diffCommitListHandler(w http.ResponseWriter, r *http.Request) {
 		x.CommitList = append(x.CommitList, c)
 	}
 
+	// Include the tags which exist in the destination database but not the source
+	x.MissingTags, err = com.MissingTags(srcOwner, srcFolder, srcDBName, destOwner, destFolder, destDBName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
 	// Return the commit list
 	y, err := json.MarshalIndent(x, "", " ")
 	if err != nil {
@@ -2708,8 +2288,8 @@ func downloadCSVHandler(w http.ResponseWriter, r *http.Request) {
 	pageName := "Download CSV"
 
 	// Extract the username, database, table, and commit ID requested
-	// NOTE - The commit ID is optional.  Without it, we just pick the latest commit from the (for now) default branch
-	// TODO: Add support for passing in a specific branch, to get the latest commit for that instead
+	// NOTE - The commit ID is optional.  A branch, tag, or release name can be given instead, and without any of them we
+	// just pick the latest commit from the default branch
 	dbOwner, dbName, dbTable, commitID, err := com.GetODTC(2, r) // 2 = Ignore "/x/download/" at the start of the URL
 	if err != nil {
 		errorPage(w, r, http.StatusBadRequest, err.Error())
@@ -2723,6 +2303,13 @@ func downloadCSVHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Retrieve the filter conditions (if any)
+	filters, err := com.GetFormWhereClauses(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Retrieve session data (if any)
 	var loggedInUser string
 	var u interface{}
@@ -2740,6 +2327,13 @@ func downloadCSVHandler(w http.ResponseWriter, r *http.Request) {
 		loggedInUser = u.(string)
 	}
 
+	// Work out which commit was requested
+	commitID, status, err := downloadCommit(r, loggedInUser, dbOwner, "/", dbName, commitID)
+	if err != nil {
+		errorPage(w, r, status, err.Error())
+		return
+	}
+
 	// Verify the given database exists and is ok to be downloaded (and get the Minio bucket + id while at it)
 	bucket, id, _, err := com.MinioLocation(dbOwner, "/", dbName, commitID, loggedInUser)
 	if err != nil {
@@ -2773,7 +2367,7 @@ func downloadCSVHandler(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	// Read the table data from the database object
-	resultSet, err := com.ReadSQLiteDBCSV(sdb, dbTable)
+	resultSet, err := com.ReadSQLiteDBCSV(sdb, dbTable, filters)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, "Error reading table data from the database")
 		return
@@ -2801,17 +2395,35 @@ func downloadCSVHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func downloadHandler(w http.ResponseWriter, r *http.Request) {
-	pageName := "Download Handler"
+// Sends the contents of a single table cell (usually a BLOB) to the user.
+func downloadCellHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Download cell"
 
-	// NOTE - The commit ID is optional.  Without it, we just pick the latest commit from the (for now) default branch
-	// TODO: Add support for passing in a specific branch, to get the latest commit for that instead
-	dbOwner, dbName, commitID, err := com.GetODC(2, r) // 2 = Ignore "/x/download/" at the start of the URL
+	// Extract the username, database, table, and commit ID requested
+	dbOwner, dbName, dbTable, commitID, err := com.GetODTC(2, r) // 2 = Ignore "/x/downloadcell/" at the start of the URL
 	if err != nil {
-		errorPage(w, r, http.StatusBadRequest, err.Error())
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	dbFolder := "/"
+	if dbTable == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Validate the column name and row id
+	colName := r.FormValue("col")
+	err = com.ValidateFieldName(colName)
+	if err != nil {
+		log.Printf("%s: Validation failed for column name '%s': %v\n", pageName, colName, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rowID, err := strconv.ParseInt(r.FormValue("rowid"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
 	// Retrieve session data (if any)
 	var loggedInUser string
@@ -2819,7 +2431,7 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 	if com.Conf.Environment.Environment != "docker" {
 		sess, err := store.Get(r, "dbhub-user")
 		if err != nil {
-			errorPage(w, r, http.StatusBadRequest, err.Error())
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 		u = sess.Values["UserName"]
@@ -2830,41 +2442,149 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 		loggedInUser = u.(string)
 	}
 
-	// Verify the given database exists and is ok to be downloaded (and get the Minio bucket + id while at it)
+	// Check if the user has access to the requested database
 	bucket, id, _, err := com.MinioLocation(dbOwner, dbFolder, dbName, commitID, loggedInUser)
 	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// Get a handle from Minio for the database object
-	userDB, err := com.MinioHandle(bucket, id)
+	// Open the database
+	sdb, err := com.OpenMinioObject(bucket, id)
 	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer sdb.Close()
 
-	// Close the object handle when this function finishes
-	defer func() {
-		com.MinioHandleClose(userDB)
-	}()
-
-	// Get the file details
-	stat, err := userDB.Stat()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Make sure the requested table and column exist
+	colList, err := sdb.Columns("", dbTable)
+	if err != nil || len(colList) == 0 {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-
-	// Was a user agent part of the request?
-	var userAgent string
-	if ua, ok := r.Header["User-Agent"]; ok {
-		userAgent = ua[0]
+	colExists := false
+	for _, j := range colList {
+		if j.Name == colName {
+			colExists = true
+		}
+	}
+	if !colExists {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	// Make a record of the download
-	err = com.LogDownload(dbOwner, dbFolder, dbName, loggedInUser, r.RemoteAddr, "webui", userAgent,
-		time.Now(), bucket+id)
+	// Read the cell data
+	data, err := com.ReadSQLiteCell(sdb, dbTable, colName, rowID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Images and PDFs are displayed inline, everything else is downloaded
+	mimeType := com.SniffBlob(data)
+	disposition := "attachment"
+	var ext string
+	switch mimeType {
+	case "application/json":
+		ext = ".json"
+	case "application/pdf":
+		disposition, ext = "inline", ".pdf"
+	case "image/gif":
+		disposition, ext = "inline", ".gif"
+	case "image/jpeg":
+		disposition, ext = "inline", ".jpg"
+	case "image/png":
+		disposition, ext = "inline", ".png"
+	case "image/svg+xml":
+		disposition, ext = "inline", ".svg"
+	default:
+		ext = ".bin"
+	}
+
+	// Send the data to the user.  The content security policy stops any scripts (eg in SVG images) from running
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition,
+		url.QueryEscape(fmt.Sprintf("%s-%s-%d%s", dbTable, colName, rowID, ext))))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, err = w.Write(data)
+	if err != nil {
+		log.Printf("%s: Error returning cell data: %v\n", pageName, err)
+	}
+}
+
+// Works out which commit a download is for.  A commit ID, branch, tag, or release name can be requested, with the
+// release name "latest" giving the most recent release.  Without any of them, the head of the default branch is used.
+func downloadCommit(r *http.Request, loggedInUser string, dbOwner string, dbFolder string, dbName string,
+	commitID string) (string, int, error) {
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	tagName, err := com.GetFormTag(r)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	releaseName, err := com.GetFormRelease(r)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	// Check the database exists, and the user has access to it, before looking up the name
+	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if !exists {
+		return "", http.StatusNotFound, fmt.Errorf("Database '%s%s%s' doesn't exist", dbOwner, dbFolder, dbName)
+	}
+	commitID, err = com.ResolveCommit(dbOwner, dbFolder, dbName, commitID, releaseName, branchName, tagName)
+	if err != nil {
+		return "", http.StatusNotFound, err
+	}
+	return commitID, http.StatusOK, nil
+}
+
+func downloadHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Download Handler"
+
+	// NOTE - The commit ID is optional.  A branch, tag, or release name can be given instead, and without any of them we
+	// just pick the latest commit from the default branch
+	dbOwner, dbName, commitID, err := com.GetODC(2, r) // 2 = Ignore "/x/download/" at the start of the URL
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	dbFolder := "/"
+
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+	}
+
+	// Work out which commit was requested
+	commitID, status, err := downloadCommit(r, loggedInUser, dbOwner, dbFolder, dbName, commitID)
+	if err != nil {
+		errorPage(w, r, status, err.Error())
+		return
+	}
+
+	// Verify the given database exists and is ok to be downloaded (and get the Minio bucket + id while at it)
+	bucket, id, lastMod, err := com.MinioLocation(dbOwner, dbFolder, dbName, commitID, loggedInUser)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -2872,12 +2592,30 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Send the database to the user
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, dbName))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size))
 	w.Header().Set("Content-Type", "application/x-sqlite3")
-	bytesWritten, err := io.Copy(w, userDB)
+	bytesWritten, newDownload, err := com.ServeDatabase(w, r, bucket, id, lastMod)
 	if err != nil {
 		log.Printf("%s: Error returning DB file: %v\n", pageName, err)
-		fmt.Fprintf(w, "%s: Error returning DB file: %v\n", pageName, err)
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Cache revalidations and partial requests (eg from range readers) don't count as new downloads
+	if !newDownload {
+		return
+	}
+
+	// Was a user agent part of the request?
+	var userAgent string
+	if ua, ok := r.Header["User-Agent"]; ok {
+		userAgent = ua[0]
+	}
+
+	// Make a record of the download
+	err = com.LogDownload(dbOwner, dbFolder, dbName, loggedInUser, r.RemoteAddr, "webui", userAgent,
+		time.Now(), bucket+id)
+	if err != nil {
+		log.Printf("%s: Error when logging download: %v\n", pageName, err)
 		return
 	}
 
@@ -2885,7 +2623,7 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
 		err = com.IncrementDownloadCount(dbOwner, dbFolder, dbName)
 		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			log.Printf("%s: Error when incrementing download count: %v\n", pageName, err)
 			return
 		}
 	}
@@ -2898,8 +2636,8 @@ func downloadRedashJSONHandler(w http.ResponseWriter, r *http.Request) {
 	pageName := "Download Redash JSON"
 
 	// Extract the username, database, table, and commit ID requested
-	// NOTE - The commit ID is optional.  Without it, we just pick the latest commit from the (for now) default branch
-	// TODO: Add support for passing in a specific branch, to get the latest commit for that instead
+	// NOTE - The commit ID is optional.  A branch, tag, or release name can be given instead, and without any of them we
+	// just pick the latest commit from the default branch
 	dbOwner, dbName, dbTable, commitID, err := com.GetODTC(2, r) // 2 = Ignore "/x/download/" at the start of the URL
 	if err != nil {
 		errorPage(w, r, http.StatusBadRequest, err.Error())
@@ -2930,6 +2668,13 @@ func downloadRedashJSONHandler(w http.ResponseWriter, r *http.Request) {
 		loggedInUser = u.(string)
 	}
 
+	// Work out which commit was requested
+	commitID, status, err := downloadCommit(r, loggedInUser, dbOwner, "/", dbName, commitID)
+	if err != nil {
+		errorPage(w, r, status, err.Error())
+		return
+	}
+
 	// Verify the given database exists and is ok to be downloaded (and get the Minio bucket + id while at it)
 	bucket, id, _, err := com.MinioLocation(dbOwner, "/", dbName, commitID, loggedInUser)
 	if err != nil {
@@ -3061,8 +2806,9 @@ func forkDBHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add the forked database info to PostgreSQL
-	_, err = com.ForkDatabase(dbOwner, dbFolder, dbName, loggedInUser)
+	// Add the forked database info to PostgreSQL.  Tags and releases are copied too, unless asked not to
+	copyTags := r.FormValue("notags") != "true"
+	_, err = com.ForkDatabase(dbOwner, dbFolder, dbName, loggedInUser, copyTags)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -3120,8 +2866,19 @@ func generateCertHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Each certificate is named (eg after the machine it's for), so it can be told apart when revoking
+	certName := r.FormValue("name")
+	if certName == "" {
+		certName = fmt.Sprintf("Certificate %s", time.Now().Format("2006-01-02 15.04.05"))
+	}
+	err := com.ValidateDisplayName(certName)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Validation failed for certificate name")
+		return
+	}
+
 	// Generate a new certificate
-	newCert, err := com.GenerateClientCert(loggedInUser)
+	newCert, err := com.NewClientCert(loggedInUser, certName)
 	if err != nil {
 		log.Printf("Error generating client certificate for user '%s': %s!\n", loggedInUser, err)
 		errorPage(w, r, http.StatusInternalServerError, "Error generating client certificate")
@@ -3232,8 +2989,8 @@ func main() {
 	tmpl = template.Must(template.New("templates").Delims("[[", "]]").ParseGlob(
 		filepath.Join(com.Conf.Web.BaseDir, "webui", "templates", "*.html")))
 
-	// Connect to Minio server
-	err = com.ConnectMinio()
+	// Connect to the storage back end
+	err = com.ConnectStorage()
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
@@ -3244,6 +3001,18 @@ func main() {
 		log.Fatalf(err.Error())
 	}
 
+	// Make sure the PostgreSQL schema is up to date, applying any waiting migrations if that's turned on
+	_, err = com.MigrateDatabase(com.Conf.Pg.AutoMigrate)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// Record any client certificates issued before they were tracked, so they can still be used and revoked
+	err = com.BackfillClientCerts()
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
 	// Add the default user to the system
 	// Note - we don't check for an error here on purpose.  If we were to fail on an error, then subsequent runs after
 	// the first would barf with PG errors about trying to insert multiple "default" users violating unique
@@ -3275,6 +3044,20 @@ func main() {
 	// Start the email sending goroutine in the background
 	go com.SendEmails()
 
+	// Start the index creation worker in the background
+	go com.IndexWorker()
+
+	// Start the source URL mirroring worker in the background, if it's turned on
+	if com.Conf.Mirror.Enabled {
+		go com.MirrorWorker()
+	}
+
+	// Start the fork sync worker in the background
+	go com.ForkSyncWorker()
+
+	// Start the worker which removes expired upload sessions in the background
+	go com.UploadSessionWorker()
+
 	// Our pages
 	http.Handle("/", gz.GzipHandler(logReq(mainHandler)))
 	http.Handle("/about", gz.GzipHandler(logReq(aboutPage)))
@@ -3288,11 +3071,13 @@ func main() {
 	http.Handle("/createtag/", gz.GzipHandler(logReq(createTagPage)))
 	http.Handle("/discuss/", gz.GzipHandler(logReq(discussPage)))
 	http.Handle("/forks/", gz.GzipHandler(logReq(forksPage)))
+	http.Handle("/history/", gz.GzipHandler(logReq(historyPage)))
 	http.Handle("/logout", gz.GzipHandler(logReq(logoutHandler)))
 	http.Handle("/merge/", gz.GzipHandler(logReq(mergePage)))
 	http.Handle("/pref", gz.GzipHandler(logReq(prefHandler)))
 	http.Handle("/register", gz.GzipHandler(logReq(createUserHandler)))
 	http.Handle("/releases/", gz.GzipHandler(logReq(releasesPage)))
+	http.Handle("/schema/", gz.GzipHandler(logReq(schemaPage)))
 	http.Handle("/selectusername", gz.GzipHandler(logReq(selectUserNamePage)))
 	http.Handle("/settings/", gz.GzipHandler(logReq(settingsPage)))
 	http.Handle("/stars/", gz.GzipHandler(logReq(starsPage)))
@@ -3303,11 +3088,14 @@ func main() {
 	http.Handle("/x/branchnames", gz.GzipHandler(logReq(branchNamesHandler)))
 	http.Handle("/x/callback", gz.GzipHandler(logReq(auth0CallbackHandler)))
 	http.Handle("/x/checkname", gz.GzipHandler(logReq(checkNameHandler)))
+	http.Handle("/x/commitgraph/", gz.GzipHandler(logReq(commitGraphHandler)))
+	http.Handle("/x/cherrypick", gz.GzipHandler(logReq(cherryPickHandler)))
 	http.Handle("/x/createbranch", gz.GzipHandler(logReq(createBranchHandler)))
 	http.Handle("/x/createcomment/", gz.GzipHandler(logReq(createCommentHandler)))
 	http.Handle("/x/creatediscuss", gz.GzipHandler(logReq(createDiscussHandler)))
 	http.Handle("/x/createmerge/", gz.GzipHandler(logReq(createMergeHandler)))
 	http.Handle("/x/createtag", gz.GzipHandler(logReq(createTagHandler)))
+	http.Handle("/x/crl", gz.GzipHandler(logReq(crlHandler)))
 	http.Handle("/x/deletebranch/", gz.GzipHandler(logReq(deleteBranchHandler)))
 	http.Handle("/x/deletecomment/", gz.GzipHandler(logReq(deleteCommentHandler)))
 	http.Handle("/x/deletecommit/", gz.GzipHandler(logReq(deleteCommitHandler)))
@@ -3315,24 +3103,34 @@ func main() {
 	http.Handle("/x/deleterelease/", gz.GzipHandler(logReq(deleteReleaseHandler)))
 	http.Handle("/x/deletetag/", gz.GzipHandler(logReq(deleteTagHandler)))
 	http.Handle("/x/diffcommitlist/", gz.GzipHandler(logReq(diffCommitListHandler)))
-	http.Handle("/x/download/", gz.GzipHandler(logReq(downloadHandler)))
+	http.Handle("/x/download/", logReq(downloadHandler)) // Not compressed, so byte ranges refer to the database file
+	http.Handle("/x/downloadcell/", gz.GzipHandler(logReq(downloadCellHandler)))
 	http.Handle("/x/downloadcsv/", gz.GzipHandler(logReq(downloadCSVHandler)))
 	http.Handle("/x/downloadredashjson/", gz.GzipHandler(logReq(downloadRedashJSONHandler)))
 	http.Handle("/x/forkdb/", gz.GzipHandler(logReq(forkDBHandler)))
 	http.Handle("/x/gencert", gz.GzipHandler(logReq(generateCertHandler)))
 	http.Handle("/x/markdownpreview/", gz.GzipHandler(logReq(markdownPreview)))
 	http.Handle("/x/mergerequest/", gz.GzipHandler(logReq(mergeRequestHandler)))
+	http.Handle("/x/releasekey", gz.GzipHandler(logReq(releaseKeyHandler)))
+	http.Handle("/x/releasemanifest/", gz.GzipHandler(logReq(releaseManifestHandler)))
+	http.Handle("/x/revertcommit/", gz.GzipHandler(logReq(revertCommitHandler)))
+	http.Handle("/x/revokecert", gz.GzipHandler(logReq(revokeCertHandler)))
 	http.Handle("/x/savesettings", gz.GzipHandler(logReq(saveSettingsHandler)))
 	http.Handle("/x/setdefaultbranch/", gz.GzipHandler(logReq(setDefaultBranchHandler)))
 	http.Handle("/x/star/", gz.GzipHandler(logReq(starToggleHandler)))
+	http.Handle("/x/syncfork", gz.GzipHandler(logReq(syncForkHandler)))
 	http.Handle("/x/table/", gz.GzipHandler(logReq(tableViewHandler)))
 	http.Handle("/x/tablenames/", gz.GzipHandler(logReq(tableNamesHandler)))
+	http.Handle("/x/tableprofile/", gz.GzipHandler(logReq(tableProfileHandler)))
 	http.Handle("/x/updatebranch/", gz.GzipHandler(logReq(updateBranchHandler)))
 	http.Handle("/x/updatecomment/", gz.GzipHandler(logReq(updateCommentHandler)))
 	http.Handle("/x/updatediscuss/", gz.GzipHandler(logReq(updateDiscussHandler)))
 	http.Handle("/x/updaterelease/", gz.GzipHandler(logReq(updateReleaseHandler)))
 	http.Handle("/x/updatetag/", gz.GzipHandler(logReq(updateTagHandler)))
+	http.Handle("/x/uploadcreate", gz.GzipHandler(logReq(uploadCreateHandler)))
 	http.Handle("/x/uploaddata/", gz.GzipHandler(logReq(uploadDataHandler)))
+	http.Handle("/x/uploadfinish", gz.GzipHandler(logReq(uploadFinishHandler)))
+	http.Handle("/x/uploadsession", gz.GzipHandler(logReq(uploadSessionHandler)))
 	http.Handle("/x/watch/", gz.GzipHandler(logReq(watchToggleHandler)))
 
 	// CSS
@@ -3700,128 +3498,14 @@ func mergeRequestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure the request is coming from the database owner
-	if strings.ToLower(dbOwner) != strings.ToLower(loggedInUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprint(w, "Only the database owner can merge in merge requests")
-		return
-	}
-
-	// Retrieve the names of the source & destination databases and branches
-	disc, err := com.Discussions(dbOwner, dbFolder, dbName, com.MERGE_REQUEST, mrID)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
-		return
-	}
-	branchName := disc[0].MRDetails.DestBranch
-	commitDiffList := disc[0].MRDetails.Commits
-	srcOwner := disc[0].MRDetails.SourceOwner
-	srcFolder := disc[0].MRDetails.SourceFolder
-	srcDBName := disc[0].MRDetails.SourceDBName
-	srcBranchName := disc[0].MRDetails.SourceBranch
-
-	// Ensure the merge request isn't closed
-	if !disc[0].Open {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Cannot merge a closed merge request")
-		return
-	}
-
-	// Get the details of the head commit for the destination database branch
-	branchList, err := com.GetBranches(dbOwner, dbFolder, dbName) // Destination branch list
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
-		return
-	}
-	branchDetails, ok := branchList[branchName]
-	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, "Could not retrieve details for the destination branch")
-		return
-	}
-	destCommitID := branchDetails.Commit
-	destCommitList, err := com.GetCommitList(dbOwner, dbFolder, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
-		return
-	}
-
-	// Check if the MR commits will still apply cleanly to the destination branch
-	finalCommit := commitDiffList[len(commitDiffList)-1]
-	if finalCommit.Parent != destCommitID {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, fmt.Errorf("Destination branch has changed. Merge cannot proceed."))
-		return
-	}
-
-	// * The required details have been collected, and sanity checks completed, so merge the MR *
-
-	// Add the source commits directly to the destination commit list
-	for _, j := range commitDiffList {
-		destCommitList[j.ID] = j
-	}
-
-	// Retrieve details for the logged in user
-	usr, err := com.User(loggedInUser)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
-		return
-	}
-
-	// Create a merge commit, using the details of the source commit (this gets us a correctly filled in DB tree
-	// structure easily)
-	mrg := commitDiffList[0]
-	mrg.AuthorEmail = usr.Email
-	mrg.AuthorName = usr.DisplayName
-	mrg.Message = fmt.Sprintf("Merge branch '%s' of '%s%s%s' into '%s'", srcBranchName, srcOwner, srcFolder,
-		srcDBName, branchName)
-	mrg.Parent = commitDiffList[0].ID
-	mrg.OtherParents = append(mrg.OtherParents, destCommitID)
-	mrg.Timestamp = time.Now().UTC()
-	mrg.ID = com.CreateCommitID(mrg)
-
-	// Add the new commit to the destination db commit list, and update the branch list with it
-	destCommitList[mrg.ID] = mrg
-	b := com.BranchEntry{
-		Commit:      mrg.ID,
-		CommitCount: branchDetails.CommitCount + len(commitDiffList) + 1,
-		Description: branchDetails.Description,
-	}
-	branchList[branchName] = b
-	err = com.StoreCommits(dbOwner, dbFolder, dbName, destCommitList)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
-		return
-	}
-	err = com.StoreBranches(dbOwner, dbFolder, dbName, branchList)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
-		return
-	}
-
-	// Change the status of the MR to closed, and indicate it was successfully merged
-	err = com.StoreComment(dbOwner, dbFolder, dbName, loggedInUser, mrID, "", true,
-		com.CLOSED_WITH_MERGE)
+	// Merge the MR
+	err = com.MergeRequest(loggedInUser, dbOwner, dbFolder, dbName, mrID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(com.ErrorStatus(err))
 		fmt.Fprint(w, err.Error())
 		return
 	}
 
-	// Invalidate the memcached entries for the destination database case
-	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbFolder, dbName, "") // Empty string indicates "for all versions"
-	if err != nil {
-		// Something went wrong when invalidating memcached entries for the database
-		log.Printf("Error when invalidating memcache entries: %s\n", err.Error())
-		return
-	}
-
 	// Send a success message back to the caller
 	w.WriteHeader(http.StatusOK)
 }
@@ -3934,16 +3618,42 @@ func prefHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/"+loggedInUser, http.StatusSeeOther)
 }
 
-// Handler for the Database Settings page
-func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
+// Returns the public key used for signing release manifests, so clients can verify them.
+func releaseKeyHandler(w http.ResponseWriter, r *http.Request) {
+	pubKey, err := com.ReleasePublicKey()
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="dbhub-release-key.pem"`)
+	w.Write(pubKey)
+}
+
+// Returns the signed manifest for a release.  The signature covers the exact bytes of the "manifest" string.
+func releaseManifestHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Release manifest handler"
+
+	// Retrieve user and database name
+	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/releasemanifest/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dbFolder := "/"
+	relName, err := com.GetFormRelease(r)
+	if err != nil || relName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	// Retrieve session data (if any)
 	var loggedInUser string
 	var u interface{}
-	validSession := false
 	if com.Conf.Environment.Environment != "docker" {
 		sess, err := store.Get(r, "dbhub-user")
 		if err != nil {
-			errorPage(w, r, http.StatusBadRequest, err.Error())
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 		u = sess.Values["UserName"]
@@ -3952,62 +3662,261 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	if u != nil {
 		loggedInUser = u.(string)
-		validSession = true
 	}
 
-	// Ensure we have a valid logged in user
-	if validSession != true {
-		errorPage(w, r, http.StatusUnauthorized, "You need to be logged in")
-		return
-	}
-
-	// Extract the username, folder, and (current) database name form variables
-	usr, dbFolder, dbName, err := com.GetUFD(r, false)
+	// Check if the user has access to the requested database
+	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
 	if err != nil {
-		errorPage(w, r, http.StatusBadRequest, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	dbOwner := strings.ToLower(usr)
-
-	// Default to the root folder if none was given
-	if dbFolder == "" {
-		dbFolder = "/"
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	// Make sure a username was given
-	if len(dbOwner) == 0 || dbOwner == "" {
-		// No username supplied
-		errorPage(w, r, http.StatusBadRequest, "No username supplied!")
+	// Retrieve the manifest for the release
+	rels, err := com.GetReleases(dbOwner, dbFolder, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	// Make sure the database owner matches the logged in user
-	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
-		errorPage(w, r, http.StatusBadRequest, "You can only change settings for your own databases.")
+	rel, ok := rels[relName]
+	if !ok || rel.Manifest == "" {
+		log.Printf("%s: No signed manifest for release '%s' of '%s%s%s'\n", pageName, relName, dbOwner, dbFolder,
+			dbName)
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-
-	// Extract the form variables
-	oneLineDesc := r.PostFormValue("onelinedesc")
-	newName := r.PostFormValue("newname")
-	fullDesc := r.PostFormValue("fulldesc")
-	defTable := r.PostFormValue("defaulttable") // TODO: Update the default table to be "per branch"
-	licences := r.PostFormValue("licences")
-
-	// Validate the licence names
-	branchLics := make(map[string]string)
-	err = json.Unmarshal([]byte(licences), &branchLics)
+	pubKey, err := com.ReleasePublicKey()
 	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	for bName, lName := range branchLics {
-		err = com.ValidateLicence(lName)
-		if err != nil {
-			errorPage(w, r, http.StatusBadRequest, fmt.Sprintf(
-				"Validation failed on licence name for branch '%s'", bName))
-			return
-		}
+	jsonData, err := json.MarshalIndent(com.SignedReleaseManifest{
+		Manifest:  rel.Manifest,
+		PublicKey: string(pubKey),
+		Signature: rel.Signature,
+	}, "", "  ")
+	if err != nil {
+		log.Printf("%s: Error when JSON marshalling release manifest: %v\n", pageName, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.manifest.json"`, dbName,
+		relName))
+	fmt.Fprint(w, string(jsonData))
+}
+
+// Reverts a commit, by adding a new commit to the branch which undoes its changes.
+func revertCommitHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Revert commit handler"
+
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	validSession := false
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+		validSession = true
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, dbFolder, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dbOwner := strings.ToLower(usr)
+	commit, err := com.GetFormCommit(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// If any of the required values were empty, indicate failure
+	if branchName == "" || dbFolder == "" || dbName == "" || dbOwner == "" || commit == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the database exists in the system
+	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		log.Printf("%s: Validation failed for database name: %s", pageName, err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Revert the commit
+	newCommit, err := com.RevertCommit(r, loggedInUser, dbOwner, dbFolder, dbName, branchName, commit, "webui")
+	if err != nil {
+		log.Printf("%s: Reverting commit '%s' failed: %v\n", pageName, commit, err)
+		w.WriteHeader(com.ErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	// Return the ID of the new commit
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(newCommit))
+}
+
+// Revokes one of the logged in user's client certificates.
+func revokeCertHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u == nil {
+		errorPage(w, r, http.StatusUnauthorized, "You need to be logged in")
+		return
+	}
+	loggedInUser = u.(string)
+
+	// Retrieve the certificate ID
+	certID, err := strconv.ParseInt(r.PostFormValue("certid"), 10, 64)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Invalid certificate ID")
+		return
+	}
+
+	// Revoke the certificate
+	err = com.RevokeClientCert(loggedInUser, certID)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Bounce back to the preferences page
+	http.Redirect(w, r, "/pref", http.StatusSeeOther)
+}
+
+// Handler for the Database Settings page
+func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	validSession := false
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+		validSession = true
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		errorPage(w, r, http.StatusUnauthorized, "You need to be logged in")
+		return
+	}
+
+	// Extract the username, folder, and (current) database name form variables
+	usr, dbFolder, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	dbOwner := strings.ToLower(usr)
+
+	// Default to the root folder if none was given
+	if dbFolder == "" {
+		dbFolder = "/"
+	}
+
+	// Make sure a username was given
+	if len(dbOwner) == 0 || dbOwner == "" {
+		// No username supplied
+		errorPage(w, r, http.StatusBadRequest, "No username supplied!")
+		return
+	}
+
+	// Make sure the database owner matches the logged in user
+	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
+		errorPage(w, r, http.StatusBadRequest, "You can only change settings for your own databases.")
+		return
+	}
+
+	// Extract the form variables
+	oneLineDesc := r.PostFormValue("onelinedesc")
+	newName := r.PostFormValue("newname")
+	fullDesc := r.PostFormValue("fulldesc")
+	defTable := r.PostFormValue("defaulttable") // TODO: Update the default table to be "per branch"
+	licences := r.PostFormValue("licences")
+	rulesJSON := r.PostFormValue("validationrules")
+
+	// Validate the licence names
+	branchLics := make(map[string]string)
+	err = json.Unmarshal([]byte(licences), &branchLics)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for bName, lName := range branchLics {
+		err = com.ValidateLicence(lName)
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, fmt.Sprintf(
+				"Validation failed on licence name for branch '%s'", bName))
+			return
+		}
+	}
+
+	// Validate the data validation rules
+	var rules []com.ValidationRule
+	if rulesJSON != "" {
+		err = json.Unmarshal([]byte(rulesJSON), &rules)
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, "Error when parsing data validation rules")
+			return
+		}
+		err = com.ValidateValidationRules(rules)
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
 	// Validate the source URL
@@ -4032,6 +3941,24 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate the branch to mirror the source URL into (if any)
+	mirrorBranch := r.PostFormValue("mirrorbranch")
+	if mirrorBranch != "" {
+		err = com.ValidateBranchName(mirrorBranch)
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, "Validation failed for mirror branch name")
+			return
+		}
+		if _, ok := branchLics[mirrorBranch]; !ok {
+			errorPage(w, r, http.StatusBadRequest, "Unknown mirror branch")
+			return
+		}
+		if sourceURL == "" {
+			errorPage(w, r, http.StatusBadRequest, "A source URL is needed for mirroring")
+			return
+		}
+	}
+
 	// If set, validate the new database name
 	if newName != dbName {
 		err := com.ValidateDB(newName)
@@ -4138,7 +4065,7 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Loop through the branches of the database, processing the user submitted licence choice for each
-	branchesUpdated := false
+	newCommits := make(map[string]com.CommitEntry)
 	newBranchHeads := make(map[string]com.BranchEntry)
 	for bName, bEntry := range branchList {
 		// Get the previous licence entry for the branch
@@ -4213,35 +4140,27 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 			// Calculate the new commit ID, which incorporates the updated tree ID (and thus the new licence sha256)
 			newCom.ID = com.CreateCommitID(newCom)
 
-			// Add the new commit to the commit list
-			commitList[newCom.ID] = newCom
+			// Add the new commit to the list of commits to store
+			newCommits[newCom.ID] = newCom
 
-			// Add the commit to the new branch heads list, and set a flag indicating it needs to be stored to the
-			// database after the licence processing finishes
+			// Add the commit to the new branch heads list, so it gets stored to the database after the licence
+			// processing finishes
 			newBranchEntry := com.BranchEntry{
 				Commit:      newCom.ID,
 				CommitCount: bEntry.CommitCount + 1,
 				Description: bEntry.Description,
 			}
 			newBranchHeads[bName] = newBranchEntry
-			branchesUpdated = true
-		} else {
-			// Copy the old branch entry to the new list
-			newBranchHeads[bName] = branchList[bName]
 		}
 	}
 
-	// If the branches were updated, store the new commit list and branch heads
-	if branchesUpdated {
-		err = com.StoreCommits(dbOwner, dbFolder, dbName, commitList)
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		err = com.StoreBranches(dbOwner, dbFolder, dbName, newBranchHeads)
+	// Store the new commits, and move the heads of the updated branches to them.  Branches which have changed since
+	// they were read above are left alone, and the change is rejected
+	for bName, bEntry := range newBranchHeads {
+		newCom := map[string]com.CommitEntry{bEntry.Commit: newCommits[bEntry.Commit]}
+		err = com.UpdateBranchHead(dbOwner, dbFolder, dbName, bName, branchList[bName].Commit, bEntry, newCom)
 		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			errorPage(w, r, com.ErrorStatus(err), err.Error())
 			return
 		}
 	}
@@ -4256,6 +4175,29 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		fullDesc = ""
 	}
 
+	// Save the source URL mirroring branch
+	err = com.StoreMirrorBranch(dbOwner, dbFolder, dbName, mirrorBranch)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Save whether the database (if it's a fork) is kept in sync with its upstream database automatically
+	err = com.StoreForkSync(dbOwner, dbFolder, dbName, r.PostFormValue("forksync") == "true")
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Save the data validation rules
+	if rulesJSON != "" {
+		err = com.StoreValidationRules(dbOwner, dbFolder, dbName, rules)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	// Save settings
 	err = com.SaveDBSettings(dbOwner, dbFolder, dbName, oneLineDesc, fullDesc, defTable, public, sourceURL, defBranch)
 	if err != nil {
@@ -4440,6 +4382,212 @@ func starToggleHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, newStarCount)
 }
 
+// Adds an uploaded database to the system, using the form fields sent with it.  This is used for both normal and
+// resumable uploads.
+func storeUpload(w http.ResponseWriter, r *http.Request, loggedInUser string, dbName string, db io.Reader) {
+	pageName := "Upload DB handler"
+
+	// Grab and validate the supplied "public" form field
+	public, err := com.GetPub(r)
+	if err != nil {
+		log.Printf("%s: Error when converting public value to boolean: %v\n", pageName, err)
+		errorPage(w, r, http.StatusBadRequest, "Public value incorrect")
+		return
+	}
+
+	// Validate the licence value
+	licenceName, err := com.GetFormLicence(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Validation failed for licence value")
+		return
+	}
+
+	// Validate the source URL
+	sourceURL, err := com.GetFormSourceURL(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Validation failed for source URL value")
+		return
+	}
+
+	// Validate the commit message
+	var commitMsg string
+	cm := r.PostFormValue("commitmsg")
+	if cm != "" {
+		err = com.ValidateMarkdown(cm)
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, "Validation failed for the commit message")
+			return
+		}
+		commitMsg = cm
+	}
+
+	// Validate the (optional) branch name
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		log.Printf("%s: Error when validating branch name '%s': %v\n", pageName, branchName, err)
+		errorPage(w, r, http.StatusBadRequest, "Branch name value failed validation")
+		return
+	}
+
+	// TODO: Add support for folders and sub-folders
+	dbFolder := "/"
+
+	// Validate the database name
+	err = com.ValidateDB(dbName)
+	if err != nil {
+		log.Printf("%s: Validation failed for database name: %s", pageName, err)
+		errorPage(w, r, http.StatusBadRequest, "Invalid database name")
+		return
+	}
+
+	// Check if the requested database exists already
+	exists, err := com.CheckDBExists(loggedInUser, loggedInUser, dbFolder, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Retrieve the commit ID for the head of the specified branch
+	var commitID string
+	createBranch := false
+	if exists {
+		branchList, err := com.GetBranches(loggedInUser, dbFolder, dbName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		branchEntry, ok := branchList[branchName]
+		if !ok {
+			// The specified branch name doesn't exist, so we'll need to create it
+			createBranch = true
+
+			// We also need a commit ID to branch from, so we use the head commit of the default branch
+			defBranch, err := com.GetDefaultBranchName(loggedInUser, dbFolder, dbName)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+			branchEntry, ok = branchList[defBranch]
+			if !ok {
+				errorPage(w, r, http.StatusInternalServerError, "Could not retrieve commit info for default branch entry")
+				return
+			}
+		}
+		commitID = branchEntry.Commit
+	}
+
+	// Sanity check the uploaded database, and if ok then add it to the system
+	numBytes, _, failures, err := com.AddDatabase(r, loggedInUser, loggedInUser, dbFolder, dbName, createBranch,
+		branchName, commitID, public, licenceName, commitMsg, sourceURL, db, "webui", time.Now(), time.Time{},
+		"", "", "", "", nil, "")
+	if err != nil {
+		if failures != nil {
+			// The upload was rejected by the data validation rules for the database
+			errorPage(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		errorPage(w, r, com.ErrorStatus(err), err.Error())
+		return
+	}
+
+	// If any data validation rules flagged the new commit, show them on the commits page
+	if len(failures) > 0 {
+		http.Redirect(w, r, fmt.Sprintf("/commits/%s%s%s?branch=%s", loggedInUser, "/", dbName,
+			url.QueryEscape(branchName)), http.StatusSeeOther)
+		return
+	}
+
+	// Log the successful database upload
+	log.Printf("%s: Username: '%s', database '%s%s%s' uploaded', bytes: %v\n", pageName, loggedInUser,
+		loggedInUser, dbFolder, dbName, numBytes)
+
+	// Database upload succeeded.  Bounce the user to the page for their new database
+	http.Redirect(w, r, fmt.Sprintf("/%s%s%s", loggedInUser, "/", dbName), http.StatusSeeOther)
+}
+
+// Brings a branch of a fork up to date with its upstream database, returning the resulting fork status as JSON
+func syncForkHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Sync fork handler"
+
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	validSession := false
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+		validSession = true
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, dbFolder, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dbOwner := strings.ToLower(usr)
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// If any of the required values were empty, indicate failure
+	if branchName == "" || dbFolder == "" || dbName == "" || dbOwner == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the database exists in the system
+	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		log.Printf("%s: Validation failed for database name: %s", pageName, err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Sync the branch
+	status, err := com.SyncFork(loggedInUser, dbOwner, dbFolder, dbName, branchName)
+	if err != nil {
+		log.Printf("%s: Syncing branch '%s' of '%s%s%s' failed: %v\n", pageName, branchName, dbOwner, dbFolder,
+			dbName, err)
+		w.WriteHeader(com.ErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	// Return the new status of the fork
+	y, err := json.MarshalIndent(status, "", " ")
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(y))
+}
+
 // Returns the table and view names present in a specific database commit
 func tableNamesHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve session data (if any)
@@ -4603,18 +4751,132 @@ func tableNamesHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// JSON encode the result
-	data, err := json.MarshalIndent(d, "", " ")
+	// JSON encode the result
+	data, err := json.MarshalIndent(d, "", " ")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// TODO: It would probably be useful to store these table names in memcache too, to later retrieval
+
+	// Return the table name info
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(data))
+}
+
+// Returns the column profile (data quality report) for a table as JSON.  Profiles are generated on demand, then
+// cached.
+func tableProfileHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Table profile handler"
+
+	// Retrieve user, database, table, and commit ID
+	// TODO: Add folder support
+	dbOwner, dbName, requestedTable, commitID, err := com.GetODTC(2, r) // 2 = Ignore "/x/tableprofile/" at the start of the URL
+	if err != nil || requestedTable == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dbFolder := "/"
+
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+	}
+
+	// Check if the user has access to the requested database
+	bucket, id, _, err := com.MinioLocation(dbOwner, dbFolder, dbName, commitID, loggedInUser)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if id == "" {
+		// The requested database wasn't found
+		log.Printf("%s: Requested database not found. Owner: '%s%s%s'", pageName, dbOwner, dbFolder, dbName)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Profiles are cached by commit, so work out which commit is being used if none was given
+	if commitID == "" {
+		commitID, err = com.DefaultCommit(dbOwner, dbFolder, dbName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// If a cached version of the profile exists, use it
+	var profile com.TableProfile
+	dataCacheKey := com.TableRowsCacheKey("tableprofile", loggedInUser, dbOwner, dbFolder, dbName, commitID,
+		requestedTable, 0, nil)
+	ok, err := com.GetCachedData(dataCacheKey, &profile)
+	if err != nil {
+		log.Printf("%s: Error retrieving table profile from cache: %v\n", pageName, err)
+	}
+	if !ok {
+		// Open the Minio database
+		sdb, err := com.OpenMinioObject(bucket, id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer sdb.Close()
+
+		// Check the requested table exists
+		tables, err := com.Tables(sdb, dbName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		tablePresent := false
+		for _, tableName := range tables {
+			if requestedTable == tableName {
+				tablePresent = true
+			}
+		}
+		if !tablePresent {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Generate the profile
+		profile, err = com.ProfileSQLiteTable(sdb, requestedTable)
+		if err != nil {
+			log.Printf("Error occurred when profiling table '%s' of '%s%s%s', commit '%s': %s\n", requestedTable,
+				dbOwner, dbFolder, dbName, commitID, err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Cache the profile in memcache
+		err = com.CacheData(dataCacheKey, profile, com.Conf.Memcache.DefaultCacheTime)
+		if err != nil {
+			log.Printf("%s: Error when caching table profile for '%s%s%s': %v\n", pageName, dbOwner, dbFolder,
+				dbName, err)
+		}
+	}
+
+	// Return the profile as JSON
+	jsonResponse, err := json.MarshalIndent(profile, "", " ")
 	if err != nil {
 		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	// TODO: It would probably be useful to store these table names in memcache too, to later retrieval
-
-	// Return the table name info
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, string(data))
+	fmt.Fprintf(w, "%s", jsonResponse)
 }
 
 // This passes table row data back to the main UI in JSON format.
@@ -4671,6 +4933,20 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Retrieve the filter conditions (if any)
+	filters, err := com.GetFormWhereClauses(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the paging cursor (if any)
+	cursor, err := com.GetFormCursor(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	// Retrieve session data (if any)
 	var loggedInUser string
 	var u interface{}
@@ -4714,8 +4990,8 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// If the data is available from memcached, use that instead of reading from the SQLite database itself
-	dataCacheKey := com.TableRowsCacheKey(fmt.Sprintf("tablejson/%s/%s/%d", sortCol, sortDir, rowOffset),
-		loggedInUser, dbOwner, dbFolder, dbName, commitID, requestedTable, maxRows)
+	dataCacheKey := com.TableRowsCacheKey(fmt.Sprintf("tablejson/%s/%s/%d/%s", sortCol, sortDir, rowOffset, cursor),
+		loggedInUser, dbOwner, dbFolder, dbName, commitID, requestedTable, maxRows, filters)
 
 	// If a cached version of the page data exists, use it
 	var dataRows com.SQLiteRecordSet
@@ -4794,8 +5070,8 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 			requestedTable = tables[0]
 		}
 
-		// If a sort column was requested, verify it exists
-		if sortCol != "" {
+		// If a sort column or filter conditions were requested, verify the columns they use exist
+		if sortCol != "" || len(filters) > 0 {
 			colList, err := sdb.Columns("", requestedTable)
 			if err != nil {
 				log.Printf("Error when reading column names for table '%s': %v\n", requestedTable,
@@ -4803,20 +5079,26 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
-			colExists := false
+			cols := make(map[string]struct{})
 			for _, j := range colList {
-				if j.Name == sortCol {
-					colExists = true
-				}
+				cols[j.Name] = struct{}{}
 			}
-			if colExists == false {
+			if _, ok := cols[sortCol]; !ok {
 				// The requested sort column doesn't exist, so we fall back to no sorting
 				sortCol = ""
 			}
+			for _, j := range filters {
+				if _, ok := cols[j.Column]; !ok {
+					// The requested filter column doesn't exist
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
 		}
 
 		// Read the data from the database
-		dataRows, err = com.ReadSQLiteDB(sdb, requestedTable, maxRows, sortCol, sortDir, rowOffset)
+		dataRows, err = com.ReadSQLiteDB(sdb, requestedTable, maxRows, sortCol, sortDir, rowOffset, cursor,
+			filters)
 		if err != nil {
 			// Some kind of error when reading the database data
 			log.Printf("Error occurred when reading table data for '%s%s%s', commit '%s': %s\n", dbOwner,
@@ -4825,12 +5107,8 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Count the total number of rows in the requested table
-		dataRows.TotalRows, err = com.GetSQLiteRowCount(sdb, requestedTable)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		// The total number of rows (matching the filter conditions) was already counted by ReadSQLiteDB()
+		dataRows.TotalRows = dataRows.RowCount
 
 		// Cache the data in memcache
 		err = com.CacheData(dataCacheKey, dataRows, com.Conf.Memcache.DefaultCacheTime)
@@ -4980,17 +5258,31 @@ func updateBranchHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Update the branch info
-	delete(branches, branchName)
-	branches[newName] = com.BranchEntry{
+	// Update the branch info.  If the branch has moved since it was read above, it's left alone
+	newInfo := com.BranchEntry{
 		Commit:      oldInfo.Commit,
 		CommitCount: oldInfo.CommitCount,
 		Description: newDesc,
 	}
-	err = com.StoreBranches(dbOwner, dbFolder, dbName, branches)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	if newName == branchName {
+		err = com.UpdateBranchHead(dbOwner, dbFolder, dbName, branchName, oldInfo.Commit, newInfo, nil)
+		if err != nil {
+			w.WriteHeader(com.ErrorStatus(err))
+			return
+		}
+	} else {
+		err = com.StoreBranch(dbOwner, dbFolder, dbName, newName, newInfo)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		err = com.RemoveBranch(dbOwner, dbFolder, dbName, branchName, oldInfo.Commit, nil)
+		if err != nil {
+			// Don't leave the new branch name pointing at an old commit
+			com.RemoveBranch(dbOwner, dbFolder, dbName, newName, oldInfo.Commit, nil)
+			w.WriteHeader(com.ErrorStatus(err))
+			return
+		}
 	}
 
 	// Invalidate the memcache data for the database, so the new branch name gets picked up
@@ -5360,21 +5652,37 @@ func updateReleaseHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update the release info
-	delete(releases, relName)
-	releases[newName] = com.ReleaseEntry{
+	newInfo := com.ReleaseEntry{
 		Commit:        oldInfo.Commit,
 		Date:          oldInfo.Date,
 		Description:   newDesc,
+		Manifest:      oldInfo.Manifest,
 		ReleaserEmail: oldInfo.ReleaserEmail,
 		ReleaserName:  oldInfo.ReleaserName,
+		Signature:     oldInfo.Signature,
 		Size:          oldInfo.Size,
 	}
 
-	err = com.StoreReleases(dbOwner, dbFolder, dbName, releases)
+	// The release name is part of the signed manifest, so renamed releases need signing again
+	if newName != relName && oldInfo.Manifest != "" {
+		err = com.SignRelease(dbOwner, dbFolder, dbName, newName, &newInfo)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	err = com.StoreRelease(dbOwner, dbFolder, dbName, newName, newInfo)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if newName != relName {
+		err = com.RemoveRelease(dbOwner, dbFolder, dbName, relName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// Update succeeded
 	w.WriteHeader(http.StatusOK)
@@ -5494,25 +5802,103 @@ func updateTagHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update the tag info
-	delete(tags, tagName)
-	tags[newName] = com.TagEntry{
+	newInfo := com.TagEntry{
 		Commit:      oldInfo.Commit,
 		Date:        oldInfo.Date,
 		Description: newMsg,
 		TaggerEmail: oldInfo.TaggerEmail,
 		TaggerName:  oldInfo.TaggerName,
 	}
-
-	err = com.StoreTags(dbOwner, dbFolder, dbName, tags)
+	err = com.StoreTag(dbOwner, dbFolder, dbName, newName, newInfo)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if newName != tagName {
+		err = com.RemoveTag(dbOwner, dbFolder, dbName, tagName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// Update succeeded
 	w.WriteHeader(http.StatusOK)
 }
 
+// Starts a resumable upload.  The form fields are the same as for the upload form, plus "dbname", "size", and
+// "sha256" for the database being uploaded.  The chunks are then sent to /x/uploadsession, and the upload is
+// completed with /x/uploadfinish.
+func uploadCreateHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	validSession := false
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+		validSession = true
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Validate the database details
+	err := r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	dbName := r.PostFormValue("dbname")
+	err = com.ValidateDB(dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid database name")
+		return
+	}
+	size, err := strconv.ParseInt(r.PostFormValue("size"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Missing or invalid database size")
+		return
+	}
+
+	// Create the upload session
+	sess, err := com.CreateUploadSession(loggedInUser, dbName, size, r.PostFormValue("sha256"), r.PostForm)
+	if err != nil {
+		w.WriteHeader(com.ErrorStatus(err))
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	data, err := json.MarshalIndent(struct {
+		ID     string `json:"upload_id"`
+		Offset int64  `json:"offset"`
+		Size   int64  `json:"size"`
+	}{sess.ID, 0, sess.Size}, "", " ")
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/x/uploadsession?id="+sess.ID)
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprint(w, string(data))
+}
+
 // This function processes new database data submitted through the upload form.
 func uploadDataHandler(w http.ResponseWriter, r *http.Request) {
 	pageName := "Upload DB handler"
@@ -5566,120 +5952,131 @@ func uploadDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Grab and validate the supplied "public" form field
-	public, err := com.GetPub(r)
-	if err != nil {
-		log.Printf("%s: Error when converting public value to boolean: %v\n", pageName, err)
-		errorPage(w, r, http.StatusBadRequest, "Public value incorrect")
-		return
-	}
-
-	// Validate the licence value
-	licenceName, err := com.GetFormLicence(r)
+	tempFile, handler, err := r.FormFile("database")
 	if err != nil {
-		errorPage(w, r, http.StatusBadRequest, "Validation failed for licence value")
+		log.Printf("%s: Uploading file failed: %v\n", pageName, err)
+		errorPage(w, r, http.StatusInternalServerError, "Database file missing from upload data?")
 		return
 	}
+	defer tempFile.Close()
 
-	// Validate the source URL
-	sourceURL, err := com.GetFormSourceURL(r)
-	if err != nil {
-		errorPage(w, r, http.StatusBadRequest, "Validation failed for source URL value")
-		return
-	}
+	// Add the database
+	storeUpload(w, r, loggedInUser, handler.Filename, tempFile)
+}
 
-	// Validate the commit message
-	var commitMsg string
-	cm := r.PostFormValue("commitmsg")
-	if cm != "" {
-		err = com.ValidateMarkdown(cm)
+// Adds the database from a completed resumable upload, then bounces to the page for the database
+func uploadFinishHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	validSession := false
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
 		if err != nil {
-			errorPage(w, r, http.StatusBadRequest, "Validation failed for the commit message")
+			errorPage(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
-		commitMsg = cm
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
 	}
-
-	// Validate the (optional) branch name
-	branchName, err := com.GetFormBranch(r)
-	if err != nil {
-		log.Printf("%s: Error when validating branch name '%s': %v\n", pageName, branchName, err)
-		errorPage(w, r, http.StatusBadRequest, "Branch name value failed validation")
-		return
+	if u != nil {
+		loggedInUser = u.(string)
+		validSession = true
 	}
 
-	// TODO: Add support for folders and sub-folders
-	dbFolder := "/"
-
-	tempFile, handler, err := r.FormFile("database")
-	if err != nil {
-		log.Printf("%s: Uploading file failed: %v\n", pageName, err)
-		errorPage(w, r, http.StatusInternalServerError, "Database file missing from upload data?")
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		errorPage(w, r, http.StatusUnauthorized, "You need to be logged in")
 		return
 	}
-	dbName := handler.Filename
-	defer tempFile.Close()
 
-	// Validate the database name
-	err = com.ValidateDB(dbName)
+	// Check the upload is complete, and matches the SHA256 given when it was started
+	id := r.PostFormValue("id")
+	sess, db, err := com.FinishUploadSession(loggedInUser, id)
 	if err != nil {
-		log.Printf("%s: Validation failed for database name: %s", pageName, err)
-		errorPage(w, r, http.StatusBadRequest, "Invalid database name")
+		errorPage(w, r, com.ErrorStatus(err), err.Error())
+		com.EndUploadSession(loggedInUser, id, com.ErrorStatus(err))
 		return
 	}
 
-	// Check if the requested database exists already
-	exists, err := com.CheckDBExists(loggedInUser, loggedInUser, dbFolder, dbName)
-	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
-		return
-	}
+	// Add the database, using the form fields given when the upload was started.  The session is only removed
+	// afterwards if the upload was stored, or failed in a way which retrying won't fix
+	r.Form = sess.Fields
+	r.PostForm = sess.Fields
+	cw := com.NewCountingWriter(w)
+	storeUpload(cw, r, loggedInUser, sess.DBName, db)
+	db.Close()
+	com.EndUploadSession(loggedInUser, id, cw.Status())
+}
 
-	// Retrieve the commit ID for the head of the specified branch
-	var commitID string
-	createBranch := false
-	if exists {
-		branchList, err := com.GetBranches(loggedInUser, dbFolder, dbName)
+// Returns the progress of a resumable upload (HEAD), adds a chunk to it (PATCH), or cancels it (DELETE).  The
+// "Upload-Offset" header gives the number of bytes received so far.
+func uploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	validSession := false
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		branchEntry, ok := branchList[branchName]
-		if !ok {
-			// The specified branch name doesn't exist, so we'll need to create it
-			createBranch = true
-
-			// We also need a commit ID to branch from, so we use the head commit of the default branch
-			defBranch, err := com.GetDefaultBranchName(loggedInUser, dbFolder, dbName)
-			if err != nil {
-				errorPage(w, r, http.StatusInternalServerError, err.Error())
-				return
-			}
-			branchEntry, ok = branchList[defBranch]
-			if !ok {
-				errorPage(w, r, http.StatusInternalServerError, "Could not retrieve commit info for default branch entry")
-				return
-			}
-		}
-		commitID = branchEntry.Commit
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+		validSession = true
 	}
 
-	// Sanity check the uploaded database, and if ok then add it to the system
-	numBytes, _, err := com.AddDatabase(r, loggedInUser, loggedInUser, dbFolder, dbName, createBranch, branchName,
-		commitID, public, licenceName, commitMsg, sourceURL, tempFile, "webui", time.Now(), time.Time{},
-		"", "", "", "", nil, "")
-	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	// Log the successful database upload
-	log.Printf("%s: Username: '%s', database '%s%s%s' uploaded', bytes: %v\n", pageName, loggedInUser,
-		loggedInUser, dbFolder, dbName, numBytes)
-
-	// Database upload succeeded.  Bounce the user to the page for their new database
-	http.Redirect(w, r, fmt.Sprintf("/%s%s%s", loggedInUser, "/", dbName), http.StatusSeeOther)
+	id := r.URL.Query().Get("id")
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case http.MethodHead:
+		sess, offset, err := com.UploadSessionDetails(loggedInUser, id)
+		if err != nil {
+			w.WriteHeader(com.ErrorStatus(err))
+			return
+		}
+		w.Header().Set("Upload-Length", strconv.FormatInt(sess.Size, 10))
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Missing or invalid Upload-Offset header")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, com.MaxDatabaseSize*1024*1024)
+		newOffset, err := com.WriteUploadChunk(loggedInUser, id, offset, r.Body)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+		if err != nil {
+			w.WriteHeader(com.ErrorStatus(err))
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		err := com.RemoveUploadSession(loggedInUser, id)
+		if err != nil {
+			w.WriteHeader(com.ErrorStatus(err))
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
 }
 
 // Handles JSON requests from the front end to toggle watching of a database.
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -212,25 +214,31 @@ func branchesPage(w http.ResponseWriter, r *http.Request) {
 func commitsPage(w http.ResponseWriter, r *http.Request) {
 	// Structure to hold page data
 	type HistEntry struct {
-		AuthorEmail    string     `json:"author_email"`
-		AuthorName     string     `json:"author_name"`
-		AuthorUserName string     `json:"author_user_name"`
-		AvatarURL      string     `json:"avatar_url"`
-		CommitterEmail string     `json:"committer_email"`
-		CommitterName  string     `json:"committer_name"`
-		ID             string     `json:"id"`
-		Message        string     `json:"message"`
-		Parent         string     `json:"parent"`
-		Timestamp      time.Time  `json:"timestamp"`
-		Tree           com.DBTree `json:"tree"`
+		AuthorEmail        string                  `json:"author_email"`
+		AuthorName         string                  `json:"author_name"`
+		AuthorUserName     string                  `json:"author_user_name"`
+		AvatarURL          string                  `json:"avatar_url"`
+		CommitterEmail     string                  `json:"committer_email"`
+		CommitterName      string                  `json:"committer_name"`
+		ID                 string                  `json:"id"`
+		Message            string                  `json:"message"`
+		Parent             string                  `json:"parent"`
+		Stats              *com.DBStats            `json:"stats"`
+		Timestamp          time.Time               `json:"timestamp"`
+		Tree               com.DBTree              `json:"tree"`
+		ValidationFailures []com.ValidationFailure `json:"validation_failures"`
 	}
 	var pageData struct {
-		Auth0    com.Auth0Set
-		Branch   string
-		Branches []string
-		DB       com.SQLiteDBinfo
-		History  []HistEntry
-		Meta     com.MetaInfo
+		Auth0      com.Auth0Set
+		Branch     string
+		Branches   []string
+		DB         com.SQLiteDBinfo
+		HeadCommit string
+		History    []HistEntry
+		Meta       com.MetaInfo
+		NextOffset int
+		Offset     int
+		PrevOffset int
 	}
 	pageData.Meta.Title = "Commits settings"
 
@@ -321,48 +329,46 @@ func commitsPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Walk the commit history backwards from the head commit, assembling the commit history for this branch from the
-	// full list
-	rawList, err := com.GetCommitList(dbOwner, dbFolder, dbName)
-	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
-		return
+	// Retrieve a page of the commit history for this branch, walking backwards from the head commit
+	offsetStr := r.FormValue("offset")
+	var offset int
+	if offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Ensure the offset isn't negative
+		if offset < 0 {
+			offset = 0
+		}
 	}
-	// TODO: Ugh, this is an ugly approach just to add the username to the commit data.  Surely there's a better way?
-	// TODO  Maybe store the username in the commit data structure in the database instead?
-	// TODO: Display licence changes too
-	uName, avatarURL, err := com.GetUsernameFromEmail(rawList[headID].AuthorEmail)
+
+	// One extra commit is requested, to tell whether there are older commits after this page
+	rawList, err := com.GetCommitHistory(dbOwner, dbFolder, dbName, headID, offset, com.CommitsPerPage+1)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if avatarURL != "" {
-		avatarURL += "&s=30"
+	if len(rawList) > com.CommitsPerPage {
+		rawList = rawList[:com.CommitsPerPage]
+		pageData.NextOffset = offset + com.CommitsPerPage
 	}
-
-	// Create the history entry
-	pageData.History = []HistEntry{
-		{
-			AuthorEmail:    rawList[headID].AuthorEmail,
-			AuthorName:     rawList[headID].AuthorName,
-			AuthorUserName: uName,
-			AvatarURL:      avatarURL,
-			CommitterEmail: rawList[headID].CommitterEmail,
-			CommitterName:  rawList[headID].CommitterName,
-			ID:             rawList[headID].ID,
-			Message:        string(gfm.Markdown([]byte(rawList[headID].Message))),
-			Parent:         rawList[headID].Parent,
-			Timestamp:      rawList[headID].Timestamp,
-		},
-	}
-	commitData := com.CommitEntry{Parent: rawList[headID].Parent}
-	for commitData.Parent != "" {
-		commitData, ok = rawList[commitData.Parent]
-		if !ok {
-			errorPage(w, r, http.StatusInternalServerError, "Internal error when retrieving commit data")
-			return
+	if offset > 0 {
+		pageData.PrevOffset = offset - com.CommitsPerPage
+		if pageData.PrevOffset < 0 {
+			pageData.PrevOffset = 0
 		}
-		uName, avatarURL, err = com.GetUsernameFromEmail(commitData.AuthorEmail)
+	}
+	pageData.HeadCommit = headID
+	pageData.Offset = offset
+
+	// TODO: Ugh, this is an ugly approach just to add the username to the commit data.  Surely there's a better way?
+	// TODO  Maybe store the username in the commit data structure in the database instead?
+	// TODO: Display licence changes too
+	for _, commitData := range rawList {
+		uName, avatarURL, err := com.GetUsernameFromEmail(commitData.AuthorEmail)
 		if err != nil {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
@@ -382,7 +388,10 @@ func commitsPage(w http.ResponseWriter, r *http.Request) {
 			ID:             commitData.ID,
 			Message:        string(gfm.Markdown([]byte(commitData.Message))),
 			Parent:         commitData.Parent,
+			Stats:          commitData.Tree.Entries[0].Stats,
 			Timestamp:      commitData.Timestamp,
+
+			ValidationFailures: commitData.ValidationFailures,
 		}
 		pageData.History = append(pageData.History, newEntry)
 	}
@@ -445,6 +454,7 @@ func comparePage(w http.ResponseWriter, r *http.Request) {
 		DestOwner             string
 		Forks                 []com.ForkEntry
 		Meta                  com.MetaInfo
+		MissingTags           []string
 		MyStar                bool
 		SourceDBBranches      []string
 		SourceDBDefaultBranch string
@@ -550,6 +560,14 @@ func comparePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Retrieve the tags which exist in the destination database but not the source
+	pageData.MissingTags, err = com.MissingTags(dbOwner, dbFolder, dbName, pageData.DestOwner, pageData.DestFolder,
+		pageData.DestDBName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Check if the user has access to the requested database (and get it's details if available)
 	err = com.DBDetails(&pageData.DB, loggedInUser, dbOwner, dbFolder, dbName, "")
 	if err != nil {
@@ -617,12 +635,12 @@ func comparePage(w http.ResponseWriter, r *http.Request) {
 		destCommitID := destBranch.Commit
 
 		// Retrieve the current licence for the destination branch
-		commitList, err := com.GetCommitList(pageData.DestOwner, pageData.DestFolder, pageData.DestDBName)
+		destCommit, ok, err := com.GetCommit(pageData.DestOwner, pageData.DestFolder, pageData.DestDBName,
+			destCommitID)
 		if err != nil {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
-		destCommit, ok := commitList[destCommitID]
 		if !ok {
 			errorPage(w, r, http.StatusInternalServerError, "Destination commit ID not found in commit list.")
 			return
@@ -857,8 +875,8 @@ func contributorsPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read the commit list from the database
-	commitList, err := com.GetCommitList(dbOwner, dbFolder, dbName)
+	// Read the commit authors from the database
+	contributors, err := com.GetContributors(dbOwner, dbFolder, dbName)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -875,11 +893,9 @@ func contributorsPage(w http.ResponseWriter, r *http.Request) {
 	// Fill out the metadata
 	pageData.Meta.Database = dbName
 	pageData.Contributors = make(map[string]AuthorEntry)
-	for _, j := range commitList {
+	for _, j := range contributors {
 		// Look up the author's username
-		// TODO: There are likely a bunch of ways to optimise this, from keeping the user name entries in a map to
-		// TODO  directly storing the username in the jsonb commit data.  Storing the user name entry in the jsonb is
-		// TODO  probably the way to go, as it would save lookups in a lot of places
+		// TODO: Storing the user name entry in the commit data would save lookups in a lot of places
 		u, avatarURL, err := com.GetUsernameFromEmail(j.AuthorEmail)
 		if err != nil {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
@@ -888,27 +904,12 @@ func contributorsPage(w http.ResponseWriter, r *http.Request) {
 		if avatarURL != "" {
 			avatarURL += "&s=30"
 		}
-
-		// This ok check is just a way to decide whether to increment the NumCommits counter
-		if _, ok := pageData.Contributors[j.AuthorName]; !ok {
-			// This is the first time in the loop we're adding the author to the Contributors list
-			pageData.Contributors[j.AuthorName] = AuthorEntry{
-				AuthorEmail:    j.AuthorEmail,
-				AuthorName:     j.AuthorName,
-				AuthorUserName: u,
-				AvatarURL:      avatarURL,
-				NumCommits:     1,
-			}
-		} else {
-			// The author is already in the contributors list, so we increment their NumCommits counter
-			n := pageData.Contributors[j.AuthorName].NumCommits + 1
-			pageData.Contributors[j.AuthorName] = AuthorEntry{
-				AuthorEmail:    j.AuthorEmail,
-				AuthorName:     j.AuthorName,
-				AuthorUserName: u,
-				AvatarURL:      avatarURL,
-				NumCommits:     n,
-			}
+		pageData.Contributors[j.AuthorName] = AuthorEntry{
+			AuthorEmail:    j.AuthorEmail,
+			AuthorName:     j.AuthorName,
+			AuthorUserName: u,
+			AvatarURL:      avatarURL,
+			NumCommits:     j.NumCommits,
 		}
 	}
 
@@ -1246,12 +1247,13 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbFold
 	pageName := "Render database page"
 
 	var pageData struct {
-		Auth0   com.Auth0Set
-		Data    com.SQLiteRecordSet
-		DB      com.SQLiteDBinfo
-		Meta    com.MetaInfo
-		MyStar  bool
-		MyWatch bool
+		Auth0      com.Auth0Set
+		Data       com.SQLiteRecordSet
+		DB         com.SQLiteDBinfo
+		ForkStatus com.ForkSyncStatus
+		Meta       com.MetaInfo
+		MyStar     bool
+		MyWatch    bool
 	}
 
 	// Retrieve session data (if any)
@@ -1380,12 +1382,12 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbFold
 
 	// If a specific commit was requested, make sure it exists in the database commit history
 	if commitID != "" {
-		commitList, err := com.GetCommitList(dbOwner, dbFolder, dbName)
+		_, ok, err := com.GetCommit(dbOwner, dbFolder, dbName, commitID)
 		if err != nil {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
-		if _, ok := commitList[commitID]; !ok {
+		if !ok {
 			// The requested commit isn't one in the database commit history so error out
 			errorPage(w, r, http.StatusNotFound, fmt.Sprintf("Unknown commit for database '%s%s%s'", dbOwner,
 				dbFolder, dbName))
@@ -1533,7 +1535,7 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbFold
 	mdataCacheKey := com.MetadataCacheKey("dwndb-meta", loggedInUser, dbOwner, dbFolder, dbName,
 		commitID)
 	rowCacheKey := com.TableRowsCacheKey(fmt.Sprintf("tablejson/%s/%s/%d", sortCol, sortDir, rowOffset),
-		loggedInUser, dbOwner, dbFolder, dbName, commitID, dbTable, pageData.DB.MaxRows)
+		loggedInUser, dbOwner, dbFolder, dbName, commitID, dbTable, pageData.DB.MaxRows, nil)
 
 	// If a cached version of the page data exists, use it
 	ok, err := com.GetCachedData(mdataCacheKey, &pageData)
@@ -1602,6 +1604,19 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbFold
 		pageData.Meta.ForkDatabase = frkDB
 		pageData.Meta.ForkDeleted = frkDel
 
+		// If the database is a fork, compare the branch with the same branch of its upstream database
+		pageData.ForkStatus = com.ForkSyncStatus{}
+		if frkOwn != "" {
+			pageData.ForkStatus, err = com.ForkStatus(loggedInUser, dbOwner, dbFolder, dbName, pageData.DB.Info.Branch)
+			if err != nil {
+				// Not being able to compare (eg the branch doesn't exist upstream) isn't a problem for the page
+				if _, ok := err.(com.ActionError); !ok {
+					log.Printf("%s: Error when retrieving fork status: %v\n", pageName, err)
+				}
+				pageData.ForkStatus = com.ForkSyncStatus{}
+			}
+		}
+
 		// Get latest star and fork count
 		_, pageData.DB.Info.Stars, pageData.DB.Info.Forks, err = com.SocialStats(dbOwner, dbFolder, dbName)
 		if err != nil {
@@ -1807,6 +1822,18 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbFold
 	pageData.Meta.ForkDatabase = frkDB
 	pageData.Meta.ForkDeleted = frkDel
 
+	// If the database is a fork, compare the branch with the same branch of its upstream database
+	if frkOwn != "" {
+		pageData.ForkStatus, err = com.ForkStatus(loggedInUser, dbOwner, dbFolder, dbName, branchName)
+		if err != nil {
+			// Not being able to compare (eg the branch doesn't exist upstream) isn't a problem for the page
+			if _, ok := err.(com.ActionError); !ok {
+				log.Printf("%s: Error when retrieving fork status: %v\n", pageName, err)
+			}
+			pageData.ForkStatus = com.ForkSyncStatus{}
+		}
+	}
+
 	// Add Auth0 info to the page data
 	pageData.Auth0.CallbackURL = "https://" + com.Conf.Web.ServerName + "/x/callback"
 	pageData.Auth0.ClientID = com.Conf.Auth0.ClientID
@@ -1837,7 +1864,8 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbFold
 
 	// If the row data wasn't in cache, read it from the database
 	if !ok {
-		pageData.Data, err = com.ReadSQLiteDB(sdb, dbTable, pageData.DB.MaxRows, sortCol, sortDir, rowOffset)
+		pageData.Data, err = com.ReadSQLiteDB(sdb, dbTable, pageData.DB.MaxRows, sortCol, sortDir, rowOffset, "",
+			nil)
 		if err != nil {
 			// Some kind of error when reading the database data
 			errorPage(w, r, http.StatusBadRequest, err.Error())
@@ -2217,6 +2245,90 @@ func forksPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Render the history page, which draws the commit graph of a database including all of its branches and merges
+func historyPage(w http.ResponseWriter, r *http.Request) {
+	var pageData struct {
+		Auth0 com.Auth0Set
+		Meta  com.MetaInfo
+	}
+	pageData.Meta.Title = "History"
+
+	// Retrieve user and database name
+	dbOwner, dbName, err := com.GetOD(1, r) // 1 = Ignore "/history/" at the start of the URL
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	pageData.Meta.Database = dbName
+	dbFolder := "/"
+
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+		pageData.Meta.LoggedInUser = loggedInUser
+	}
+
+	// Check if the database exists
+	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Database failure when looking up database details")
+		return
+	}
+	if !exists {
+		errorPage(w, r, http.StatusNotFound, "That database doesn't seem to exist")
+		return
+	}
+
+	// Retrieve correctly capitalised username for the database owner
+	usr, err := com.User(dbOwner)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pageData.Meta.Owner = usr.Username
+
+	// Retrieve the details and status updates count for the logged in user
+	if loggedInUser != "" {
+		ur, err := com.User(loggedInUser)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if ur.AvatarURL != "" {
+			pageData.Meta.AvatarURL = ur.AvatarURL + "&s=48"
+		}
+		pageData.Meta.NumStatusUpdates, err = com.UserStatusUpdates(loggedInUser)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Add Auth0 info to the page data
+	pageData.Auth0.CallbackURL = "https://" + com.Conf.Web.ServerName + "/x/callback"
+	pageData.Auth0.ClientID = com.Conf.Auth0.ClientID
+	pageData.Auth0.Domain = com.Conf.Auth0.Domain
+
+	// Render the page.  The commit graph itself is retrieved by the page as JSON
+	t := tmpl.Lookup("historyPage")
+	err = t.Execute(w, pageData)
+	if err != nil {
+		log.Printf("Error: %s", err)
+	}
+}
+
 // Renders the front page of the website.
 func frontPage(w http.ResponseWriter, r *http.Request) {
 	// Structure to hold page data
@@ -2560,12 +2672,11 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Retrieve the current licence for the destination branch
-		commitList, err := com.GetCommitList(dbOwner, dbFolder, dbName)
+		destCommit, ok, err := com.GetCommit(dbOwner, dbFolder, dbName, destCommitID)
 		if err != nil {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
-		destCommit, ok := commitList[destCommitID]
 		if !ok {
 			errorPage(w, r, http.StatusInternalServerError, "Destination commit ID not found in commit list.")
 			return
@@ -2648,6 +2759,7 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 func prefPage(w http.ResponseWriter, r *http.Request, loggedInUser string) {
 	var pageData struct {
 		Auth0       com.Auth0Set
+		ClientCerts []com.ClientCertEntry
 		DisplayName string
 		Email       string
 		MaxRows     int
@@ -2678,6 +2790,13 @@ func prefPage(w http.ResponseWriter, r *http.Request, loggedInUser string) {
 	// Retrieve the user preference data
 	pageData.MaxRows = com.PrefUserMaxRows(loggedInUser)
 
+	// Retrieve the list of client certificates issued to the user
+	pageData.ClientCerts, err = com.ClientCerts(loggedInUser)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Error when retrieving client certificates")
+		return
+	}
+
 	// Retrieve the details and status updates count for the logged in user
 	ur, err := com.User(loggedInUser)
 	if err != nil {
@@ -2808,6 +2927,7 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 		Date                time.Time `json:"date"`
 		Description         string    `json:"description"`
 		DescriptionMarkdown string    `json:"description_markdown"`
+		Signed              bool      `json:"signed"`
 		ReleaserUserName    string    `json:"releaser_user_name"`
 		ReleaserDisplayName string    `json:"releaser_display_name"`
 		Size                int64     `json:"size"`
@@ -2879,6 +2999,18 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// "/releases/<owner>/<database>/latest" is a stable link to the most recent release, so redirect to its download
+	if pathStrings := strings.Split(r.URL.Path, "/"); len(pathStrings) > 4 && pathStrings[4] == com.LatestRelease {
+		relName, ok := com.LatestReleaseName(releases)
+		if !ok {
+			errorPage(w, r, http.StatusNotFound, "This database doesn't have any releases")
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/x/download/%s/%s?release=%s", dbOwner, dbName, url.QueryEscape(relName)),
+			http.StatusFound)
+		return
+	}
+
 	// Create a small username/email lookup cache, so we don't have to query the database for usernames we've already
 	// looked up
 	type userCacheEntry struct {
@@ -2927,6 +3059,7 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 				Date:                j.Date,
 				Description:         j.Description,
 				DescriptionMarkdown: r,
+				Signed:              j.Manifest != "",
 				ReleaserUserName:    userNameCache[j.ReleaserEmail].Email,
 				ReleaserDisplayName: j.ReleaserName,
 				Size:                j.Size,
@@ -2964,6 +3097,172 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Displays the schema (tables, views, indexes, and triggers) of a database commit.
+func schemaPage(w http.ResponseWriter, r *http.Request) {
+	var pageData struct {
+		Auth0  com.Auth0Set
+		DB     com.SQLiteDBinfo
+		Meta   com.MetaInfo
+		Schema com.DBSchema
+	}
+	pageData.Meta.Title = "Database schema"
+
+	// Retrieve session data (if any)
+	var loggedInUser string
+	var u interface{}
+	if com.Conf.Environment.Environment != "docker" {
+		sess, err := store.Get(r, "dbhub-user")
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		u = sess.Values["UserName"]
+	} else {
+		u = "default"
+	}
+	if u != nil {
+		loggedInUser = u.(string)
+		pageData.Meta.LoggedInUser = loggedInUser
+	}
+
+	// Retrieve the database owner & name
+	// TODO: Add folder support
+	dbFolder := "/"
+	dbOwner, dbName, err := com.GetOD(1, r) // 1 = Ignore "/schema/" at the start of the URL
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate the supplied information
+	if dbOwner == "" || dbName == "" {
+		errorPage(w, r, http.StatusBadRequest, "Missing database owner or database name")
+		return
+	}
+
+	// Check if a specific commit, branch, tag, or release was requested
+	commitID, err := com.GetFormCommit(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Invalid database commit ID")
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Validation failed for branch name")
+		return
+	}
+	tagName, err := com.GetFormTag(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Validation failed for tag name")
+		return
+	}
+	releaseName := r.FormValue("release")
+	if releaseName != "" {
+		err = com.ValidateBranchName(releaseName)
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, "Validation failed for release name")
+			return
+		}
+	}
+
+	// Check if the requested database exists
+	exists, err := com.CheckDBExists(loggedInUser, dbOwner, dbFolder, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		errorPage(w, r, http.StatusNotFound, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbOwner, dbFolder,
+			dbName))
+		return
+	}
+
+	// Work out which commit to show the schema of
+	showDefault := commitID == "" && branchName == "" && tagName == "" && releaseName == ""
+	commitID, err = com.ResolveCommit(dbOwner, dbFolder, dbName, commitID, releaseName, branchName, tagName)
+	if err != nil {
+		errorPage(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// Retrieve the database details
+	err = com.DBDetails(&pageData.DB, loggedInUser, dbOwner, dbFolder, dbName, commitID)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if showDefault {
+		branchName = pageData.DB.Info.DefaultBranch
+	}
+	pageData.DB.Info.Branch = branchName
+
+	// Retrieve the list of branches, for the branch selection drop down
+	branchHeads, err := com.GetBranches(dbOwner, dbFolder, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Couldn't retrieve branch information for database")
+		return
+	}
+	pageData.DB.Info.BranchList = []string{}
+	for i := range branchHeads {
+		pageData.DB.Info.BranchList = append(pageData.DB.Info.BranchList, i)
+	}
+	sort.Strings(pageData.DB.Info.BranchList)
+
+	// Get a handle from Minio for the database object
+	sdb, err := com.OpenMinioObject(pageData.DB.Info.DBEntry.Sha256[:com.MinioFolderChars],
+		pageData.DB.Info.DBEntry.Sha256[com.MinioFolderChars:])
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer sdb.Close()
+
+	// Read the schema
+	pageData.Schema, err = com.ReadSQLiteSchema(sdb)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Retrieve correctly capitalised username for the user
+	usr, err := com.User(dbOwner)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pageData.Meta.Owner = usr.Username
+	pageData.Meta.Database = dbName
+
+	// Retrieve the details and status updates count for the logged in user
+	if loggedInUser != "" {
+		ur, err := com.User(loggedInUser)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if ur.AvatarURL != "" {
+			pageData.Meta.AvatarURL = ur.AvatarURL + "&s=48"
+		}
+		pageData.Meta.NumStatusUpdates, err = com.UserStatusUpdates(loggedInUser)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Add Auth0 info to the page data
+	pageData.Auth0.CallbackURL = "https://" + com.Conf.Web.ServerName + "/x/callback"
+	pageData.Auth0.ClientID = com.Conf.Auth0.ClientID
+	pageData.Auth0.Domain = com.Conf.Auth0.Domain
+
+	// Render the page
+	t := tmpl.Lookup("schemaPage")
+	err = t.Execute(w, pageData)
+	if err != nil {
+		log.Printf("Error: %s", err)
+	}
+}
+
 // Displays a web page for new users to choose their username.
 func selectUserNamePage(w http.ResponseWriter, r *http.Request) {
 	var pageData struct {
@@ -3024,10 +3323,15 @@ func settingsPage(w http.ResponseWriter, r *http.Request) {
 		Auth0            com.Auth0Set
 		BranchLics       map[string]string
 		DB               com.SQLiteDBinfo
+		ForkSync         bool
 		FullDescRendered string
 		Licences         map[string]com.LicenceEntry
 		Meta             com.MetaInfo
+		MirrorBranch     string
+		MirrorChecked    time.Time
+		MirrorEnabled    bool
 		NumLicences      int
+		ValidationRules  []com.ValidationRule
 	}
 	pageData.Meta.Title = "Database settings"
 
@@ -3125,17 +3429,14 @@ func settingsPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Retrieve all of the commits for the database
-	commitList, err := com.GetCommitList(dbOwner, dbFolder, dbName)
-	if err != nil {
-		errorPage(w, r, http.StatusInternalServerError, err.Error())
-		return
-	}
-
 	// Work out the licence assigned to each of the branch heads
 	pageData.BranchLics = make(map[string]string)
 	for bName, bEntry := range branchHeads {
-		c, ok := commitList[bEntry.Commit]
+		c, ok, err := com.GetCommit(dbOwner, dbFolder, dbName, bEntry.Commit)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
 		if !ok {
 			errorPage(w, r, http.StatusInternalServerError, fmt.Sprintf(
 				"Couldn't retrieve branch '%s' head commit '%s' for database '%s%s%s'\n", bName, bEntry.Commit,
@@ -3166,6 +3467,37 @@ func settingsPage(w http.ResponseWriter, r *http.Request) {
 	}
 	pageData.NumLicences = len(pageData.Licences)
 
+	// Retrieve the source URL mirroring settings
+	pageData.MirrorEnabled = com.Conf.Mirror.Enabled
+	pageData.MirrorBranch, pageData.MirrorChecked, err = com.GetMirrorSettings(dbOwner, dbFolder, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Error when retrieving mirror settings")
+		return
+	}
+
+	// Retrieve the "forked from" information, and whether the fork is kept in sync with it
+	frkOwn, frkFol, frkDB, frkDel, err := com.ForkedFrom(dbOwner, dbFolder, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Database query failure")
+		return
+	}
+	pageData.Meta.ForkOwner = frkOwn
+	pageData.Meta.ForkFolder = frkFol
+	pageData.Meta.ForkDatabase = frkDB
+	pageData.Meta.ForkDeleted = frkDel
+	pageData.ForkSync, err = com.GetForkSync(dbOwner, dbFolder, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Error when retrieving fork sync setting")
+		return
+	}
+
+	// Retrieve the data validation rules
+	pageData.ValidationRules, err = com.GetValidationRules(dbOwner, dbFolder, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Error when retrieving data validation rules")
+		return
+	}
+
 	// Render the full description markdown
 	pageData.FullDescRendered = string(gfm.Markdown([]byte(pageData.DB.Info.FullDesc)))
 